@@ -0,0 +1,137 @@
+// Package backup exports the collections of the application to a compressed
+// archive and loads such an archive back into a database.
+//
+// An archive is a gzipped tar file holding a manifest.json, a SHA256SUMS file in
+// the format of sha256sum(1) and one file per collection. The collection files
+// hold either one MongoDB Extended JSON document per line (jsonl) or the raw
+// BSON documents one after another (bson).
+package backup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// the formats a collection can be written in
+const (
+	FormatJSONL = "jsonl"
+	FormatBSON  = "bson"
+)
+
+const (
+	manifestName  = "manifest.json"
+	checksumsName = "SHA256SUMS"
+	// archiveVersion is bumped when the layout of the archive changes
+	archiveVersion = 1
+)
+
+// Collections are the collections the application reads and writes. "user" is the
+// collection the token helper used to write to before everything moved to "users",
+// it is only exported when it still exists.
+var Collections = []string{"branches", "food", "menu", "table", "order", "orderItems", "invoices", "users", "user", "audit_log", "revoked_tokens", "user_tokens", "login_attempts", "login_throttles", "api_keys"}
+
+// Manifest describes the content of an archive
+type Manifest struct {
+	Version     int               `json:"version"`
+	Format      string            `json:"format"`
+	Database    string            `json:"database"`
+	Created_at  time.Time         `json:"created_at"`
+	Collections []CollectionEntry `json:"collections"`
+}
+
+// CollectionEntry is one collection file of an archive
+type CollectionEntry struct {
+	Name      string `json:"name"`
+	File      string `json:"file"`
+	Documents int64  `json:"documents"`
+	SHA256    string `json:"sha256"`
+}
+
+// entry returns the manifest entry of a file of the archive
+func (m Manifest) entry(file string) (CollectionEntry, bool) {
+	for _, entry := range m.Collections {
+		if entry.File == file {
+			return entry, true
+		}
+	}
+	return CollectionEntry{}, false
+}
+
+// documentWriter writes documents of one format to a stream
+type documentWriter func(w io.Writer, doc bson.Raw) error
+
+// documentReader returns the next document of a stream, io.EOF after the last one
+type documentReader func() (bson.Raw, error)
+
+func newDocumentWriter(format string) (documentWriter, error) {
+	switch format {
+	case FormatJSONL:
+		return func(w io.Writer, doc bson.Raw) error {
+			line, err := bson.MarshalExtJSON(doc, true, false)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(line, '\n'))
+			return err
+		}, nil
+	case FormatBSON:
+		return func(w io.Writer, doc bson.Raw) error {
+			_, err := w.Write(doc)
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected %s or %s", format, FormatJSONL, FormatBSON)
+}
+
+func newDocumentReader(format string, r io.Reader) (documentReader, error) {
+	switch format {
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		// a single document can be up to 16MB
+		scanner.Buffer(make([]byte, 64*1024), 17*1024*1024)
+		return func() (bson.Raw, error) {
+			for scanner.Scan() {
+				if len(scanner.Bytes()) == 0 {
+					continue
+				}
+				var doc bson.D
+				if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+					return nil, err
+				}
+				return bson.Marshal(doc)
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}, nil
+	case FormatBSON:
+		buffered := bufio.NewReader(r)
+		return func() (bson.Raw, error) {
+			var length [4]byte
+			if _, err := io.ReadFull(buffered, length[:]); err != nil {
+				return nil, err
+			}
+			size := int32(binary.LittleEndian.Uint32(length[:]))
+			if size < 5 {
+				return nil, errors.New("corrupt bson document")
+			}
+			doc := make([]byte, size)
+			copy(doc, length[:])
+			if _, err := io.ReadFull(buffered, doc[4:]); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			return bson.Raw(doc), bson.Raw(doc).Validate()
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
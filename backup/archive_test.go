@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDocumentsRoundTrip(t *testing.T) {
+	created := time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)
+	docs := []bson.D{
+		{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "name", Value: "Soup"}, {Key: "price", Value: bson.D{{Key: "amount", Value: int64(450)}, {Key: "currency", Value: "USD"}}}},
+		{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "created_at", Value: created}, {Key: "tags", Value: bson.A{"hot", int32(2)}}},
+	}
+
+	for _, format := range []string{FormatJSONL, FormatBSON} {
+		write, err := newDocumentWriter(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		for _, doc := range docs {
+			raw, err := bson.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := write(&buf, raw); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		read, err := newDocumentReader(format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, doc := range docs {
+			raw, err := read()
+			if err != nil {
+				t.Fatalf("%s: document %d: %v", format, i, err)
+			}
+			want, _ := bson.Marshal(doc)
+			if !bytes.Equal(raw, want) {
+				t.Errorf("%s: document %d changed on the way: %v, want %v", format, i, raw, bson.Raw(want))
+			}
+		}
+		if _, err := read(); !errors.Is(err, io.EOF) {
+			t.Errorf("%s: expected io.EOF after the last document, got %v", format, err)
+		}
+	}
+}
+
+func TestTruncatedBSON(t *testing.T) {
+	raw, _ := bson.Marshal(bson.D{{Key: "name", Value: "Soup"}})
+	read, _ := newDocumentReader(FormatBSON, bytes.NewReader(raw[:len(raw)-2]))
+	if _, err := read(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := newDocumentWriter("csv"); err == nil {
+		t.Errorf("expected csv to be refused")
+	}
+	if _, err := newDocumentReader("csv", bytes.NewReader(nil)); err == nil {
+		t.Errorf("expected csv to be refused")
+	}
+}
@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Options selects what a backup contains
+type Options struct {
+	// Format is FormatJSONL or FormatBSON
+	Format string
+	// Collections limits the backup to these collections, empty means all of Collections
+	Collections []string
+}
+
+// Backup writes an archive of the collections of db to w. Every collection is spooled
+// to a temporary file first so its checksum can go into the manifest at the start of
+// the archive, the documents are never all held in memory.
+func Backup(ctx context.Context, db *mongo.Database, w io.Writer, opts Options) (Manifest, error) {
+	write, err := newDocumentWriter(opts.Format)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	names, err := existingCollections(ctx, db, opts.Collections)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := Manifest{
+		Version:    archiveVersion,
+		Format:     opts.Format,
+		Database:   db.Name(),
+		Created_at: time.Now().UTC(),
+	}
+
+	spools := make([]*os.File, 0, len(names))
+	defer func() {
+		for _, spool := range spools {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+	}()
+
+	for _, name := range names {
+		spool, err := os.CreateTemp("", "restaurant-backup-*")
+		if err != nil {
+			return Manifest{}, err
+		}
+		spools = append(spools, spool)
+
+		entry, err := dumpCollection(ctx, db.Collection(name), spool, write)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("exporting %s: %w", name, err)
+		}
+		entry.Name = name
+		entry.File = name + "." + opts.Format
+		manifest.Collections = append(manifest.Collections, entry)
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := writeFile(archive, manifestName, manifest.Created_at, strings.NewReader(string(manifestJSON)), int64(len(manifestJSON))); err != nil {
+		return Manifest{}, err
+	}
+
+	var sums strings.Builder
+	for _, entry := range manifest.Collections {
+		fmt.Fprintf(&sums, "%s  %s\n", entry.SHA256, entry.File)
+	}
+	if err := writeFile(archive, checksumsName, manifest.Created_at, strings.NewReader(sums.String()), int64(sums.Len())); err != nil {
+		return Manifest{}, err
+	}
+
+	for i, spool := range spools {
+		info, err := spool.Stat()
+		if err != nil {
+			return Manifest{}, err
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return Manifest{}, err
+		}
+		if err := writeFile(archive, manifest.Collections[i].File, manifest.Created_at, spool, info.Size()); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, gz.Close()
+}
+
+// existingCollections returns the selected collections that exist in db, in the order of Collections
+func existingCollections(ctx context.Context, db *mongo.Database, selected []string) ([]string, error) {
+	wanted, err := selection(selected)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, name := range existing {
+		present[name] = true
+	}
+
+	names := []string{}
+	for _, name := range Collections {
+		if wanted(name) && present[name] {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// selection checks a list of collection names and returns a matcher for it, an empty list matches everything
+func selection(selected []string) (func(name string) bool, error) {
+	if len(selected) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	known := map[string]bool{}
+	for _, name := range Collections {
+		known[name] = true
+	}
+	chosen := map[string]bool{}
+	for _, name := range selected {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown collection %q, expected one of %s", name, strings.Join(Collections, ", "))
+		}
+		chosen[name] = true
+	}
+	return func(name string) bool { return chosen[name] }, nil
+}
+
+// dumpCollection writes every document of coll, soft-deleted ones included, and returns their count and checksum
+func dumpCollection(ctx context.Context, coll *mongo.Collection, w io.Writer, write documentWriter) (CollectionEntry, error) {
+	var entry CollectionEntry
+
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return entry, err
+	}
+	defer cursor.Close(ctx)
+
+	hash := sha256.New()
+	out := io.MultiWriter(w, hash)
+	for cursor.Next(ctx) {
+		if err := write(out, cursor.Current); err != nil {
+			return entry, err
+		}
+		entry.Documents++
+	}
+	if err := cursor.Err(); err != nil {
+		return entry, err
+	}
+
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return entry, nil
+}
+
+func writeFile(archive *tar.Writer, name string, modified time.Time, content io.Reader, size int64) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: modified, Typeflag: tar.TypeReg}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(archive, content)
+	return err
+}
@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BackupCommand runs the "backup" subcommand of the binary:
+//
+//	backup [-format jsonl|bson] [-out file] [-collections food,menu,...]
+func BackupCommand(ctx context.Context, db *mongo.Database, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	flags.SetOutput(out)
+	format := flags.String("format", FormatJSONL, "format of the collection files, jsonl or bson")
+	path := flags.String("out", "", "archive to write (default: restaurant-<timestamp>.tar.gz)")
+	collections := flags.String("collections", "", "comma separated collections to export (default: all)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		*path = fmt.Sprintf("restaurant-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	}
+
+	file, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	manifest, err := Backup(ctx, db, file, Options{Format: *format, Collections: splitList(*collections)})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*path)
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION\tDOCUMENTS\tSHA256")
+	for _, entry := range manifest.Collections {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", entry.Name, entry.Documents, entry.SHA256)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "wrote %s\n", *path)
+	return nil
+}
+
+// RestoreCommand runs the "restore" subcommand of the binary:
+//
+//	restore [-dry-run] [-mode skip|overwrite] [-collections food,menu,...] archive
+func RestoreCommand(ctx context.Context, db *mongo.Database, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dryRun := flags.Bool("dry-run", false, "verify the archive and report what would change without writing")
+	mode := flags.String("mode", ModeSkip, "what to do with documents that already exist, skip or overwrite")
+	collections := flags.String("collections", "", "comma separated collections to restore (default: all)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: restore [-dry-run] [-mode skip|overwrite] [-collections list] archive")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	manifest, reports, err := Restore(ctx, db, file, RestoreOptions{
+		Collections: splitList(*collections),
+		Mode:        *mode,
+		DryRun:      *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Fprintf(out, "dry run, nothing was written\n")
+	}
+	fmt.Fprintf(out, "archive of %s taken %s\n", manifest.Database, manifest.Created_at.Format(time.RFC3339))
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION\tDOCUMENTS\tINSERTED\tREPLACED\tSKIPPED")
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", report.Name, report.Documents, report.Inserted, report.Replaced, report.Skipped)
+	}
+	return w.Flush()
+}
+
+func splitList(list string) []string {
+	names := []string{}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
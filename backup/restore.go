@@ -0,0 +1,209 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// what a restore does with a document whose _id is already in the database
+const (
+	ModeSkip      = "skip"
+	ModeOverwrite = "overwrite"
+)
+
+// RestoreOptions controls how an archive is loaded
+type RestoreOptions struct {
+	// Collections limits the restore to these collections, empty means every collection of the archive
+	Collections []string
+	// Mode is ModeSkip or ModeOverwrite
+	Mode string
+	// DryRun checks the archive and counts what would change without writing anything
+	DryRun bool
+}
+
+// CollectionReport tells what a restore did to one collection
+type CollectionReport struct {
+	Name      string
+	Documents int64
+	Inserted  int64
+	Replaced  int64
+	Skipped   int64
+}
+
+// Restore loads an archive written by Backup into db. Every collection file is checked
+// against the checksum and the document count of the manifest before anything is written.
+func Restore(ctx context.Context, db *mongo.Database, r io.Reader, opts RestoreOptions) (Manifest, []CollectionReport, error) {
+	if opts.Mode != ModeSkip && opts.Mode != ModeOverwrite {
+		return Manifest{}, nil, fmt.Errorf("unknown mode %q, expected %s or %s", opts.Mode, ModeSkip, ModeOverwrite)
+	}
+	wanted, err := selection(opts.Collections)
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+
+	manifest, err := readManifest(archive)
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+
+	reports := []CollectionReport{}
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return manifest, reports, err
+		}
+		if header.Name == checksumsName {
+			continue
+		}
+
+		entry, ok := manifest.entry(header.Name)
+		if !ok {
+			return manifest, reports, fmt.Errorf("%s is not listed in the manifest", header.Name)
+		}
+		if !wanted(entry.Name) {
+			continue
+		}
+
+		report, err := restoreCollection(ctx, db.Collection(entry.Name), archive, manifest.Format, entry, opts)
+		if err != nil {
+			return manifest, reports, fmt.Errorf("restoring %s: %w", entry.Name, err)
+		}
+		reports = append(reports, report)
+	}
+	return manifest, reports, nil
+}
+
+// readManifest reads the manifest, which Backup writes as the first file of the archive
+func readManifest(archive *tar.Reader) (Manifest, error) {
+	var manifest Manifest
+	header, err := archive.Next()
+	if err != nil {
+		return manifest, fmt.Errorf("reading the archive: %w", err)
+	}
+	if header.Name != manifestName {
+		return manifest, fmt.Errorf("the archive does not start with %s", manifestName)
+	}
+	if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("reading %s: %w", manifestName, err)
+	}
+	if manifest.Version != archiveVersion {
+		return manifest, fmt.Errorf("archive version %d is not supported", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// restoreCollection verifies one collection file and then applies its documents
+func restoreCollection(ctx context.Context, coll *mongo.Collection, content io.Reader, format string, entry CollectionEntry, opts RestoreOptions) (CollectionReport, error) {
+	report := CollectionReport{Name: entry.Name}
+
+	// the file is spooled so it can be verified before the first document is written
+	spool, err := os.CreateTemp("", "restaurant-restore-*")
+	if err != nil {
+		return report, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(spool, hash), content); err != nil {
+		return report, err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != entry.SHA256 {
+		return report, fmt.Errorf("checksum mismatch, the archive is corrupt")
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return report, err
+	}
+
+	next, err := newDocumentReader(format, spool)
+	if err != nil {
+		return report, err
+	}
+	for {
+		doc, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("document %d: %w", report.Documents, err)
+		}
+		report.Documents++
+		if err := applyDocument(ctx, coll, doc, opts, &report); err != nil {
+			return report, fmt.Errorf("document %d: %w", report.Documents-1, err)
+		}
+	}
+
+	if report.Documents != entry.Documents {
+		return report, fmt.Errorf("the manifest lists %d documents but the file has %d", entry.Documents, report.Documents)
+	}
+	return report, nil
+}
+
+func applyDocument(ctx context.Context, coll *mongo.Collection, doc bson.Raw, opts RestoreOptions, report *CollectionReport) error {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return fmt.Errorf("document has no _id")
+	}
+	filter := bson.D{{Key: "_id", Value: id}}
+
+	if opts.DryRun {
+		count, err := coll.CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		switch {
+		case count == 0:
+			report.Inserted++
+		case opts.Mode == ModeOverwrite:
+			report.Replaced++
+		default:
+			report.Skipped++
+		}
+		return nil
+	}
+
+	if opts.Mode == ModeSkip {
+		_, err := coll.InsertOne(ctx, doc)
+		if mongo.IsDuplicateKeyError(err) {
+			report.Skipped++
+			return nil
+		}
+		if err == nil {
+			report.Inserted++
+		}
+		return err
+	}
+
+	result, err := coll.ReplaceOne(ctx, filter, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		report.Replaced++
+	} else {
+		report.Inserted++
+	}
+	return nil
+}
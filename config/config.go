@@ -0,0 +1,368 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"restaurant-backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Config holds every setting the application reads at startup.
+// Values are taken from an optional JSON file (CONFIG_FILE) first and
+// then overridden by environment variables, so a checked-in file can hold
+// the defaults for a stack while secrets still come from the environment.
+type Config struct {
+	Mongo  MongoConfig  `json:"mongo"`
+	Server ServerConfig `json:"server"`
+	Tokens TokensConfig `json:"tokens"`
+	Mail   MailConfig   `json:"mail"`
+	MFA    MFAConfig    `json:"mfa"`
+	// Currency is the ISO 4217 code of the prices sent without a currency
+	Currency string `json:"currency"`
+	// Timezone is the IANA name of the timezone the menu schedules of the branches
+	// without a timezone of their own are read in, like "Europe/Berlin"
+	Timezone string `json:"timezone"`
+	// AdminUserIDs are the users who count as admins without the admin role, which is how
+	// the first admin gets in before anybody can assign roles
+	AdminUserIDs []string `json:"admin_user_ids"`
+}
+
+// MongoConfig describes how to reach the MongoDB deployment
+type MongoConfig struct {
+	URI                    string   `json:"uri"`
+	Database               string   `json:"database"`
+	Username               string   `json:"username"`
+	Password               string   `json:"password"`
+	AuthSource             string   `json:"auth_source"`
+	MaxPoolSize            uint64   `json:"max_pool_size"`
+	MinPoolSize            uint64   `json:"min_pool_size"`
+	ConnectTimeout         Duration `json:"connect_timeout"`
+	ServerSelectionTimeout Duration `json:"server_selection_timeout"`
+	TLS                    bool     `json:"tls"`
+	TLSCAFile              string   `json:"tls_ca_file"`
+	TLSCertificateKeyFile  string   `json:"tls_certificate_key_file"`
+	TLSInsecure            bool     `json:"tls_insecure"`
+	ConnectRetries         int      `json:"connect_retries"`
+	RetryBackoff           Duration `json:"retry_backoff"`
+	MaxRetryBackoff        Duration `json:"max_retry_backoff"`
+}
+
+// ServerConfig describes the HTTP server
+type ServerConfig struct {
+	Port              string   `json:"port"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	WriteTimeout      Duration `json:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout"`
+	// DrainDelay is how long the server keeps serving after failing the readiness probe on
+	// SIGTERM, long enough for the load balancer to probe again and stop sending requests
+	DrainDelay Duration `json:"drain_delay"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish on SIGTERM
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// TrustedProxies are the addresses of the load balancers whose X-Forwarded-For header
+	// gives the client ip, the failed logins are counted per client ip
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// TokensConfig names the keys the tokens are signed with
+type TokensConfig struct {
+	// KeysDir holds one .pem file per key, the file name is the kid of the key
+	KeysDir string `json:"keys_dir"`
+	// SigningKey is the kid new tokens are signed with, it may be empty when KeysDir
+	// has a single private key
+	SigningKey string `json:"signing_key"`
+}
+
+// MailConfig describes how the password reset and email verification messages are sent
+type MailConfig struct {
+	// SpoolDir is the directory every message is written to as an .eml file
+	SpoolDir string `json:"spool_dir"`
+	From     string `json:"from"`
+	// LinkBaseURL is the address of the app the links in the messages point to
+	LinkBaseURL string `json:"link_base_url"`
+}
+
+// MFAConfig describes the two-factor authentication of the users
+type MFAConfig struct {
+	// RequiredRoles only count for users who logged in with a one-time code, an empty
+	// list leaves two-factor authentication up to every user
+	RequiredRoles []string `json:"required_roles"`
+	// Issuer names the service in the authenticator apps
+	Issuer string `json:"issuer"`
+}
+
+// Duration is a time.Duration that is written as "10s" or "1m30s" in the config file
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON accepts either a duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+		return nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(b, &seconds); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\" or a number of seconds")
+	}
+	d.Duration = time.Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// MarshalJSON writes the duration back in its string form
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+// Default returns the configuration used for local development
+func Default() Config {
+	return Config{
+		Mongo: MongoConfig{
+			URI:                    "mongodb://localhost:27017",
+			Database:               "restaurant",
+			MaxPoolSize:            100,
+			ConnectTimeout:         Duration{10 * time.Second},
+			ServerSelectionTimeout: Duration{10 * time.Second},
+			ConnectRetries:         5,
+			RetryBackoff:           Duration{time.Second},
+			MaxRetryBackoff:        Duration{30 * time.Second},
+		},
+		Server: ServerConfig{
+			Port:              "8000",
+			ReadTimeout:       Duration{15 * time.Second},
+			ReadHeaderTimeout: Duration{5 * time.Second},
+			WriteTimeout:      Duration{2 * time.Minute},
+			IdleTimeout:       Duration{2 * time.Minute},
+			DrainDelay:        Duration{10 * time.Second},
+			ShutdownTimeout:   Duration{30 * time.Second},
+		},
+		Tokens: TokensConfig{
+			KeysDir: "keys",
+		},
+		Mail: MailConfig{
+			SpoolDir:    "spool",
+			From:        "Restaurant <no-reply@localhost>",
+			LinkBaseURL: "http://localhost:8000",
+		},
+		MFA: MFAConfig{
+			RequiredRoles: []string{models.RoleAdmin, models.RoleManager},
+			Issuer:        "Restaurant",
+		},
+		Currency: "USD",
+		Timezone: "UTC",
+	}
+}
+
+// Load builds the configuration from the defaults, the CONFIG_FILE and the environment
+func Load() (Config, error) {
+	cfg := Default()
+
+	// reading the optional config file
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("reading config file %s: %w", path, err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	// environment variables always win over the file
+	env := envReader{}
+	env.str("MONGODB_URI", &cfg.Mongo.URI)
+	env.str("MONGODB_DATABASE", &cfg.Mongo.Database)
+	env.str("MONGODB_USERNAME", &cfg.Mongo.Username)
+	env.str("MONGODB_PASSWORD", &cfg.Mongo.Password)
+	env.str("MONGODB_AUTH_SOURCE", &cfg.Mongo.AuthSource)
+	env.uint("MONGODB_MAX_POOL_SIZE", &cfg.Mongo.MaxPoolSize)
+	env.uint("MONGODB_MIN_POOL_SIZE", &cfg.Mongo.MinPoolSize)
+	env.duration("MONGODB_CONNECT_TIMEOUT", &cfg.Mongo.ConnectTimeout)
+	env.duration("MONGODB_SERVER_SELECTION_TIMEOUT", &cfg.Mongo.ServerSelectionTimeout)
+	env.bool("MONGODB_TLS", &cfg.Mongo.TLS)
+	env.str("MONGODB_TLS_CA_FILE", &cfg.Mongo.TLSCAFile)
+	env.str("MONGODB_TLS_CERTIFICATE_KEY_FILE", &cfg.Mongo.TLSCertificateKeyFile)
+	env.bool("MONGODB_TLS_INSECURE", &cfg.Mongo.TLSInsecure)
+	env.int("MONGODB_CONNECT_RETRIES", &cfg.Mongo.ConnectRetries)
+	env.duration("MONGODB_RETRY_BACKOFF", &cfg.Mongo.RetryBackoff)
+	env.duration("MONGODB_MAX_RETRY_BACKOFF", &cfg.Mongo.MaxRetryBackoff)
+	env.str("PORT", &cfg.Server.Port)
+	env.duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	env.duration("SERVER_READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	env.duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	env.duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	env.duration("SERVER_DRAIN_DELAY", &cfg.Server.DrainDelay)
+	env.duration("SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	env.list("SERVER_TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	env.str("TOKEN_KEYS_DIR", &cfg.Tokens.KeysDir)
+	env.str("TOKEN_SIGNING_KEY", &cfg.Tokens.SigningKey)
+	env.str("MAIL_SPOOL_DIR", &cfg.Mail.SpoolDir)
+	env.str("MAIL_FROM", &cfg.Mail.From)
+	env.str("MAIL_LINK_BASE_URL", &cfg.Mail.LinkBaseURL)
+	env.list("MFA_REQUIRED_ROLES", &cfg.MFA.RequiredRoles)
+	env.str("MFA_ISSUER", &cfg.MFA.Issuer)
+	env.str("CURRENCY", &cfg.Currency)
+	env.str("TIMEZONE", &cfg.Timezone)
+	env.list("ADMIN_USER_IDS", &cfg.AdminUserIDs)
+	if env.err != nil {
+		return cfg, env.err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate reports settings that can never work
+func (c Config) Validate() error {
+	if c.Mongo.URI == "" {
+		return fmt.Errorf("mongo uri must not be empty")
+	}
+	if c.Mongo.Database == "" {
+		return fmt.Errorf("mongo database name must not be empty")
+	}
+	if c.Mongo.MinPoolSize > c.Mongo.MaxPoolSize && c.Mongo.MaxPoolSize != 0 {
+		return fmt.Errorf("mongo min_pool_size (%d) is larger than max_pool_size (%d)", c.Mongo.MinPoolSize, c.Mongo.MaxPoolSize)
+	}
+	if c.Mongo.ConnectRetries < 1 {
+		return fmt.Errorf("mongo connect_retries must be at least 1")
+	}
+	if c.Server.Port == "" {
+		return fmt.Errorf("server port must not be empty")
+	}
+	if c.Server.DrainDelay.Duration < 0 {
+		return fmt.Errorf("server drain_delay must not be negative")
+	}
+	if c.Server.ShutdownTimeout.Duration <= 0 {
+		return fmt.Errorf("server shutdown_timeout must be positive")
+	}
+	if c.Tokens.KeysDir == "" {
+		return fmt.Errorf("tokens keys_dir must not be empty")
+	}
+	if c.Mail.SpoolDir == "" {
+		return fmt.Errorf("mail spool_dir must not be empty")
+	}
+	if strings.ContainsAny(c.Mail.From, "\r\n") {
+		return fmt.Errorf("mail from must be a single line")
+	}
+	for _, role := range c.MFA.RequiredRoles {
+		if !models.IsRole(role) {
+			return fmt.Errorf("mfa required_roles: %q is not a role, the roles are %s", role, strings.Join(models.Roles, ", "))
+		}
+	}
+	if c.MFA.Issuer == "" || strings.Contains(c.MFA.Issuer, ":") {
+		return fmt.Errorf("mfa issuer must not be empty or contain a colon")
+	}
+	if len(c.Currency) != 3 || strings.ToUpper(c.Currency) != c.Currency {
+		return fmt.Errorf("currency %q is not a three letter ISO 4217 code like USD", c.Currency)
+	}
+	if _, err := c.Location(); err != nil {
+		return fmt.Errorf("timezone %q is not an IANA timezone like Europe/Berlin", c.Timezone)
+	}
+	for _, id := range c.AdminUserIDs {
+		if !primitive.IsValidObjectID(id) {
+			return fmt.Errorf("admin_user_ids: %q is not a user id", id)
+		}
+	}
+	return nil
+}
+
+// Location returns the configured timezone
+func (c Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return nil, fmt.Errorf("timezone must not be empty")
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// envReader copies environment variables into config fields and keeps the first parse error
+type envReader struct {
+	err error
+}
+
+func (e *envReader) lookup(key string) (string, bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+func (e *envReader) fail(key string, value string, err error) {
+	if e.err == nil {
+		e.err = fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+	}
+}
+
+func (e *envReader) str(key string, dst *string) {
+	if value, ok := e.lookup(key); ok {
+		*dst = value
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	if value, ok := e.lookup(key); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envReader) uint(key string, dst *uint64) {
+	if value, ok := e.lookup(key); ok {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envReader) bool(key string, dst *bool) {
+	if value, ok := e.lookup(key); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envReader) duration(key string, dst *Duration) {
+	if value, ok := e.lookup(key); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		dst.Duration = parsed
+	}
+}
+
+// list reads a comma separated list
+func (e *envReader) list(key string, dst *[]string) {
+	if value, ok := e.lookup(key); ok {
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+}
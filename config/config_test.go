@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the variables Load reads, cleared so the environment of the test run does not leak in
+var envKeys = []string{
+	"CONFIG_FILE", "MONGODB_URI", "MONGODB_DATABASE", "MONGODB_USERNAME", "MONGODB_PASSWORD",
+	"MONGODB_AUTH_SOURCE", "MONGODB_MAX_POOL_SIZE", "MONGODB_MIN_POOL_SIZE", "MONGODB_CONNECT_TIMEOUT",
+	"MONGODB_SERVER_SELECTION_TIMEOUT", "MONGODB_TLS", "MONGODB_TLS_CA_FILE",
+	"MONGODB_TLS_CERTIFICATE_KEY_FILE", "MONGODB_TLS_INSECURE", "MONGODB_CONNECT_RETRIES",
+	"MONGODB_RETRY_BACKOFF", "MONGODB_MAX_RETRY_BACKOFF", "PORT", "SERVER_READ_TIMEOUT",
+	"SERVER_READ_HEADER_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SERVER_IDLE_TIMEOUT", "SERVER_DRAIN_DELAY",
+	"SERVER_SHUTDOWN_TIMEOUT", "SERVER_TRUSTED_PROXIES", "TOKEN_KEYS_DIR", "TOKEN_SIGNING_KEY",
+	"MAIL_SPOOL_DIR", "MAIL_FROM", "MAIL_LINK_BASE_URL", "MFA_REQUIRED_ROLES", "MFA_ISSUER",
+	"CURRENCY", "TIMEZONE", "ADMIN_USER_IDS",
+}
+
+// clearEnv blanks every variable Load reads, an empty value counts as unset
+func clearEnv(t *testing.T) {
+	for _, key := range envKeys {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Load without settings = %+v, want the defaults %+v", cfg, Default())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(`{"mongo": {"database": "from_file", "connect_timeout": 3}, "server": {"port": "9000"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		env   map[string]string
+		check func(cfg Config) bool
+	}{
+		{"file", map[string]string{"CONFIG_FILE": file}, func(cfg Config) bool {
+			return cfg.Mongo.Database == "from_file" && cfg.Mongo.ConnectTimeout.Duration == 3*time.Second && cfg.Server.Port == "9000"
+		}},
+		{"environment over the file", map[string]string{"CONFIG_FILE": file, "PORT": "9100", "MONGODB_DATABASE": "from_env"}, func(cfg Config) bool {
+			return cfg.Server.Port == "9100" && cfg.Mongo.Database == "from_env"
+		}},
+		{"numbers, flags and durations", map[string]string{"MONGODB_MAX_POOL_SIZE": "20", "MONGODB_TLS": "true", "SERVER_DRAIN_DELAY": "0s", "MONGODB_CONNECT_RETRIES": "2"}, func(cfg Config) bool {
+			return cfg.Mongo.MaxPoolSize == 20 && cfg.Mongo.TLS && cfg.Server.DrainDelay.Duration == 0 && cfg.Mongo.ConnectRetries == 2
+		}},
+		{"lists", map[string]string{"SERVER_TRUSTED_PROXIES": " 10.0.0.1, ,10.0.0.2", "MFA_REQUIRED_ROLES": "admin", "ADMIN_USER_IDS": "64b7f0c2a1b2c3d4e5f60718"}, func(cfg Config) bool {
+			return reflect.DeepEqual(cfg.Server.TrustedProxies, []string{"10.0.0.1", "10.0.0.2"}) &&
+				reflect.DeepEqual(cfg.MFA.RequiredRoles, []string{"admin"}) &&
+				reflect.DeepEqual(cfg.AdminUserIDs, []string{"64b7f0c2a1b2c3d4e5f60718"})
+		}},
+		{"blank values are unset", map[string]string{"PORT": "  ", "CURRENCY": ""}, func(cfg Config) bool {
+			return cfg.Server.Port == "8000" && cfg.Currency == "USD"
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range c.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !c.check(cfg) {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte(`{"mongo": {"connect_timeout": "soon"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"missing file", map[string]string{"CONFIG_FILE": filepath.Join(dir, "missing.json")}, "reading config file"},
+		{"malformed file", map[string]string{"CONFIG_FILE": broken}, "parsing config file"},
+		{"number", map[string]string{"MONGODB_CONNECT_RETRIES": "three"}, "MONGODB_CONNECT_RETRIES"},
+		{"unsigned number", map[string]string{"MONGODB_MAX_POOL_SIZE": "-1"}, "MONGODB_MAX_POOL_SIZE"},
+		{"flag", map[string]string{"MONGODB_TLS": "maybe"}, "MONGODB_TLS"},
+		{"duration", map[string]string{"SERVER_SHUTDOWN_TIMEOUT": "30"}, "SERVER_SHUTDOWN_TIMEOUT"},
+		{"invalid setting", map[string]string{"CURRENCY": "dollars"}, "currency"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range c.env {
+				t.Setenv(key, value)
+			}
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("Load = %v, want an error about %s", err, c.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(cfg *Config)
+		want   string
+	}{
+		{"no mongo uri", func(cfg *Config) { cfg.Mongo.URI = "" }, "mongo uri"},
+		{"no database", func(cfg *Config) { cfg.Mongo.Database = "" }, "database"},
+		{"pool bounds", func(cfg *Config) { cfg.Mongo.MinPoolSize = 200 }, "min_pool_size"},
+		{"no connect retries", func(cfg *Config) { cfg.Mongo.ConnectRetries = 0 }, "connect_retries"},
+		{"no port", func(cfg *Config) { cfg.Server.Port = "" }, "port"},
+		{"negative drain delay", func(cfg *Config) { cfg.Server.DrainDelay.Duration = -time.Second }, "drain_delay"},
+		{"no shutdown timeout", func(cfg *Config) { cfg.Server.ShutdownTimeout.Duration = 0 }, "shutdown_timeout"},
+		{"no keys dir", func(cfg *Config) { cfg.Tokens.KeysDir = "" }, "keys_dir"},
+		{"no spool dir", func(cfg *Config) { cfg.Mail.SpoolDir = "" }, "spool_dir"},
+		{"sender on two lines", func(cfg *Config) { cfg.Mail.From = "a@example.com\r\nBcc: b@example.com" }, "single line"},
+		{"unknown role", func(cfg *Config) { cfg.MFA.RequiredRoles = []string{"chef"} }, "required_roles"},
+		{"issuer with a colon", func(cfg *Config) { cfg.MFA.Issuer = "Restaurant:Main" }, "issuer"},
+		{"lower case currency", func(cfg *Config) { cfg.Currency = "usd" }, "currency"},
+		{"unknown timezone", func(cfg *Config) { cfg.Timezone = "Mars/Olympus" }, "timezone"},
+		{"no timezone", func(cfg *Config) { cfg.Timezone = "" }, "timezone"},
+		{"admin id that is not a user id", func(cfg *Config) { cfg.AdminUserIDs = []string{"alice"} }, "admin_user_ids"},
+	}
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("the defaults do not validate: %v", err)
+	}
+	for _, c := range cases {
+		cfg := Default()
+		c.change(&cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: Validate = %v, want an error about %s", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/mail"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the password reset and email verification flows, they run without a token: the
+// mailed one-time token proves the caller holds the address
+
+// emailRequest is the body of ForgotPassword and ResendVerification
+type emailRequest struct {
+	Email   string   `json:"email" validate:"required"`
+}
+
+// resetPasswordRequest is the body of ResetPassword
+type resetPasswordRequest struct {
+	Token      string   `json:"token" validate:"required"`
+	// the same rule as the password of models.User
+	Password   string   `json:"password" validate:"required,min=6"`
+}
+
+// verifyEmailRequest is the body of VerifyEmail
+type verifyEmailRequest struct {
+	Token   string   `json:"token" validate:"required"`
+}
+
+// the answer to a request for a link, it is the same whether the email is registered or
+// not so the endpoint can not be used to find out who works here
+const linkRequested = "if the email belongs to an account, a message with a link was sent to it"
+
+// ForgotPassword mails a link to reset the password to the user with the email
+func (ctl *Controller) ForgotPassword() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body emailRequest
+		if !bindBody(c,&body){
+			return
+		}
+
+		user,err := ctl.repos.Users.GetByEmail(ctx,body.Email)
+		if err != nil && !errors.Is(err,repository.ErrNotFound){
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while looking the email up"})
+			return
+		}
+		if err == nil{
+			secret,token := helper.NewUserToken(user,models.PasswordResetToken,helper.PasswordResetLifetime)
+			msg := mail.Message{
+				To: body.Email,
+				Subject: "Reset your password",
+				Body: fmt.Sprintf("Someone asked to reset the password of your account. If it was you, open\n\n%s\n\n"+
+					"within %s to choose a new password. Otherwise you can ignore this message.\n",
+					ctl.link("/reset-password",secret),hours(helper.PasswordResetLifetime)),
+			}
+			if err := ctl.issueAndMail(ctx,token,msg); err != nil{
+				log.Printf("mailing the password reset of user %s: %v",user.User_id,err)
+			}
+		}
+
+		c.JSON(http.StatusAccepted,gin.H{"message":linkRequested})
+	}
+}
+
+// ResetPassword sets a new password with a token mailed by ForgotPassword. Every session
+// of the user ends, whoever knew the old password is logged out, and a lockout is lifted.
+func (ctl *Controller) ResetPassword() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body resetPasswordRequest
+		if !bindBody(c,&body){
+			return
+		}
+
+		token,ok := ctl.consumeUserToken(ctx,c,body.Token,models.PasswordResetToken)
+		if !ok{
+			return
+		}
+
+		password := HashPassword(body.Password)
+		updatedAt,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		before,err := ctl.repos.Users.Get(ctx,token.User_id)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		result,err := ctl.repos.Users.Update(ctx,token.User_id,0,primitive.D{
+			{Key: "password",Value: password},
+			{Key: "updated_at",Value: updatedAt},
+		})
+		if err != nil{
+			repositoryError(c,err,"password could not be reset")
+			return
+		}
+		if err := ctl.revokeSessions(ctx,token.User_id); err != nil{
+			repositoryError(c,err,"password was reset but the sessions could not be revoked")
+			return
+		}
+		// whoever reset the password holds the email, the failed logins before do not count
+		if result.Email != nil{
+			if err := ctl.repos.Logins.Clear(ctx,emailKey(*result.Email)); err != nil{
+				log.Printf("unlocking user %s after a password reset: %v",token.User_id,err)
+			}
+		}
+
+		// the token stands in for the user
+		c.Set("uid",token.User_id)
+		ctl.audit(ctx,c,"user","reset_password",token.User_id,before,result)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ResendVerification mails another email verification link to the user with the email
+func (ctl *Controller) ResendVerification() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body emailRequest
+		if !bindBody(c,&body){
+			return
+		}
+
+		user,err := ctl.repos.Users.GetByEmail(ctx,body.Email)
+		if err != nil && !errors.Is(err,repository.ErrNotFound){
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while looking the email up"})
+			return
+		}
+		if err == nil && user.Email_verified_at == nil{
+			if err := ctl.sendVerification(ctx,user); err != nil{
+				log.Printf("mailing the email verification of user %s: %v",user.User_id,err)
+			}
+		}
+
+		c.JSON(http.StatusAccepted,gin.H{"message":linkRequested})
+	}
+}
+
+// VerifyEmail marks the email of the user as verified with a token mailed by sendVerification
+func (ctl *Controller) VerifyEmail() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body verifyEmailRequest
+		if !bindBody(c,&body){
+			return
+		}
+
+		token,ok := ctl.consumeUserToken(ctx,c,body.Token,models.EmailVerificationToken)
+		if !ok{
+			return
+		}
+
+		before,err := ctl.repos.Users.Get(ctx,token.User_id)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		// the link only verifies the address it was sent to
+		if before.Email == nil || *before.Email != token.Email{
+			c.JSON(http.StatusBadRequest,gin.H{"error":"the email of the account changed since the link was sent"})
+			return
+		}
+
+		verifiedAt,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		result,err := ctl.repos.Users.Update(ctx,token.User_id,0,primitive.D{
+			{Key: "email_verified_at",Value: verifiedAt},
+			{Key: "updated_at",Value: verifiedAt},
+		})
+		if err != nil{
+			repositoryError(c,err,"email could not be verified")
+			return
+		}
+
+		c.Set("uid",token.User_id)
+		ctl.audit(ctx,c,"user","verify_email",token.User_id,before,result)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// sendVerification mails a link to verify the email of the user
+func (ctl *Controller) sendVerification(ctx context.Context,user models.User) error{
+	secret,token := helper.NewUserToken(user,models.EmailVerificationToken,helper.EmailVerificationLifetime)
+	msg := mail.Message{
+		To: token.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Open\n\n%s\n\nwithin %s to confirm this is your email.\n",
+			ctl.link("/verify-email",secret),hours(helper.EmailVerificationLifetime)),
+	}
+	return ctl.issueAndMail(ctx,token,msg)
+}
+
+// issueAndMail stores a user token and mails the message carrying it
+func (ctl *Controller) issueAndMail(ctx context.Context,token models.UserToken,msg mail.Message) error{
+	if err := ctl.repos.UserTokens.Issue(ctx,token); err != nil{
+		return err
+	}
+	return ctl.mailer.Send(ctx,msg)
+}
+
+// consumeUserToken uses up a mailed token, it answers 400 when the token is unknown, used or expired
+func (ctl *Controller) consumeUserToken(ctx context.Context,c *gin.Context,secret string,purpose string) (models.UserToken,bool){
+	token,err := ctl.repos.UserTokens.Consume(ctx,helper.HashSecret(secret),purpose,time.Now())
+	if errors.Is(err,repository.ErrNotFound){
+		c.JSON(http.StatusBadRequest,gin.H{"error":"the link is not valid anymore, ask for a new one"})
+		return token,false
+	}
+	if err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking the link"})
+		return token,false
+	}
+	return token,true
+}
+
+// link returns the address of a page of the app that is given the token
+func (ctl *Controller) link(path string,token string) string{
+	return ctl.linkBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// hours writes a lifetime for the messages, "1 hour" or "48 hours"
+func hours(d time.Duration) string{
+	if d == time.Hour{
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d hours",int(d.Hours()))
+}
+
+// bindBody reads and validates a JSON body, it answers 400 when that fails
+func bindBody(c *gin.Context,body interface{}) bool{
+	if err := c.BindJSON(body); err != nil{
+		c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+		return false
+	}
+	if validationErr := validate.Struct(body); validationErr != nil{
+		c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"restaurant-backend/models"
+	"strings"
+	"testing"
+)
+
+var linkToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// mailedToken returns the token of the last link to the path the spool holds for the email
+func (ts *testServer) mailedToken(email string,path string) string{
+	ts.t.Helper()
+	files,err := filepath.Glob(filepath.Join(ts.spool,"*.eml"))
+	if err != nil{
+		ts.t.Fatal(err)
+	}
+	token := ""
+	for _,file := range files{
+		content,err := os.ReadFile(file)
+		if err != nil{
+			ts.t.Fatal(err)
+		}
+		message := string(content)
+		if !strings.Contains(message,"To: " + email + "\r\n") || !strings.Contains(message,path + "?token="){
+			continue
+		}
+		if match := linkToken.FindStringSubmatch(message); match != nil{
+			if token,err = url.QueryUnescape(match[1]); err != nil{
+				ts.t.Fatal(err)
+			}
+		}
+	}
+	return token
+}
+
+func TestPasswordReset(t *testing.T){
+	ts := newTestServer(t)
+	_,token := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	// an unknown email gets the same answer and no message
+	unknown := expect(t,ts.do(http.MethodPost,"/users/password/forgot","",`{"email":"nobody@example.com"}`),http.StatusAccepted)
+	known := expect(t,ts.do(http.MethodPost,"/users/password/forgot","",`{"email":"waiter@example.com"}`),http.StatusAccepted)
+	if str(unknown,"message") != str(known,"message"){
+		t.Errorf("the answers tell the emails apart: %v and %v",unknown,known)
+	}
+	if ts.mailedToken("nobody@example.com","/reset-password") != ""{
+		t.Error("no message should be sent to an unknown email")
+	}
+	reset := ts.mailedToken("waiter@example.com","/reset-password")
+	if reset == ""{
+		t.Fatal("expected a reset link to be mailed")
+	}
+
+	expect(t,ts.do(http.MethodPost,"/users/password/reset","",`{"token":"` + reset + `","password":"short"}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/users/password/reset","",`{"token":"garbage","password":"secret2"}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/users/password/reset","",`{"token":"` + reset + `","password":"secret2"}`),http.StatusNoContent)
+	// a link works once
+	expect(t,ts.do(http.MethodPost,"/users/password/reset","",`{"token":"` + reset + `","password":"secret3"}`),http.StatusBadRequest)
+
+	expect(t,ts.do(http.MethodGet,"/users/me",token,""),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/login","",`{"email":"waiter@example.com","password":"secret2"}`),http.StatusOK)
+
+	// the link of a user deleted since does not find them
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	cook,_ := ts.createUser("cook@example.com",models.RoleKitchen)
+	expect(t,ts.do(http.MethodPost,"/users/password/forgot","",`{"email":"cook@example.com"}`),http.StatusAccepted)
+	expect(t,ts.do(http.MethodDelete,"/users/" + cook.User_id,admin,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/users/password/reset","",`{"token":"` + ts.mailedToken("cook@example.com","/reset-password") + `","password":"secret2"}`),http.StatusNotFound)
+}
+
+func TestEmailVerification(t *testing.T){
+	ts := newTestServer(t)
+	user,token := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	expect(t,ts.do(http.MethodPost,"/users/email/verify/resend","",`{"email":"waiter@example.com"}`),http.StatusAccepted)
+	verify := ts.mailedToken("waiter@example.com","/verify-email")
+	if verify == ""{
+		t.Fatal("expected a verification link to be mailed")
+	}
+	// a reset token does not verify an email
+	expect(t,ts.do(http.MethodPost,"/users/password/forgot","",`{"email":"waiter@example.com"}`),http.StatusAccepted)
+	expect(t,ts.do(http.MethodPost,"/users/email/verify","",`{"token":"` + ts.mailedToken("waiter@example.com","/reset-password") + `"}`),http.StatusBadRequest)
+
+	expect(t,ts.do(http.MethodPost,"/users/email/verify","",`{"token":"` + verify + `"}`),http.StatusNoContent)
+	expect(t,ts.do(http.MethodPost,"/users/email/verify","",`{"token":"` + verify + `"}`),http.StatusBadRequest)
+	me := expect(t,ts.do(http.MethodGet,"/users/me",token,""),http.StatusOK)
+	if me["email_verified_at"] == nil{
+		t.Errorf("expected the email of %s to be verified, got %v",user.User_id,me)
+	}
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// api keys are shared by the whole group like the branches, the handlers below run
+// without a branch scope and are limited to the admins by the routes
+
+func (ctl *Controller) GetAPIKeys() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		keys,total,err := ctl.repos.APIKeys.List(ctx,pagination(c))
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing api keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK,gin.H{"total_count":total,"api_keys":keys})
+	}
+}
+
+// CreateAPIKey makes a key for a device. The key is only part of this answer, it can
+// not be looked up again.
+func (ctl *Controller) CreateAPIKey() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		var apiKey models.APIKey
+
+		if err := c.BindJSON(&apiKey); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(apiKey); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		// a key is granted permissions of the policy, never the admin role
+		for _,scope := range apiKey.Scopes{
+			if _,ok := middleware.Policy[scope]; !ok{
+				c.JSON(http.StatusBadRequest,gin.H{"error":fmt.Sprintf("unknown scope %q, see GET /roles",scope)})
+				return
+			}
+		}
+
+		if apiKey.Branch_id != nil && *apiKey.Branch_id != ""{
+			if _,err := ctl.repos.Branches.Get(ctx,*apiKey.Branch_id); err != nil{
+				repositoryError(c,err,fmt.Sprintf("branch %s was not found",*apiKey.Branch_id))
+				return
+			}
+		}
+
+		now,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		if apiKey.Expires_at != nil && !apiKey.Expires_at.After(now){
+			c.JSON(http.StatusBadRequest,gin.H{"error":"expires_at has to be in the future"})
+			return
+		}
+
+		apiKey.Created_at = now
+		apiKey.Updated_at = now
+		apiKey.ID = primitive.NewObjectID()
+		apiKey.Key_id = apiKey.ID.Hex()
+		apiKey.Version = 1
+		apiKey.Created_by = c.GetString("uid")
+		apiKey.Last_used_at = nil
+		apiKey.Revoked_at = nil
+
+		key,secretHash := helper.NewAPIKey(apiKey.Key_id)
+		apiKey.Secret_hash = secretHash
+		apiKey.Prefix = key[:len(helper.APIKeyPrefix)+len(apiKey.Key_id)]
+
+		if err := ctl.repos.APIKeys.Create(ctx,apiKey); err != nil{
+			repositoryError(c,err,"api key was not created")
+			return
+		}
+
+		ctl.audit(ctx,c,"api_key","create",apiKey.Key_id,nil,apiKey)
+
+		c.Header("ETag",etag(apiKey.Version))
+		c.JSON(http.StatusOK,gin.H{"api_key":apiKey,"key":key})
+	}
+}
+
+// RevokeAPIKey stops a key from working at once, the key stays listed with its revoked_at
+func (ctl *Controller) RevokeAPIKey() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		keyId := c.Param("key_id")
+
+		before,err := ctl.repos.APIKeys.Get(ctx,keyId)
+		if err != nil{
+			repositoryError(c,err,"api key was not found")
+			return
+		}
+		if before.Revoked_at != nil{
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		now,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		result,err := ctl.repos.APIKeys.Update(ctx,keyId,0,primitive.D{
+			bson.E{Key: "revoked_at",Value: now},
+			bson.E{Key: "updated_at",Value: now},
+		})
+		if err != nil{
+			repositoryError(c,err,"api key was not revoked")
+			return
+		}
+
+		ctl.audit(ctx,c,"api_key","revoke",keyId,before,result)
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,58 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"strings"
+	"testing"
+)
+
+// createAPIKey makes a key of the branch of the server with the scopes and returns it
+func (ts *testServer) createAPIKey(admin string,scopes string) (string,string){
+	ts.t.Helper()
+	body := expect(ts.t,ts.do(http.MethodPost,"/api-keys",admin,`{"name":"Kitchen display","scopes":[` + scopes + `],"branch_id":"` + ts.branch + `"}`),http.StatusOK)
+	apiKey,_ := body["api_key"].(map[string]interface{})
+	return str(apiKey,"key_id"),str(body,"key")
+}
+
+func TestAPIKeyRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+
+	expect(t,ts.do(http.MethodPost,"/api-keys",manager,`{"name":"Till","scopes":["food:read"]}`),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/api-keys",admin,`{"name":"Till","scopes":[]}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/api-keys",admin,`{"name":"Till","scopes":["everything"]}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/api-keys",admin,`{"name":"Till","scopes":["food:read"],"branch_id":"nope"}`),http.StatusNotFound)
+	expect(t,ts.do(http.MethodPost,"/api-keys",admin,`{"name":"Till","scopes":["food:read"],"expires_at":"2001-01-01T00:00:00Z"}`),http.StatusBadRequest)
+
+	keyId,key := ts.createAPIKey(admin,`"food:read","order:read"`)
+	if !strings.HasPrefix(key,"rk_"){
+		t.Errorf("expected the key to carry its prefix, got %q",key)
+	}
+
+	// the key is answered once, the list only shows its prefix
+	list := ts.do(http.MethodGet,"/api-keys",admin,"")
+	keys := expect(t,list,http.StatusOK)
+	if keys["total_count"] != float64(1) || strings.Contains(list.Body.String(),key) || strings.Contains(list.Body.String(),"secret"){
+		t.Errorf("expected one key listed without its secret, got %v",keys)
+	}
+
+	// the device calls with the permissions of its scopes, on its branch only
+	expect(t,ts.do(http.MethodGet,"/foods",key,""),http.StatusOK)
+	expect(t,ts.do(http.MethodGet,"/orders",key,"","Authorization","ApiKey " + key),http.StatusOK)
+	forbidden := ts.do(http.MethodPost,"/foods",key,`{}`)
+	expect(t,forbidden,http.StatusForbidden)
+	if !strings.HasPrefix(forbidden.Header().Get("WWW-Authenticate"),"ApiKey"){
+		t.Errorf("expected an ApiKey challenge, got %q",forbidden.Header().Get("WWW-Authenticate"))
+	}
+	expect(t,ts.do(http.MethodGet,"/foods",key,"","X-Branch-ID",ts.createBranch("Other")),http.StatusForbidden)
+	expect(t,ts.do(http.MethodGet,"/api-keys",key,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/users/logout",key,""),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodGet,"/foods",key + "x",""),http.StatusUnauthorized)
+
+	expect(t,ts.do(http.MethodDelete,"/api-keys/" + keyId,admin,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodDelete,"/api-keys/" + keyId,admin,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodGet,"/foods",key,""),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodDelete,"/api-keys/000000000000000000000000",admin,""),http.StatusNotFound)
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"reflect"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fields that never show up in the audit log, they change on every write or are secrets
+var auditIgnored = map[string]bool{"_id":true,"updated_at":true,"version":true}
+var auditRedacted = map[string]bool{"password":true,"token":true,"refresh_token":true,"token_family":true,"secret_hash":true,"mfa_secret":true,"mfa_pending_secret":true,"mfa_recovery_codes":true,"pin_hash":true}
+
+// audit records who changed what on a document. before is nil for a create and after is nil
+// for a purge. A failed write to the audit log is logged, the change itself already happened.
+func (ctl *Controller) audit(ctx context.Context,c *gin.Context,resource string,action string,id string,before interface{},after interface{}){
+	changes,err := diff(before,after)
+	if err != nil{
+		log.Printf("audit: diffing %s %s: %v",resource,id,err)
+		return
+	}
+
+	entry := models.AuditEntry{
+		ID:primitive.NewObjectID(),
+		Actor_uid:c.GetString("uid"),
+		Resource:resource,
+		Resource_id:id,
+		Action:action,
+		Changes:changes,
+		Request_id:c.GetString("request_id"),
+		Branch_id:c.GetString("branch_id"),
+	}
+	entry.Audit_id = entry.ID.Hex()
+	entry.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+
+	if err := ctl.repos.Audit.Record(ctx,entry); err != nil{
+		log.Printf("audit: recording %s of %s %s: %v",action,resource,id,err)
+	}
+}
+
+// diff compares the stored form of two documents field by field
+func diff(before interface{},after interface{}) ([]models.FieldChange,error){
+	old,err := storedFields(before)
+	if err != nil{
+		return nil,err
+	}
+	updated,err := storedFields(after)
+	if err != nil{
+		return nil,err
+	}
+
+	fields := []string{}
+	for field := range old{
+		fields = append(fields,field)
+	}
+	for field := range updated{
+		if _,ok := old[field]; !ok{
+			fields = append(fields,field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _,field := range fields{
+		if auditIgnored[field]{
+			continue
+		}
+		oldValue,newValue := old[field],updated[field]
+		if reflect.DeepEqual(oldValue,newValue){
+			continue
+		}
+		if auditRedacted[field]{
+			oldValue,newValue = redact(oldValue),redact(newValue)
+		}
+		changes = append(changes,models.FieldChange{Field:field,Before:oldValue,After:newValue})
+	}
+	return changes,nil
+}
+
+// storedFields returns the fields of a document the way they are written to the database
+func storedFields(doc interface{}) (bson.M,error){
+	fields := bson.M{}
+	if doc == nil{
+		return fields,nil
+	}
+	raw,err := bson.Marshal(doc)
+	if err != nil{
+		return nil,err
+	}
+	err = bson.Unmarshal(raw,&fields)
+	return fields,err
+}
+
+// redact hides a secret but still shows whether it was set
+func redact(value interface{}) interface{}{
+	if value == nil{
+		return nil
+	}
+	return "[redacted]"
+}
+
+// GetAudit searches the audit log of every branch, the changes to users, roles, branches
+// and api keys are made outside a branch and have no branch_id
+func (ctl *Controller) GetAudit() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		// the filters are all optional, the dates are RFC3339 timestamps
+		filter := repository.AuditFilter{
+			Resource:c.Query("resource"),
+			Actor:c.Query("actor"),
+			Branch:c.Query("branch_id"),
+		}
+		for param,target := range map[string]*time.Time{"from":&filter.From,"to":&filter.To}{
+			value := c.Query(param)
+			if value == ""{
+				continue
+			}
+			parsed,err := time.Parse(time.RFC3339,value)
+			if err != nil{
+				c.JSON(http.StatusBadRequest,gin.H{"error":param + " must be an RFC3339 timestamp"})
+				return
+			}
+			*target = parsed
+		}
+
+		entries,total,err := ctl.repos.Audit.Search(ctx,filter,pagination(c))
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while searching the audit log"})
+			return
+		}
+
+		c.JSON(http.StatusOK,gin.H{"total_count":total,"audit_items":entries})
+	}
+}
@@ -0,0 +1,84 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+// auditChanges returns the changes of the audit entry as field, before and after
+func auditChanges(entry map[string]interface{}) map[string][2]interface{}{
+	changes := map[string][2]interface{}{}
+	list,_ := entry["changes"].([]interface{})
+	for _,item := range list{
+		change := item.(map[string]interface{})
+		changes[str(change,"field")] = [2]interface{}{change["before"],change["after"]}
+	}
+	return changes
+}
+
+func TestAuditLog(t *testing.T){
+	ts := newTestServer(t)
+	admin,adminToken := ts.createUser("admin@example.com",models.RoleAdmin)
+	manager,managerToken := ts.createUser("manager@example.com",models.RoleManager)
+	menuId := ts.createMenu(managerToken)
+	foodId := ts.createFood(managerToken,menuId,"4.50")
+	w := ts.do(http.MethodPatch,"/foods/" + foodId,managerToken,`{"name":"Stew"}`,"If-Match",`"1"`,"X-Request-ID","req-42")
+	expect(t,w,http.StatusOK)
+	if w.Header().Get("X-Request-ID") != "req-42"{
+		t.Errorf("expected the request id to be echoed, got %q",w.Header().Get("X-Request-ID"))
+	}
+
+	expect(t,ts.do(http.MethodGet,"/audit",managerToken,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodGet,"/audit?from=yesterday",adminToken,""),http.StatusBadRequest)
+
+	log := expect(t,ts.do(http.MethodGet,"/audit?resource=food",adminToken,""),http.StatusOK)
+	if log["total_count"] != float64(2){
+		t.Fatalf("expected the create and the update of the food, got %v",log)
+	}
+	var update map[string]interface{}
+	for _,item := range log["audit_items"].([]interface{}){
+		entry := item.(map[string]interface{})
+		if str(entry,"action") == "update"{
+			update = entry
+		}
+	}
+	if update == nil || str(update,"actor_uid") != manager.User_id || str(update,"resource_id") != foodId || str(update,"request_id") != "req-42"{
+		t.Fatalf("expected the update of the food by the manager, got %v",log)
+	}
+	name := auditChanges(update)["name"]
+	if name[0] != "Soup" || name[1] != "Stew"{
+		t.Errorf("expected the name to change from Soup to Stew, got %v",update["changes"])
+	}
+	if _,ok := auditChanges(update)["version"]; ok{
+		t.Errorf("the version is not audited, got %v",update["changes"])
+	}
+
+	if byAdmin := expect(t,ts.do(http.MethodGet,"/audit?actor=" + admin.User_id,adminToken,""),http.StatusOK); byAdmin["total_count"] != float64(0){
+		t.Errorf("the admin changed nothing, got %v",byAdmin)
+	}
+}
+
+func TestAuditLogRedactsSecrets(t *testing.T){
+	ts := newTestServer(t)
+	_,adminToken := ts.createUser("admin@example.com",models.RoleAdmin)
+	_,waiterToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	expect(t,ts.do(http.MethodPost,"/users/me/password",waiterToken,`{"current_password":"secret1","new_password":"secret2"}`),http.StatusNoContent)
+
+	log := expect(t,ts.do(http.MethodGet,"/audit?resource=user",adminToken,""),http.StatusOK)
+	found := false
+	for _,item := range log["audit_items"].([]interface{}){
+		change,ok := auditChanges(item.(map[string]interface{}))["password"]
+		if !ok{
+			continue
+		}
+		found = true
+		if change[0] != "[redacted]" || change[1] != "[redacted]"{
+			t.Errorf("expected the password to be redacted, got %v",change)
+		}
+	}
+	if !found{
+		t.Errorf("expected the password change in the audit log, got %v",log)
+	}
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// branches are shared by the whole group, the handlers below run without a branch scope
+// and except for GetBranches they are limited to the admins by the routes
+
+func (ctl *Controller) GetBranches() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		allBranches,_,err := ctl.repos.Branches.List(ctx,repository.ListOptions{})
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing branches"})
+			return
+		}
+
+		// staff only see the branches they work at
+		if !middleware.IsAdmin(c){
+			memberships := c.GetStringSlice("branches")
+			visible := []models.Branch{}
+			for _,branch := range allBranches{
+				if memberOf(memberships,branch.Branch_id){
+					visible = append(visible,branch)
+				}
+			}
+			allBranches = visible
+		}
+
+		c.JSON(http.StatusOK,allBranches)
+	}
+}
+
+// memberOf reports whether the branch is one of the branches of the caller
+func memberOf(memberships []string,branchId string) bool{
+	for _,id := range memberships{
+		if id == branchId{
+			return true
+		}
+	}
+	return false
+}
+
+func (ctl *Controller) GetBranch() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		branchId := c.Param("branch_id")
+
+		// like in the listing, staff only see the branches they work at
+		if !middleware.IsAdmin(c) && !memberOf(c.GetStringSlice("branches"),branchId){
+			c.JSON(http.StatusNotFound,gin.H{"error":"branch was not found"})
+			return
+		}
+
+		branch,err := ctl.repos.Branches.Get(ctx,branchId)
+		if err != nil{
+			repositoryError(c,err,"branch was not found")
+			return
+		}
+
+		c.Header("ETag",etag(branch.Version))
+		c.JSON(http.StatusOK,branch)
+	}
+}
+
+func (ctl *Controller) CreateBranch() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		var branch models.Branch
+
+		if err := c.BindJSON(&branch); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(branch); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+		if !validTimezone(c,branch.Timezone){
+			return
+		}
+
+		branch.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		branch.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		branch.ID = primitive.NewObjectID()
+		branch.Branch_id = branch.ID.Hex()
+		branch.Version = 1
+
+		if err := ctl.repos.Branches.Create(ctx,branch); err != nil{
+			repositoryError(c,err,"branch was not created")
+			return
+		}
+
+		ctl.audit(ctx,c,"branch","create",branch.Branch_id,nil,branch)
+
+		c.Header("ETag",etag(branch.Version))
+		c.JSON(http.StatusOK,branch)
+	}
+}
+
+func (ctl *Controller) UpdateBranch() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		var branch models.Branch
+
+		branchId := c.Param("branch_id")
+
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
+		if err := c.BindJSON(&branch); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+
+		var updateObj primitive.D
+
+		if branch.Name != nil{
+			updateObj = append(updateObj, bson.E{Key: "name",Value: branch.Name})
+		}
+
+		if branch.Address != nil{
+			updateObj = append(updateObj, bson.E{Key: "address",Value: branch.Address})
+		}
+
+		if !validTimezone(c,branch.Timezone){
+			return
+		}
+		if branch.Timezone != nil{
+			updateObj = append(updateObj, bson.E{Key: "timezone",Value: branch.Timezone})
+		}
+
+		branch.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at",Value: branch.Updated_at})
+
+		before,err := ctl.repos.Branches.Get(ctx,branchId)
+		if err != nil{
+			repositoryError(c,err,"branch was not found")
+			return
+		}
+		result,err := ctl.repos.Branches.Update(ctx,branchId,version,updateObj)
+		if err != nil{
+			repositoryError(c,err,"branch update failed")
+			return
+		}
+
+		ctl.audit(ctx,c,"branch","update",branchId,before,result)
+
+		c.Header("ETag",etag(result.Version))
+		c.JSON(http.StatusOK,result)
+	}
+}
+
+// validTimezone answers 400 for a timezone that is not an IANA name, an empty one
+// stands for the configured timezone
+func validTimezone(c *gin.Context,timezone *string) bool{
+	if timezone == nil || *timezone == ""{
+		return true
+	}
+	if _,err := time.LoadLocation(*timezone); err != nil{
+		c.JSON(http.StatusBadRequest,gin.H{"error":fmt.Sprintf("timezone %q is not an IANA timezone like Europe/Berlin",*timezone)})
+		return false
+	}
+	return true
+}
+
+// branchLocation returns the timezone the menu schedules of the branch are read in
+func (ctl *Controller) branchLocation(ctx context.Context,branchId string) (*time.Location,error){
+	branch,err := ctl.repos.Branches.Get(ctx,branchId)
+	if err != nil{
+		return nil,err
+	}
+	if branch.Timezone == nil || *branch.Timezone == ""{
+		return models.DefaultLocation,nil
+	}
+	return time.LoadLocation(*branch.Timezone)
+}
+
+// branchInUse refuses to remove a branch that still has tables, menus or staff
+func (ctl *Controller) branchInUse(ctx context.Context,branchId string) error{
+	scoped := repository.WithBranch(ctx,branchId)
+
+	_,tables,err := ctl.repos.Tables.List(scoped,repository.ListOptions{Limit: 1})
+	if err != nil{
+		return err
+	}
+	_,menus,err := ctl.repos.Menus.List(scoped,repository.ListOptions{Limit: 1})
+	if err != nil{
+		return err
+	}
+	_,users,err := ctl.repos.Users.List(scoped,repository.ListOptions{Limit: 1})
+	if err != nil{
+		return err
+	}
+	if tables+menus+users > 0{
+		return conflictError{fmt.Sprintf("branch still has %d tables, %d menus and %d users",tables,menus,users)}
+	}
+	return nil
+}
+
+func (ctl *Controller) DeleteBranch() gin.HandlerFunc{
+	return softDelete[models.Branch](ctl,"branch",ctl.repos.Branches,"branch_id",ctl.branchInUse)
+}
+
+func (ctl *Controller) RestoreBranch() gin.HandlerFunc{
+	return restore[models.Branch](ctl,"branch",ctl.repos.Branches,"branch_id",nil)
+}
+
+func (ctl *Controller) PurgeBranch() gin.HandlerFunc{
+	return purge[models.Branch](ctl,"branch",ctl.repos.Branches,"branch_id",ctl.branchInUse)
+}
+
+// userBranches is the body of SetUserBranches
+type userBranches struct {
+	Branches []string `json:"branches" validate:"required"`
+}
+
+// SetUserBranches replaces the branches a user works at and signs them out, they log in again
+// for the new branches to be part of their token.
+func (ctl *Controller) SetUserBranches() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		// the user may not work at any branch of the admin yet
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		userId := c.Param("user_id")
+
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
+		var body userBranches
+		if err := c.BindJSON(&body); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		// every branch has to exist
+		for _,branchId := range body.Branches{
+			if _,err := ctl.repos.Branches.Get(ctx,branchId); err != nil{
+				repositoryError(c,err,fmt.Sprintf("branch %s was not found",branchId))
+				return
+			}
+		}
+
+		updatedAt,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		updateObj := primitive.D{
+			{Key: "branches",Value: body.Branches},
+			{Key: "updated_at",Value: updatedAt},
+		}
+
+		before,err := ctl.repos.Users.Get(ctx,userId)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		result,err := ctl.repos.Users.Update(ctx,userId,version,updateObj)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		// the tokens issued before carry the old branches
+		if err := ctl.revokeSessions(ctx,userId); err != nil{
+			repositoryError(c,err,"branches were changed but the sessions could not be revoked")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","update",userId,before,result)
+
+		c.Header("ETag",etag(result.Version))
+		c.JSON(http.StatusOK,newUserResponse(result))
+	}
+}
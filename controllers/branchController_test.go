@@ -0,0 +1,106 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBranchScope(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	other := ts.createBranch("Other")
+
+	expect(t,ts.do(http.MethodGet,"/foods",manager,"","X-Branch-ID",other),http.StatusForbidden)
+
+	// a food of another branch is not found from this one
+	food := primitive.NewObjectID()
+	name,image,menu := "Soup","soup.png","m"
+	if err := ts.repos.Foods.Create(ts.ctx(),models.Food{ID: food,Food_id: food.Hex(),Name: &name,Food_image: &image,Menu_id: &menu,Version: 1,Branch_id: other}); err != nil{
+		t.Fatal(err)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods/" + food.Hex(),manager,""),http.StatusNotFound)
+
+	// an admin may pick any branch, the documents created are stamped with it
+	expect(t,ts.do(http.MethodGet,"/foods/" + food.Hex(),admin,"","X-Branch-ID",other),http.StatusOK)
+	table := expect(t,ts.do(http.MethodPost,"/tables",admin,`{"number_of_guests":2,"table_number":1}`,"X-Branch-ID",other),http.StatusOK)
+	if str(table,"branch_id") != other{
+		t.Errorf("expected the table to belong to the branch picked, got %v",table)
+	}
+	if tables := expectList(t,ts.do(http.MethodGet,"/tables",manager,""),http.StatusOK); len(tables) != 0{
+		t.Errorf("expected no table at the branch of the manager, got %v",tables)
+	}
+
+	// staff of several branches have to pick one
+	both,_ := ts.createUser("both@example.com",models.RoleManager)
+	both.Branches = []string{ts.branch,other}
+	expect(t,ts.do(http.MethodGet,"/tables",ts.token(both),""),http.StatusBadRequest)
+	if tables := expectList(t,ts.do(http.MethodGet,"/tables",ts.token(both),"","X-Branch-ID",other),http.StatusOK); len(tables) != 1{
+		t.Errorf("expected the table of the other branch, got %v",tables)
+	}
+}
+
+func TestBranchRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	waiter,waiterToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	expect(t,ts.do(http.MethodPost,"/branches",waiterToken,`{"name":"North"}`),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/branches",admin,`{"name":"North","timezone":"Mars/Olympus"}`),http.StatusBadRequest)
+	branch := expect(t,ts.do(http.MethodPost,"/branches",admin,`{"name":"North","timezone":"Europe/Berlin"}`),http.StatusOK)
+	branchId := str(branch,"branch_id")
+
+	if branches := expectList(t,ts.do(http.MethodGet,"/branches",admin,""),http.StatusOK); len(branches) != 2{
+		t.Errorf("an admin sees every branch, got %v",branches)
+	}
+	if branches := expectList(t,ts.do(http.MethodGet,"/branches",waiterToken,""),http.StatusOK); len(branches) != 1 || str(branches[0],"branch_id") != ts.branch{
+		t.Errorf("staff see the branches they work at, got %v",branches)
+	}
+	expect(t,ts.do(http.MethodGet,"/branches/" + branchId,admin,""),http.StatusOK)
+	// staff only get their own branch, like in the listing
+	expect(t,ts.do(http.MethodGet,"/branches/" + ts.branch,waiterToken,""),http.StatusOK)
+	expect(t,ts.do(http.MethodGet,"/branches/" + branchId,waiterToken,""),http.StatusNotFound)
+	expect(t,ts.do(http.MethodPatch,"/branches/nope",admin,`{"name":"Nowhere"}`,"If-Match",`"1"`),http.StatusNotFound)
+	branch = expect(t,ts.do(http.MethodPatch,"/branches/" + branchId,admin,`{"name":"North Side"}`,"If-Match",`"1"`),http.StatusOK)
+	if str(branch,"name") != "North Side"{
+		t.Errorf("expected the branch to be renamed, got %v",branch)
+	}
+
+	expect(t,ts.do(http.MethodPut,"/users/" + waiter.User_id + "/branches",admin,`{"branches":["nope"]}`,"If-Match","*"),http.StatusNotFound)
+	user := expect(t,ts.do(http.MethodPut,"/users/" + waiter.User_id + "/branches",admin,`{"branches":["` + ts.branch + `","` + branchId + `"]}`,"If-Match","*"),http.StatusOK)
+	if branches,_ := user["branches"].([]interface{}); len(branches) != 2{
+		t.Errorf("expected the user to work at both branches, got %v",user)
+	}
+}
+
+func TestAuditLogCoversEveryBranch(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	waiter,_ := ts.createUser("waiter@example.com",models.RoleWaiter)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	ts.createTable(manager)
+
+	// the change of the roles is made outside a branch
+	expect(t,ts.do(http.MethodPut,"/users/" + waiter.User_id + "/roles",admin,`{"roles":["cashier"]}`,"If-Match","*"),http.StatusOK)
+
+	log := expect(t,ts.do(http.MethodGet,"/audit",admin,""),http.StatusOK)
+	resources := map[string]string{}
+	for _,item := range log["audit_items"].([]interface{}){
+		entry := item.(map[string]interface{})
+		resources[str(entry,"resource")] = str(entry,"branch_id")
+	}
+	if branchId,ok := resources["user"]; !ok || branchId != ""{
+		t.Errorf("expected the role change without a branch, got %v",log)
+	}
+	if resources["table"] != ts.branch{
+		t.Errorf("expected the table of the branch, got %v",log)
+	}
+
+	scoped := expect(t,ts.do(http.MethodGet,"/audit?branch_id=" + ts.branch,admin,""),http.StatusOK)
+	if scoped["total_count"] != float64(1){
+		t.Errorf("expected the table alone at the branch, got %v",scoped)
+	}
+}
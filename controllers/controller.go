@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"restaurant-backend/mail"
+	"restaurant-backend/repository"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Controller holds the dependencies shared by the request handlers.
+// The repositories are injected so the handlers can run against mongodb
+// in production and against the in-memory store in tests.
+type Controller struct {
+	repos *repository.Repositories
+	// sends the password reset and email verification links
+	mailer mail.Mailer
+	// the address of the app the mailed links point to
+	linkBaseURL string
+	// set once the server is shutting down, see Drain
+	draining int32
+}
+
+// New creates a controller that reads and writes through the given repositories and
+// mails links to pages of the app at linkBaseURL
+func New(repos *repository.Repositories,mailer mail.Mailer,linkBaseURL string) *Controller{
+	return &Controller{repos: repos,mailer: mailer,linkBaseURL: strings.TrimSuffix(linkBaseURL,"/")}
+}
+
+// used to struct field validation
+var validate = validator.New()
+
+// repositoryError answers a failed repository call, turning a missing document into a 404
+func repositoryError(c *gin.Context,err error,msg string){
+	switch {
+	case errors.Is(err,repository.ErrNotFound):
+		c.JSON(http.StatusNotFound,gin.H{"error":msg})
+	case errors.Is(err,repository.ErrDuplicate):
+		c.JSON(http.StatusConflict,gin.H{"error":msg})
+	case errors.Is(err,repository.ErrWrongBranch):
+		c.JSON(http.StatusForbidden,gin.H{"error":"the document belongs to another branch"})
+	case errors.Is(err,repository.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed,gin.H{"error":"the document was changed since it was read, fetch it again"})
+	default:
+		c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+	}
+}
+
+// pagination reads the "recordPerPage", "page" and "startIndex" query parameters
+func pagination(c *gin.Context) repository.ListOptions{
+	// parsing the query parameter "recordPerPage" from the request and convert it to an integer
+	recordPerPage,err := strconv.Atoi(c.Query("recordPerPage"))
+	if err != nil || recordPerPage < 1{
+		// settting the record per page to default of 10 incase of invalid value
+		recordPerPage = 10
+	}
+
+	// parses the query parameter "page" from the request and converts it to an integer
+	page,err := strconv.Atoi(c.Query("page"))
+	// sets the default page to 1 incase of an invalid value
+	if err != nil || page < 1{
+		page = 1
+	}
+
+	// calculating the startIndex for pagination, an explicit "startIndex" wins over the page
+	startIndex := (page-1)*recordPerPage
+	if index,err := strconv.Atoi(c.Query("startIndex")); err == nil && index >= 0{
+		startIndex = index
+	}
+
+	return repository.ListOptions{Skip: int64(startIndex),Limit: int64(recordPerPage)}
+}
+
+// etag turns the version of a document into the value of the ETag header
+func etag(version int64) string{
+	return `"` + strconv.FormatInt(version,10) + `"`
+}
+
+// ifMatch reads the version the caller last saw from the If-Match header. The header is
+// required on updates so that two people editing the same document do not overwrite each
+// other, "*" updates whatever version is stored. It answers the request itself when the
+// header is missing or malformed.
+func ifMatch(c *gin.Context) (int64,bool){
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == ""{
+		c.JSON(http.StatusPreconditionRequired,gin.H{"error":"If-Match header with the ETag of the document is required"})
+		return 0,false
+	}
+	if header == "*"{
+		return 0,true
+	}
+
+	value := strings.Trim(strings.TrimPrefix(header,"W/"),`"`)
+	version,err := strconv.ParseInt(value,10,64)
+	if err != nil || version < 1{
+		c.JSON(http.StatusBadRequest,gin.H{"error":"If-Match header is not an ETag of this API"})
+		return 0,false
+	}
+	return version,true
+}
@@ -0,0 +1,222 @@
+package controllers_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"restaurant-backend/controllers"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/mail"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"restaurant-backend/routes"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testServer is the router main.go builds, on top of the in-memory repositories
+type testServer struct {
+	t          *testing.T
+	repos      *repository.Repositories
+	ctl        *controllers.Controller
+	router     *gin.Engine
+	spool      string
+	branch     string
+}
+
+func newTestServer(t *testing.T) *testServer{
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// a key ring of one Ed25519 key the tokens are signed with
+	keysDir := t.TempDir()
+	_,private,err := ed25519.GenerateKey(rand.Reader)
+	if err != nil{
+		t.Fatal(err)
+	}
+	der,err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keysDir,"test.pem"),pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY",Bytes: der}),0600); err != nil{
+		t.Fatal(err)
+	}
+	if helper.Keys,err = helper.LoadKeyRing(keysDir,""); err != nil{
+		t.Fatal(err)
+	}
+
+	spoolDir := t.TempDir()
+	spool,err := mail.NewSpool(spoolDir,"Restaurant <noreply@example.com>")
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	repos := repository.NewMemory()
+	middleware.RevokedTokens = repos.Revocations
+	middleware.APIKeys = repos.APIKeys
+	middleware.AdminUserIDs = nil
+	middleware.MFARequiredRoles = nil
+	ctl := controllers.New(repos,spool,"http://app.example.com")
+
+	// the routes are registered in the order of main.go
+	router := gin.New()
+	router.Use(middleware.RequestID())
+	routes.HealthRoutes(router,ctl)
+	routes.KeyRoutes(router,ctl)
+	routes.UserRoutes(router,ctl)
+	router.Use(middleware.Authentication())
+	routes.BranchRoutes(router,ctl)
+	routes.RoleRoutes(router,ctl)
+	routes.APIKeyRoutes(router,ctl)
+	routes.AuditRoutes(router,ctl)
+	router.Use(middleware.BranchScope())
+	routes.FoodRoutes(router,ctl)
+	routes.MenuRoutes(router,ctl)
+	routes.TableRoutes(router,ctl)
+	routes.OrderRoutes(router,ctl)
+	routes.InvoiceRoutes(router,ctl)
+	routes.OrderItemRoutes(router,ctl)
+
+	ts := &testServer{t: t,repos: repos,ctl: ctl,router: router,spool: spoolDir}
+	ts.branch = ts.createBranch("Main")
+	return ts
+}
+
+// ctx is a context that sees every branch, for reading and writing the repositories directly
+func (ts *testServer) ctx() context.Context{
+	return repository.AllBranches(context.Background())
+}
+
+func (ts *testServer) createBranch(name string) string{
+	ts.t.Helper()
+	branch := models.Branch{ID: primitive.NewObjectID(),Name: &name,Version: 1}
+	branch.Branch_id = branch.ID.Hex()
+	if err := ts.repos.Branches.Create(ts.ctx(),branch); err != nil{
+		ts.t.Fatal(err)
+	}
+	return branch.Branch_id
+}
+
+// createUser stores a user of the branch of the server with the roles and the password
+// "secret1", and returns it with an access token
+func (ts *testServer) createUser(email string,roles ...string) (models.User,string){
+	ts.t.Helper()
+	hash,err := bcrypt.GenerateFromPassword([]byte("secret1"),bcrypt.MinCost)
+	if err != nil{
+		ts.t.Fatal(err)
+	}
+	first,last,password,phone := "Test","User",string(hash),email + "-phone"
+	user := models.User{
+		ID: primitive.NewObjectID(),
+		First_name: &first,
+		Last_name: &last,
+		Password: &password,
+		Email: &email,
+		Phone: &phone,
+		Version: 1,
+		Branches: []string{ts.branch},
+		Roles: roles,
+	}
+	user.User_id = user.ID.Hex()
+	if err := ts.repos.Users.Create(ts.ctx(),user); err != nil{
+		ts.t.Fatal(err)
+	}
+	return user,ts.token(user)
+}
+
+// token signs an access token for the user the way a login with two-factor authentication does
+func (ts *testServer) token(user models.User) string{
+	ts.t.Helper()
+	token,_,err := helper.GenerateAllTokens(user,helper.NewTokenFamily(),true)
+	if err != nil{
+		ts.t.Fatal(err)
+	}
+	return token
+}
+
+// do sends a request with the token, if any, and the headers given as name and value pairs
+func (ts *testServer) do(method string,path string,token string,body string,headers ...string) *httptest.ResponseRecorder{
+	ts.t.Helper()
+	req := httptest.NewRequest(method,path,strings.NewReader(body))
+	req.Header.Set("Content-Type","application/json")
+	if token != ""{
+		req.Header.Set("Authorization","Bearer " + token)
+	}
+	for i := 0; i+1 < len(headers); i += 2{
+		req.Header.Set(headers[i],headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w,req)
+	return w
+}
+
+// expect fails the test when the response does not have the status and returns its JSON body
+func expect(t *testing.T,w *httptest.ResponseRecorder,status int) map[string]interface{}{
+	t.Helper()
+	if w.Code != status{
+		t.Fatalf("expected status %d, got %d: %s",status,w.Code,w.Body.String())
+	}
+	body := map[string]interface{}{}
+	if w.Body.Len() > 0 && strings.HasPrefix(strings.TrimSpace(w.Body.String()),"{"){
+		if err := json.Unmarshal(w.Body.Bytes(),&body); err != nil{
+			t.Fatalf("response is not JSON: %v: %s",err,w.Body.String())
+		}
+	}
+	return body
+}
+
+// expectList is expect for the responses that are a JSON array
+func expectList(t *testing.T,w *httptest.ResponseRecorder,status int) []map[string]interface{}{
+	t.Helper()
+	if w.Code != status{
+		t.Fatalf("expected status %d, got %d: %s",status,w.Code,w.Body.String())
+	}
+	list := []map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(),&list); err != nil{
+		t.Fatalf("response is not a JSON array: %v: %s",err,w.Body.String())
+	}
+	return list
+}
+
+// str reads a string field of a JSON object
+func str(body map[string]interface{},field string) string{
+	value,_ := body[field].(string)
+	return value
+}
+
+func TestUpdatesNeedIfMatch(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	tableId := ts.createTable(manager)
+	path := "/tables/" + tableId
+
+	expect(t,ts.do(http.MethodPatch,path,manager,`{"number_of_guests":2}`),http.StatusPreconditionRequired)
+	expect(t,ts.do(http.MethodPatch,path,manager,`{"number_of_guests":2}`,"If-Match","yesterday"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,path,manager,`{"number_of_guests":2}`,"If-Match",`"2"`),http.StatusPreconditionFailed)
+
+	w := ts.do(http.MethodPatch,path,manager,`{"number_of_guests":2}`,"If-Match",`W/"1"`)
+	expect(t,w,http.StatusOK)
+	if w.Header().Get("ETag") != `"2"`{
+		t.Errorf("expected the ETag of version 2, got %q",w.Header().Get("ETag"))
+	}
+	// "*" overwrites whatever version is stored
+	table := expect(t,ts.do(http.MethodPatch,path,manager,`{"number_of_guests":3}`,"If-Match","*"),http.StatusOK)
+	if table["version"] != float64(3){
+		t.Errorf("expected version 3, got %v",table)
+	}
+	if w := ts.do(http.MethodGet,path,manager,""); w.Header().Get("ETag") != `"3"`{
+		t.Errorf("expected a read to answer the ETag of version 3, got %q",w.Header().Get("ETag"))
+	}
+}
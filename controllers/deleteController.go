@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deletes are soft: the document gets a deleted_at tombstone and disappears from every
+// list and get, a restore clears the tombstone and a purge removes a tombstoned document for good
+
+// conflictError is returned by a guard when removing the document would leave others pointing at nothing
+type conflictError struct {
+	reason string
+}
+
+func (e conflictError) Error() string {
+	return e.reason
+}
+
+// guard checks whether the document with the given id may be removed
+type guard func(ctx context.Context,id string) error
+
+// removeDocument runs the guard and then the removal in one transaction, answering 409 when
+// the guard refuses, so nothing can start pointing at the document between the two. The
+// removal returns the document before and after so the change can be audited.
+func (ctl *Controller) removeDocument(c *gin.Context,resource string,action string,id string,check guard,remove func(ctx context.Context) (interface{},interface{},error),msg string){
+	var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+	defer cancel()
+
+	var before,result interface{}
+	err := ctl.repos.WithTransaction(ctx,func(ctx context.Context) error{
+		if check != nil{
+			if err := check(ctx,id); err != nil{
+				return err
+			}
+		}
+		var err error
+		before,result,err = remove(ctx)
+		return err
+	})
+	if err != nil{
+		var conflict conflictError
+		if errors.As(err,&conflict){
+			c.JSON(http.StatusConflict,gin.H{"error":conflict.reason})
+			return
+		}
+		repositoryError(c,err,msg)
+		return
+	}
+	ctl.audit(ctx,c,resource,action,id,before,result)
+
+	// a user is answered without its credentials
+	if user,ok := result.(models.User); ok{
+		result = newUserResponse(user)
+	}
+	if result == nil{
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK,result)
+}
+
+// softDelete tombstones the document named by the route parameter
+func softDelete[T any](ctl *Controller,resource string,res repository.Resource[T],param string,check guard) gin.HandlerFunc{
+	return func(c *gin.Context) {
+		id := c.Param(param)
+		ctl.removeDocument(c,resource,"delete",id,check,func(ctx context.Context) (interface{},interface{},error){
+			before,err := res.Get(ctx,id)
+			if err != nil{
+				return nil,nil,err
+			}
+			after,err := res.Delete(ctx,id)
+			return before,after,err
+		},"document was not found")
+	}
+}
+
+// restore brings a soft-deleted document back, the guard refuses while the document it
+// belongs to is still deleted
+func restore[T any](ctl *Controller,resource string,res repository.Resource[T],param string,check guard) gin.HandlerFunc{
+	return func(c *gin.Context) {
+		id := c.Param(param)
+		ctl.removeDocument(c,resource,"restore",id,check,func(ctx context.Context) (interface{},interface{},error){
+			before,err := res.Get(repository.WithDeleted(ctx),id)
+			if err != nil{
+				return nil,nil,err
+			}
+			after,err := res.Restore(ctx,id)
+			return before,after,err
+		},"no deleted document with this id")
+	}
+}
+
+// purge removes a soft-deleted document for good, the guard also sees the deleted documents
+// so nothing that is only tombstoned is left pointing at it
+func purge[T any](ctl *Controller,resource string,res repository.Resource[T],param string,check guard) gin.HandlerFunc{
+	return func(c *gin.Context) {
+		id := c.Param(param)
+		var withDeleted guard
+		if check != nil{
+			withDeleted = func(ctx context.Context,id string) error{
+				return check(repository.WithDeleted(ctx),id)
+			}
+		}
+		ctl.removeDocument(c,resource,"purge",id,withDeleted,func(ctx context.Context) (interface{},interface{},error){
+			before,err := res.Get(repository.WithDeleted(ctx),id)
+			if err != nil{
+				return nil,nil,err
+			}
+			return before,nil,res.Purge(ctx,id)
+		},"no deleted document with this id, delete it before purging")
+	}
+}
+
+// menuInUse refuses to remove a menu that still has foods
+func (ctl *Controller) menuInUse(ctx context.Context,menuId string) error{
+	count,err := ctl.repos.Foods.CountByMenu(ctx,menuId)
+	if err != nil{
+		return err
+	}
+	if count > 0{
+		return conflictError{fmt.Sprintf("menu still has %d foods",count)}
+	}
+	return nil
+}
+
+// foodInUse refuses to purge a food that was ordered, the order items need its name and price.
+// Deleting it is fine, the invoices still find the tombstoned food.
+func (ctl *Controller) foodInUse(ctx context.Context,foodId string) error{
+	count,err := ctl.repos.OrderItems.CountByFood(ctx,foodId)
+	if err != nil{
+		return err
+	}
+	if count > 0{
+		return conflictError{fmt.Sprintf("food is part of %d order items",count)}
+	}
+	return nil
+}
+
+// tableInUse refuses to purge a table that orders were placed at, like foods a table
+// that was taken out can still be deleted
+func (ctl *Controller) tableInUse(ctx context.Context,tableId string) error{
+	orders,err := ctl.repos.Orders.ListByTable(ctx,tableId)
+	if err != nil{
+		return err
+	}
+	if len(orders) > 0{
+		return conflictError{fmt.Sprintf("table has %d orders",len(orders))}
+	}
+	return nil
+}
+
+// orderPaid refuses to remove an order that has a PAID invoice
+func (ctl *Controller) orderPaid(ctx context.Context,orderId string) error{
+	invoices,err := ctl.repos.Invoices.ListByOrder(ctx,orderId)
+	if err != nil{
+		return err
+	}
+	for _,invoice := range invoices{
+		if invoice.Payment_status != nil && *invoice.Payment_status == "PAID"{
+			return conflictError{"order has a PAID invoice"}
+		}
+	}
+	return nil
+}
+
+// orderInUse refuses to purge an order that still has items or invoices
+func (ctl *Controller) orderInUse(ctx context.Context,orderId string) error{
+	items,err := ctl.repos.OrderItems.ListByOrder(ctx,orderId)
+	if err != nil{
+		return err
+	}
+	if len(items) > 0{
+		return conflictError{fmt.Sprintf("order still has %d items",len(items))}
+	}
+	invoices,err := ctl.repos.Invoices.ListByOrder(ctx,orderId)
+	if err != nil{
+		return err
+	}
+	if len(invoices) > 0{
+		return conflictError{fmt.Sprintf("order still has %d invoices",len(invoices))}
+	}
+	return nil
+}
+
+// orderItemPaid refuses to remove an item of an order that was paid
+func (ctl *Controller) orderItemPaid(ctx context.Context,orderItemId string) error{
+	item,err := ctl.repos.OrderItems.Get(ctx,orderItemId)
+	if err != nil{
+		return err
+	}
+	return ctl.orderPaid(ctx,item.Order_id)
+}
+
+// invoicePaid refuses to remove a PAID invoice, it is the record of the payment
+func (ctl *Controller) invoicePaid(ctx context.Context,invoiceId string) error{
+	invoice,err := ctl.repos.Invoices.Get(ctx,invoiceId)
+	if err != nil{
+		return err
+	}
+	if invoice.Payment_status != nil && *invoice.Payment_status == "PAID"{
+		return conflictError{"invoice was paid"}
+	}
+	return nil
+}
+
+// parentDeleted answers the conflict of restoring a document whose parent is still deleted
+func parentDeleted(err error,reason string) error{
+	if errors.Is(err,repository.ErrNotFound){
+		return conflictError{reason}
+	}
+	return err
+}
+
+// menuDeleted refuses to restore a food while its menu is deleted
+func (ctl *Controller) menuDeleted(ctx context.Context,foodId string) error{
+	food,err := ctl.repos.Foods.Get(repository.WithDeleted(ctx),foodId)
+	if err != nil || food.Menu_id == nil{
+		return err
+	}
+	_,err = ctl.repos.Menus.Get(ctx,*food.Menu_id)
+	return parentDeleted(err,"the menu of the food is deleted, restore it first")
+}
+
+// orderDeleted refuses to restore an order item while its order is deleted
+func (ctl *Controller) orderDeleted(ctx context.Context,orderItemId string) error{
+	item,err := ctl.repos.OrderItems.Get(repository.WithDeleted(ctx),orderItemId)
+	if err != nil{
+		return err
+	}
+	_,err = ctl.repos.Orders.Get(ctx,item.Order_id)
+	return parentDeleted(err,"the order of the item is deleted, restore it first")
+}
+
+// invoiceOrderDeleted refuses to restore an invoice while its order is deleted
+func (ctl *Controller) invoiceOrderDeleted(ctx context.Context,invoiceId string) error{
+	invoice,err := ctl.repos.Invoices.Get(repository.WithDeleted(ctx),invoiceId)
+	if err != nil{
+		return err
+	}
+	_,err = ctl.repos.Orders.Get(ctx,invoice.Order_id)
+	return parentDeleted(err,"the order of the invoice is deleted, restore it first")
+}
+
+func (ctl *Controller) DeleteFood() gin.HandlerFunc{
+	return softDelete[models.Food](ctl,"food",ctl.repos.Foods,"food_id",nil)
+}
+
+func (ctl *Controller) RestoreFood() gin.HandlerFunc{
+	return restore[models.Food](ctl,"food",ctl.repos.Foods,"food_id",ctl.menuDeleted)
+}
+
+func (ctl *Controller) PurgeFood() gin.HandlerFunc{
+	return purge[models.Food](ctl,"food",ctl.repos.Foods,"food_id",ctl.foodInUse)
+}
+
+func (ctl *Controller) DeleteMenu() gin.HandlerFunc{
+	return softDelete[models.Menu](ctl,"menu",ctl.repos.Menus,"menu_id",ctl.menuInUse)
+}
+
+func (ctl *Controller) RestoreMenu() gin.HandlerFunc{
+	return restore[models.Menu](ctl,"menu",ctl.repos.Menus,"menu_id",nil)
+}
+
+func (ctl *Controller) PurgeMenu() gin.HandlerFunc{
+	return purge[models.Menu](ctl,"menu",ctl.repos.Menus,"menu_id",ctl.menuInUse)
+}
+
+func (ctl *Controller) DeleteTable() gin.HandlerFunc{
+	return softDelete[models.Table](ctl,"table",ctl.repos.Tables,"table_id",nil)
+}
+
+func (ctl *Controller) RestoreTable() gin.HandlerFunc{
+	return restore[models.Table](ctl,"table",ctl.repos.Tables,"table_id",nil)
+}
+
+func (ctl *Controller) PurgeTable() gin.HandlerFunc{
+	return purge[models.Table](ctl,"table",ctl.repos.Tables,"table_id",ctl.tableInUse)
+}
+
+func (ctl *Controller) DeleteOrder() gin.HandlerFunc{
+	return softDelete[models.Order](ctl,"order",ctl.repos.Orders,"order_id",ctl.orderPaid)
+}
+
+func (ctl *Controller) RestoreOrder() gin.HandlerFunc{
+	return restore[models.Order](ctl,"order",ctl.repos.Orders,"order_id",nil)
+}
+
+func (ctl *Controller) PurgeOrder() gin.HandlerFunc{
+	return purge[models.Order](ctl,"order",ctl.repos.Orders,"order_id",ctl.orderInUse)
+}
+
+func (ctl *Controller) DeleteOrderItem() gin.HandlerFunc{
+	return softDelete[models.OrderItem](ctl,"orderItem",ctl.repos.OrderItems,"orderItem_id",ctl.orderItemPaid)
+}
+
+func (ctl *Controller) RestoreOrderItem() gin.HandlerFunc{
+	return restore[models.OrderItem](ctl,"orderItem",ctl.repos.OrderItems,"orderItem_id",ctl.orderDeleted)
+}
+
+func (ctl *Controller) PurgeOrderItem() gin.HandlerFunc{
+	return purge[models.OrderItem](ctl,"orderItem",ctl.repos.OrderItems,"orderItem_id",ctl.orderItemPaid)
+}
+
+func (ctl *Controller) DeleteInvoice() gin.HandlerFunc{
+	return softDelete[models.Invoice](ctl,"invoice",ctl.repos.Invoices,"invoice_id",ctl.invoicePaid)
+}
+
+func (ctl *Controller) RestoreInvoice() gin.HandlerFunc{
+	return restore[models.Invoice](ctl,"invoice",ctl.repos.Invoices,"invoice_id",ctl.invoiceOrderDeleted)
+}
+
+func (ctl *Controller) PurgeInvoice() gin.HandlerFunc{
+	return purge[models.Invoice](ctl,"invoice",ctl.repos.Invoices,"invoice_id",ctl.invoicePaid)
+}
+
+// DeleteUser refuses to let users delete themselves, nobody would be left to restore the account.
+// The sessions of the user are revoked first, a deleted user keeps no working token.
+func (ctl *Controller) DeleteUser() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		id := c.Param("user_id")
+		if id == c.GetString("uid"){
+			c.JSON(http.StatusConflict,gin.H{"error":"you can not delete your own account"})
+			return
+		}
+		ctl.removeDocument(c,"user","delete",id,nil,func(ctx context.Context) (interface{},interface{},error){
+			before,err := ctl.repos.Users.Get(ctx,id)
+			if err != nil{
+				return nil,nil,err
+			}
+			if err := ctl.revokeSessions(ctx,id); err != nil{
+				return nil,nil,err
+			}
+			after,err := ctl.repos.Users.Delete(ctx,id)
+			return before,after,err
+		},"document was not found")
+	}
+}
+
+func (ctl *Controller) RestoreUser() gin.HandlerFunc{
+	return restore[models.User](ctl,"user",ctl.repos.Users,"user_id",nil)
+}
+
+func (ctl *Controller) PurgeUser() gin.HandlerFunc{
+	return purge[models.User](ctl,"user",ctl.repos.Users,"user_id",nil)
+}
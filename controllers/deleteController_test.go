@@ -0,0 +1,88 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"testing"
+)
+
+func TestDeleteRestoreAndPurge(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	menuId := ts.createMenu(manager)
+	foodId := ts.createFood(manager,menuId,"4.50")
+
+	// a menu with foods is not deleted
+	expect(t,ts.do(http.MethodDelete,"/menus/" + menuId,manager,""),http.StatusConflict)
+
+	// a purge needs a deleted document and an admin
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/purge",admin,""),http.StatusNotFound)
+	deleted := expect(t,ts.do(http.MethodDelete,"/foods/" + foodId,manager,""),http.StatusOK)
+	if deleted["deleted_at"] == nil{
+		t.Errorf("expected the tombstone, got %v",deleted)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods/" + foodId,manager,""),http.StatusNotFound)
+	expect(t,ts.do(http.MethodDelete,"/foods/" + foodId,manager,""),http.StatusNotFound)
+
+	restored := expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/restore",manager,""),http.StatusOK)
+	if _,ok := restored["deleted_at"]; ok{
+		t.Errorf("expected the tombstone to be cleared, got %v",restored)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods/" + foodId,manager,""),http.StatusOK)
+
+	expect(t,ts.do(http.MethodDelete,"/foods/" + foodId,manager,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/purge",manager,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/purge",admin,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/restore",manager,""),http.StatusNotFound)
+
+	// the menu is free once its food is gone
+	expect(t,ts.do(http.MethodDelete,"/menus/" + menuId,manager,""),http.StatusOK)
+}
+
+func TestRestoreNeedsTheParent(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	menuId := ts.createMenu(manager)
+	foodId := ts.createFood(manager,menuId,"4.50")
+
+	expect(t,ts.do(http.MethodDelete,"/foods/" + foodId,manager,""),http.StatusOK)
+	expect(t,ts.do(http.MethodDelete,"/menus/" + menuId,manager,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/restore",manager,""),http.StatusConflict)
+
+	expect(t,ts.do(http.MethodPost,"/menus/" + menuId + "/restore",manager,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/restore",manager,""),http.StatusOK)
+	expect(t,ts.do(http.MethodDelete,"/menus/" + menuId,manager,""),http.StatusConflict)
+}
+
+func TestListedAdmins(t *testing.T){
+	ts := newTestServer(t)
+	owner,token := ts.createUser("owner@example.com")
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	foodId := ts.createFood(manager,ts.createMenu(manager),"4.50")
+	expect(t,ts.do(http.MethodDelete,"/foods/" + foodId,manager,""),http.StatusOK)
+
+	// a user without the admin role counts as an admin once listed in the configuration
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/purge",token,""),http.StatusForbidden)
+	middleware.AdminUserIDs = []string{owner.User_id}
+	expect(t,ts.do(http.MethodPost,"/foods/" + foodId + "/purge",token,""),http.StatusNoContent)
+}
+
+func TestDeleteUserRevokesTheirSessions(t *testing.T){
+	ts := newTestServer(t)
+	admin,adminToken := ts.createUser("admin@example.com",models.RoleAdmin)
+	waiter,waiterToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	expect(t,ts.do(http.MethodDelete,"/users/" + admin.User_id,adminToken,""),http.StatusConflict)
+
+	expect(t,ts.do(http.MethodGet,"/foods",waiterToken,""),http.StatusOK)
+	user := expect(t,ts.do(http.MethodDelete,"/users/" + waiter.User_id,adminToken,""),http.StatusOK)
+	if _,ok := user["password"]; ok{
+		t.Errorf("the password must not be answered, got %v",user)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods",waiterToken,""),http.StatusUnauthorized)
+
+	expect(t,ts.do(http.MethodPost,"/users/" + waiter.User_id + "/restore",adminToken,""),http.StatusOK)
+	expect(t,ts.do(http.MethodGet,"/foods",waiterToken,""),http.StatusUnauthorized)
+}
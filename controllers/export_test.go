@@ -0,0 +1,13 @@
+package controllers
+
+// the unexported helpers the tests of controllers_test call
+var (
+	Backoff = backoff
+	RetryAfter = retryAfter
+	WeakPin = weakPin
+)
+
+const (
+	EmailFreeFailures = emailFreeFailures
+	LoginMaxBackoff = loginMaxBackoff
+)
@@ -3,137 +3,81 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
-	"math"
 	"net/http"
-	"restaurant-backend/database"
 	"restaurant-backend/models"
-	"strconv"
+	"restaurant-backend/money"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // gin.handlerFunc represents a request handler in gin
 // func(ctx *gin.Context) represents an anonymous function that actually handles the request
 // [ctx *gin.Context] represents the actual HTTP request and response
 
-// function that creates a food collection in the database
-var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
-
-// used to struct field validation
-var validate = validator.New()
-
-func GetFoods() gin.HandlerFunc {
+func (ctl *Controller) GetFoods() gin.HandlerFunc {
 	// Handles the actual request of the food items
 	return func(c *gin.Context) {
 		// creates a context with a time out of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-
-		// parsing the query parameter "recordPerPage" from the request and convert it to an integer
-		// the Atoi function converts a string to an integer
-		recordPerPage,err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1{
-			// settting the record per page to default of 10 incase of invalid value
-			recordPerPage = 10
-		}
-
-		// parses the query parameter "page" from the request and converts it to an integer
-		page,err := strconv.Atoi(c.Query("page"))
-		// sets the default page to 1 incase of an invalid value
-		if err != nil || page < 1{
-			page = 1
-		}
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// Defering the cancelation of the context until the function returns
+		defer cancel()
 
-		// calculating the startIndex for pagination
-		// parses the query "startIndex" for the starting index of the paginated result
-		startIndex := (page-1)*recordPerPage
-		startIndex,err = strconv.Atoi(c.Query("startIndex"))
-
-		// Defines a MongoDB aggregation pipeline stage to match all documents
-		matchStage := bson.D{{Key:"$match",Value:bson.D{{}}}}
-		// Defines a mongoDB aggregation pipeline stage for grouping calculating total count and 
-		// pushing data for pagination
-		groupStage := bson.D{
-			{Key:"$group",Value:bson.D{{Key:"_id",Value:"null"}}},
-			{Key:"total_count",Value:bson.D{{Key:"$sum",Value:1}}},
-			{Key:"data",Value:bson.D{{Key:"$push",Value:"$$ROOT"}}},
-		}
-		// Defines a mongoDB aggregation pipeline stage for projecting the result including the total count and
-		// pushing data for pagination
-		projectStage := bson.D{
-			{Key:"$project",Value: bson.D{
-				{Key: "_id",Value: 0},
-				{Key: "total_count",Value: 1},
-				{Key: "food_items",Value: bson.D{{Key: "$slice",Value :[]interface{}{"$data",startIndex,recordPerPage}}}},
-			}},
-		}
+		// reading the page that was asked for from the query parameters
+		opts := pagination(c)
 
-		// performs the mongoDB aggregation using the defined pipeline stages
-		result,err := foodCollection.Aggregate(ctx,mongo.Pipeline{
-			matchStage,groupStage,projectStage,
-		})
+		// retrieving the requested page of foods and the total number of foods
+		foods,total,err := ctl.repos.Foods.List(ctx,opts)
 
-		// Defering the cancelation of the context until the function returns 
-		defer cancel()
-
-		// Returning an internal server error incase the aggregation has failed
+		// Returning an internal server error incase the listing has failed
 		if err != nil {
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occurred while listing food items"})
-		}
-
-		// creates a variable to store all the food result
-		var allFoods []bson.M
-		// retriving all the documents from the aggregation result and logs any errors
-		if err = result.All(ctx,&allFoods); err != nil{
-			log.Fatal(err)
+			return
 		}
 
 		// responds with the paginated food items in JSON format
-		c.JSON(http.StatusOK,allFoods[0])
+		c.JSON(http.StatusOK,gin.H{"total_count":total,"food_items":foods})
 	}
 }
 
-func GetFood() gin.HandlerFunc {
+func (ctl *Controller) GetFood() gin.HandlerFunc {
 	// function to handle the food item
 	return func(c *gin.Context) {
 		// Creates a context with a timeout of 100 seconds
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
+		// Ensures the sorrounding context is closed when the GetFood completes
+		defer cancel()
+
 		// Retrieves the value of the "food_id" parameter from the request
 		foodId := c.Param("food_id")
-		// Create an instance of the "Food" struct from the "models" package
-		var food models.Food
 
-		// Mongodb's "FindOne" method to query for a document with a matching "food_id"
-		// in the "foodCollection". Decode the result into the "food" variable
-		err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food)
-		// Ensures the sorrounding context is closed when the GetFood completes
-		defer cancel()
+		// querying the food repository for the food with a matching "food_id"
+		food, err := ctl.repos.Foods.Get(ctx, foodId)
 
-		// Handles any errors that occurred during the MongoDB query,returns an internal server error incase
+		// Handles any errors that occurred during the query
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the food item"})
+			repositoryError(c, err, "error occured while fetching the food item")
+			return
 		}
 
 		// Error is nil so it  returns the fetched food item as a JSON response
 		// with a status of OK
+		c.Header("ETag", etag(food.Version))
 		c.JSON(http.StatusOK, food)
 	}
 }
 
-func CreateFood() gin.HandlerFunc {
+func (ctl *Controller) CreateFood() gin.HandlerFunc {
 	// function that handles the creation of food request
 	return func(c *gin.Context) {
 		// creating a context with a time out of 100 seconds
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
+		// cancelling the context when the handler returns
+		defer cancel()
 
-		// creating the instances of the food and menu structs
-		var menu models.Menu
+		// creating the instance of the food struct
 		var food models.Food
 
 		// binding the Json data from the Http request body to the food variable
@@ -150,16 +94,23 @@ func CreateFood() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
 			return
 		}
+		if !validPrice(c, food.Price) {
+			return
+		}
+		// the groups and options are given the ids the order items pick them by
+		food.Modifier_groups = withModifierIds(food.Modifier_groups)
+		if err := food.CheckModifierGroups(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Querying the menu collection to find a menu based on food.menu_id is there
-		err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
-		// cancelling the context after the menu querying
-		defer cancel()
+		// Querying the menu repository to find a menu based on food.menu_id is there
+		_, err := ctl.repos.Menus.Get(ctx, *food.Menu_id)
 
 		// Handling the error incase the querying is not successful
 		if err != nil {
 			msg := fmt.Sprint("menu was not found")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			repositoryError(c, err, msg)
 			return
 		}
 
@@ -172,54 +123,90 @@ func CreateFood() gin.HandlerFunc {
 		// the hex function assigns a hexadecimal representation to the generated id
 		food.ID = primitive.NewObjectID()
 		food.Food_id = food.ID.Hex()
+		food.Version = 1
+		// the document belongs to the branch the request works on
+		food.Branch_id = c.GetString("branch_id")
 
-		// Rounding up the food price to two decimal places
-		var num = toFixed(*food.Price, 2)
-		food.Price = &num
-
-		// Inserting the food struct into the food collection
-		result, insertErr := foodCollection.InsertOne(ctx, food)
+		// Inserting the food struct into the food repository
+		insertErr := ctl.repos.Foods.Create(ctx, food)
 		if insertErr != nil {
 			// Error handling incase the insertion has failed
 			msg := fmt.Sprintf("Food item was not created")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
-        // canceling the context after a insertion to the database
-		defer cancel()
 
-		// returning the result of the insertion as the response
-		c.JSON(http.StatusOK, result)
+		// recording the new food in the audit log
+		ctl.audit(ctx, c, "food", "create", food.Food_id, nil, food)
+
+		// returning the created food as the response
+		c.Header("ETag", etag(food.Version))
+		c.JSON(http.StatusOK, food)
 	}
 }
 
-// function that rounds a floating-point number to the nearest integer
-func round(num float64) int {
-	return int(num + math.Copysign(0.5,num))
+// withModifierIds gives the modifier groups and options without an id a new one, the ids
+// sent back with an update are kept so the order items still find their options
+func withModifierIds(groups []models.ModifierGroup) []models.ModifierGroup {
+	for i := range groups {
+		if groups[i].Group_id == "" {
+			groups[i].Group_id = primitive.NewObjectID().Hex()
+		}
+		for j := range groups[i].Options {
+			if groups[i].Options[j].Option_id == "" {
+				groups[i].Options[j].Option_id = primitive.NewObjectID().Hex()
+			}
+		}
+	}
+	return groups
 }
-// function that fixes the number of decimal places for a floating-point number
-func toFixed(num float64, precision int) float64 {
-	output := math.Pow(10,float64(precision))
-	return float64(round(num*output)) / output
+
+// function that refuses negative prices. The price was already rounded to the cents
+// of its currency when the request was read, see the money package
+func validPrice(c *gin.Context, price *money.Money) bool {
+	if price != nil && price.IsNegative(){
+		c.JSON(http.StatusBadRequest,gin.H{"error":"a price can not be negative"})
+		return false
+	}
+	return true
 }
 
-func UpdateFood() gin.HandlerFunc {
+func (ctl *Controller) UpdateFood() gin.HandlerFunc {
 	// function that handles the actual update food request items
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// defering the cancelation of the context until it returns
+		defer cancel()
 
-		// creating instances of menu and food structs
-		var menu models.Menu
+		// creating instances of food struct
 		var food models.Food
 
 		// retrieving the "food_id" from the HTTP request
 		foodId := c.Param("food_id")
 
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
 		// extracting and decoding JSON data from the HTTP request body to the food struct
 		if err := c.BindJSON(&food); err != nil{
-			// returning an internal server error incase the extraction and decoding fails
-			c.JSON(http.StatusInternalServerError,gin.H{"error":err.Error()})
+			// returning a bad request incase the body is not a food
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+		// validating the fields that were sent, the others keep their stored value
+		if validationErr := validate.StructPartial(food,sentFoodFields(food)...); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		// keeping the food as it was for the audit log and to check the modifiers it will have
+		before,err := ctl.repos.Foods.Get(ctx,foodId)
+		if err != nil{
+			repositoryError(c,err,"food item was not found")
 			return
 		}
 
@@ -232,6 +219,9 @@ func UpdateFood() gin.HandlerFunc {
 		}
 
 		// appending the price to the updateObj if it's not null
+		if !validPrice(c,food.Price){
+			return
+		}
 		if food.Price != nil {
 			updateObj = append(updateObj, bson.E{Key: "price",Value: food.Price})
 		}
@@ -243,62 +233,78 @@ func UpdateFood() gin.HandlerFunc {
 
 		// appending the Menu id to the updateObj if it's not null
 		if food.Menu_id != nil {
-			// Quering the database to find the document with the correspoding id
-			err := menuCollection.FindOne(ctx,bson.M{"menu_id":food.Menu_id}).Decode(&menu)
-			// defering the cancelation of the context until it returns
-			defer cancel()
-			// returning an internal error server incase the query operation fails
+			// Quering the menu repository to find the menu with the correspoding id
+			_,err := ctl.repos.Menus.Get(ctx,*food.Menu_id)
+			// returning an error incase the query operation fails
 			if err != nil{
 				msg := fmt.Sprintf("message:Menu was not found")
-				c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+				repositoryError(c,err,msg)
 				return
 			}
 
 			// updating the menu_id
-			//TODO
 			updateObj = append(updateObj, bson.E{Key: "menu_id",Value: food.Menu_id})
 		}
 
+		// the modifier groups are replaced when sent, an empty list removes them. They are
+		// checked against the new price as well, the deltas have to be in its currency.
+		updated := before
+		if food.Price != nil{
+			updated.Price = food.Price
+		}
+		if food.Modifier_groups != nil{
+			// StructPartial does not dive into the groups
+			for _,group := range food.Modifier_groups{
+				if validationErr := validate.Struct(group); validationErr != nil{
+					c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+					return
+				}
+			}
+			updated.Modifier_groups = withModifierIds(food.Modifier_groups)
+			updateObj = append(updateObj, bson.E{Key: "modifier_groups",Value: updated.Modifier_groups})
+		}
+		if err := updated.CheckModifierGroups(); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+
 		// Updating the Updated at time with the current time
 		food.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{Key: "updated_at",Value: food.Updated_at})
 
-		// upsert is the combination of update and insert- used when you 
-		// want to insert or update the document
-		upsert := true
-		// creating a mongoDb filter by creating a map where the key is
-		//  "food_id" and the value is extracted "foodId"
-		filter := bson.M{"food_id":foodId}
-
-		// creating an instance of the options.UpdateOptions struct used
-		// to specify various options
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
-		}
-
-		// updating the item in the database
-		result,err := foodCollection.UpdateOne(
-			// context
-			ctx,
-			// filter the doc to update
-			filter,
-			// using the set operator to set the field in "updateObj"
-			bson.D{
-				{Key: "$set",Value: updateObj},
-			},
-			// passes the options.UpdateOptions to control the update behaviour
-			&opt,
-		)
+		// updating the food with the matching "food_id" in the repository
+		result,err := ctl.repos.Foods.Update(ctx,foodId,version,updateObj)
 
 		// returns internal server error incase the update operation fails
 		if err != nil {
 			msg := fmt.Sprintf("food item update failed")
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+			repositoryError(c,err,msg)
 			return
 		}
-		
-		// returns the result of the operation as a JSON format response
+
+		ctl.audit(ctx,c,"food","update",foodId,before,result)
+
+		// returns the updated food as a JSON format response
+		c.Header("ETag",etag(result.Version))
 		c.JSON(http.StatusOK,result)
 
 	}
 }
+
+// sentFoodFields names the fields of a food update that were sent, for validate.StructPartial
+func sentFoodFields(food models.Food) []string{
+	fields := []string{}
+	if food.Name != nil{
+		fields = append(fields,"Name")
+	}
+	if food.Price != nil{
+		fields = append(fields,"Price")
+	}
+	if food.Food_image != nil{
+		fields = append(fields,"Food_image")
+	}
+	if food.Menu_id != nil{
+		fields = append(fields,"Menu_id")
+	}
+	return fields
+}
@@ -0,0 +1,63 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+// createMenu creates a menu served all day through the API and returns its id
+func (ts *testServer) createMenu(token string) string{
+	ts.t.Helper()
+	menu := expect(ts.t,ts.do(http.MethodPost,"/menus",token,`{"name":"Lunch","category":"main"}`),http.StatusOK)
+	return str(menu,"menu_id")
+}
+
+// createFood creates a food of the menu through the API and returns its id
+func (ts *testServer) createFood(token string,menuId string,price string) string{
+	ts.t.Helper()
+	food := expect(ts.t,ts.do(http.MethodPost,"/foods",token,`{"name":"Soup","price":"` + price + `","food_image":"soup.png","menu_id":"` + menuId + `"}`),http.StatusOK)
+	return str(food,"food_id")
+}
+
+func TestFoodRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	menuId := ts.createMenu(manager)
+
+	// creating
+	expect(t,ts.do(http.MethodPost,"/foods",manager,`{"name":"Soup"}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/foods",manager,`{"name":"Soup","price":"4.50","food_image":"soup.png","menu_id":"nope"}`),http.StatusNotFound)
+	w := ts.do(http.MethodPost,"/foods",manager,`{"name":"Soup","price":"4.50","food_image":"soup.png","menu_id":"` + menuId + `"}`)
+	food := expect(t,w,http.StatusOK)
+	foodId := str(food,"food_id")
+	if w.Header().Get("ETag") != `"1"`{
+		t.Errorf("expected the ETag of version 1, got %q",w.Header().Get("ETag"))
+	}
+	if price := food["price"].(map[string]interface{}); price["amount"] != "4.50" || price["currency"] != "USD"{
+		t.Errorf("unexpected price %v",price)
+	}
+
+	// reading
+	food = expect(t,ts.do(http.MethodGet,"/foods/" + foodId,manager,""),http.StatusOK)
+	if str(food,"name") != "Soup"{
+		t.Errorf("expected the food, got %v",food)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods/nope",manager,""),http.StatusNotFound)
+	list := expect(t,ts.do(http.MethodGet,"/foods",manager,""),http.StatusOK)
+	if list["total_count"] != float64(1){
+		t.Errorf("expected one food, got %v",list)
+	}
+
+	// updating
+	expect(t,ts.do(http.MethodPatch,"/foods/" + foodId,manager,`{"name":"Stew"}`),http.StatusPreconditionRequired)
+	expect(t,ts.do(http.MethodPatch,"/foods/" + foodId,manager,`{"name":`,"If-Match",`"1"`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/foods/" + foodId,manager,`{"name":"S"}`,"If-Match",`"1"`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/foods/" + foodId,manager,`{"price":"-1"}`,"If-Match",`"1"`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/foods/" + foodId,manager,`{"menu_id":"nope"}`,"If-Match",`"1"`),http.StatusNotFound)
+	food = expect(t,ts.do(http.MethodPatch,"/foods/" + foodId,manager,`{"name":"Stew"}`,"If-Match",`"1"`),http.StatusOK)
+	if str(food,"name") != "Stew" || food["version"] != float64(2){
+		t.Errorf("expected version 2 named Stew, got %v",food)
+	}
+	expect(t,ts.do(http.MethodPatch,"/foods/" + foodId,manager,`{"name":"Broth"}`,"If-Match",`"1"`),http.StatusPreconditionFailed)
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"restaurant-backend/database"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dependencyStatus is the state of one dependency in the /readyz response
+type dependencyStatus struct {
+	Status       string   `json:"status"`
+	Latency_ms   int64    `json:"latency_ms"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Healthz answers as long as the process is able to serve requests at all,
+// it does not look at the dependencies so a database outage does not get the process restarted
+func (ctl *Controller) Healthz() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK,gin.H{"status":"ok"})
+	}
+}
+
+// Readyz tells whether the process should get traffic: it pings mongodb and
+// answers 503 when the ping fails or when the server is draining for a shutdown
+func (ctl *Controller) Readyz() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),2*time.Second)
+		defer cancel()
+
+		status,code := "ok",http.StatusOK
+
+		// pinging the database the repositories write to
+		started := time.Now()
+		mongodb := dependencyStatus{Status: "ok"}
+		if err := database.Ping(ctx); err != nil{
+			mongodb.Status = "unavailable"
+			mongodb.Error = err.Error()
+			status,code = "unavailable",http.StatusServiceUnavailable
+		}
+		mongodb.Latency_ms = time.Since(started).Milliseconds()
+
+		if atomic.LoadInt32(&ctl.draining) != 0{
+			status,code = "draining",http.StatusServiceUnavailable
+		}
+
+		c.JSON(code,gin.H{
+			"status":status,
+			"dependencies":gin.H{"mongodb":mongodb},
+		})
+	}
+}
+
+// Drain makes /readyz fail so the orchestrator stops sending traffic while
+// the server finishes the requests already in flight
+func (ctl *Controller) Drain(){
+	atomic.StoreInt32(&ctl.draining,1)
+}
@@ -0,0 +1,28 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthAndReadiness(t *testing.T){
+	ts := newTestServer(t)
+
+	// the process is alive without a database and without a token
+	if body := expect(t,ts.do(http.MethodGet,"/healthz","",""),http.StatusOK); str(body,"status") != "ok"{
+		t.Errorf("expected healthz to be ok, got %v",body)
+	}
+
+	// there is no mongodb behind the in-memory repositories, so the server is not ready
+	body := expect(t,ts.do(http.MethodGet,"/readyz","",""),http.StatusServiceUnavailable)
+	mongodb,_ := body["dependencies"].(map[string]interface{})["mongodb"].(map[string]interface{})
+	if str(body,"status") != "unavailable" || str(mongodb,"status") != "unavailable" || str(mongodb,"error") == ""{
+		t.Errorf("expected mongodb to be reported unavailable, got %v",body)
+	}
+
+	ts.ctl.Drain()
+	if body := expect(t,ts.do(http.MethodGet,"/readyz","",""),http.StatusServiceUnavailable); str(body,"status") != "draining"{
+		t.Errorf("expected a draining server to say so, got %v",body)
+	}
+	expect(t,ts.do(http.MethodGet,"/healthz","",""),http.StatusOK)
+}
@@ -3,17 +3,15 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"restaurant-backend/database"
+	"restaurant-backend/middleware"
 	"restaurant-backend/models"
+	"restaurant-backend/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // gin.HandlerFunc represents a request handler in gin
@@ -32,27 +30,19 @@ type InvoiceViewFormat struct {
 	Order_details     interface{}
 }
 
-// creating a collection od the invoices in the database
-var invoicesCollection *mongo.Collection = database.OpenCollection(database.Client,"invoices")
-
-func GetInvoices() gin.HandlerFunc{
+func (ctl *Controller) GetInvoices() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-		 
-		// Instantiating a query to the database to query all the elements and store them in a bson Map
-		result,err :=  invoicesCollection.Find(context.TODO(),bson.M{})
-		// cancelling all the resources until the function exits 
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancelling all the resources until the function exits
 		defer cancel()
+
+		// querying the repository for all the invoices
+		allInvoices,_,err :=  ctl.repos.Invoices.List(ctx,repository.ListOptions{})
 		if err != nil{
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error while getting all the invoices"})
 			return
 		}
-        // creating a slice variable to store the the extracted data from the database query
-		var allInvoices []bson.M
-		if err := result.All(ctx,&allInvoices); err != nil{
-			log.Fatal(err)
-		}
 
 		// Returning the allInvoices records incase of a success
 		c.JSON(http.StatusOK,allInvoices)
@@ -60,21 +50,19 @@ func GetInvoices() gin.HandlerFunc{
 	}
 }
 
-func GetInvoice() gin.HandlerFunc{
+func (ctl *Controller) GetInvoice() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a context of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
 
-		// creating a instance of the invoice
-		var invoice models.Invoice
 		// Retrieving the "invoice_id" from the request
 		invoiceId := c.Param("invoice_id")
 
-		// querying the data database to match the id invoice and decode the data form the request into the invoice variable
-		err := invoicesCollection.FindOne(ctx,bson.M{"invoice_id":invoiceId}).Decode(&invoice)
-		defer cancel()
+		// querying the repository for the invoice with the matching id
+		invoice,err := ctl.repos.Invoices.Get(ctx,invoiceId)
 		if err != nil{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"error when getting the invoice item"})
+			repositoryError(c,err,"error when getting the invoice item")
 			return
 		}
 
@@ -83,11 +71,12 @@ func GetInvoice() gin.HandlerFunc{
 
 		// Retrieving order items by calling the ItemByOrder function
 		// to retrieve order items based on the invoice's order ID
-		allOrderItem,err := ItemByOrder(invoice.Order_id)
+		allOrderItem,err := ctl.ItemByOrder(ctx,invoice.Order_id)
 		if err != nil{
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
 		}
-		
+
 		// populating the fields of 'invoiceView' with data from the retrieved invoice
 		// and invoice and order items
 		invoiceView.Order_id = invoice.Order_id
@@ -95,23 +84,29 @@ func GetInvoice() gin.HandlerFunc{
 
 		invoiceView.Payment_method = "null"
 		if invoice.Payment_method != nil{
-			invoice.Payment_method = *&invoice.Payment_method
+			invoiceView.Payment_method = *invoice.Payment_method
 		}
 		invoiceView.Invoice_id = invoice.Invoice_id
-		invoiceView.Payment_status = *&invoice.Payment_status
-		invoiceView.Payment_due = allOrderItem[0]["payment_due"]
-		invoiceView.Table_number = allOrderItem[0]["table_number"]
-		invoiceView.Order_details = allOrderItem[0]["order_item"]
+		invoiceView.Payment_status = invoice.Payment_status
+		if len(allOrderItem) > 0{
+			invoiceView.Payment_due = allOrderItem[0]["payment_due"]
+			invoiceView.Table_number = allOrderItem[0]["table_number"]
+			invoiceView.Order_details = allOrderItem[0]["order_items"]
+		}
 
 		// returning JSON response with the constructed invoiceView
+		c.Header("ETag",etag(invoice.Version))
 		c.JSON(http.StatusOK,invoiceView)
 	}
 }
 
-func CreateInvoice() gin.HandlerFunc{
+func (ctl *Controller) CreateInvoice() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancelling the resources until the function returns
+		defer cancel()
+
 		// creating an instance of the invoice struct
 		var invoice models.Invoice
 
@@ -120,34 +115,39 @@ func CreateInvoice() gin.HandlerFunc{
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
 			return
 		}
-        // creating the instance of the order struct
-		var order models.Order
-		// quering the database to find the document with id -> order_id
-		err := orderCollection.FindOne(ctx,bson.M{"order_id":invoice.Order_id}).Decode(&order)
-		// cancelling the resources until the function returns
-		defer cancel()
 
+		// quering the repository to find the order with id -> order_id
+		_,err := ctl.repos.Orders.Get(ctx,invoice.Order_id)
 		if err != nil{
 			msg := fmt.Sprintf("message: Order was not found")
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+			repositoryError(c,err,msg)
 			return
 		}
 
-		// declaring the status variable and setting it as the state incase the 
+		// declaring the status variable and setting it as the state incase the
 		// payment status is equal to nil -> success
 		status := "PENDING"
 		if invoice.Payment_status == nil{
 			invoice.Payment_status = &status
 		}
 
+		// only the roles allowed to take payments may open an invoice that is already paid
+		if *invoice.Payment_status != status && !middleware.Can(c,middleware.InvoicePay){
+			c.JSON(http.StatusForbidden,gin.H{"error":"your role does not allow changing the payment status"})
+			return
+		}
+
 		// updating the time stamps wiht the current time
 		invoice.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		invoice.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		invoice.Payment_due_date,_ = time.Parse(time.RFC3339,time.Now().AddDate(0,0,1).Format(time.RFC3339))
-		
+
 		// initalizing the id of the invoice struct and giving it the hexadecimal representation
 		invoice.ID = primitive.NewObjectID()
 		invoice.Invoice_id =invoice.ID.Hex()
+		invoice.Version = 1
+		// the document belongs to the branch the request works on
+		invoice.Branch_id = c.GetString("branch_id")
 
 		// validating the invoice struct to check whether the data received is in the right format
 		validationErr := validate.Struct(invoice)
@@ -156,41 +156,61 @@ func CreateInvoice() gin.HandlerFunc{
 			return
 		}
 
-		// Database operation to insert the data binded into the invoice struct
+		// inserting the invoice into the repository
 		// and handling the error incase the invoice was not created
-		result,insertError := invoicesCollection.InsertOne(ctx,invoice)
+		insertError := ctl.repos.Invoices.Create(ctx,invoice)
 		if insertError != nil{
 			msg := fmt.Sprintf("invoice item was not created")
 			c.JSON(http.StatusBadRequest,gin.H{"error":msg})
 			return
-		} 
-        // cancelling all the resources until the function returns
-		defer cancel()
-		// returning a JSON response of the inserted data to the database
-		c.JSON(http.StatusOK,result)
+		}
+		ctl.audit(ctx,c,"invoice","create",invoice.Invoice_id,nil,invoice)
+
+		// returning a JSON response of the created invoice
+		c.Header("ETag",etag(invoice.Version))
+		c.JSON(http.StatusOK,invoice)
 
 	}
 }
 
-func UpdateInvoice() gin.HandlerFunc{
+func (ctl *Controller) UpdateInvoice() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a context of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// deffering the cancellation of the context until the function exits
+		defer cancel()
 
 		// creatingg an instance of th invoice
 		var invoice models.Invoice
 		// Retrieving the id parameter from the request which matched id "invoice_id"
 		invoiceId := c.Param("invoice_id")
 
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
 		// Extracting and decoding the data from the request to the invoice struct
 		if err := c.BindJSON(&invoice); err != nil {
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
 			return
 		}
 
-		// creating a filter using the invoice id
-		filter := bson.M{"invoice_id":invoiceId}
-		// creatinga variable to store any updated data 
+		// validating the fields that were sent, the others keep their stored value
+		if validationErr := validate.StructPartial(invoice,sentInvoiceFields(invoice)...); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		// keeping the invoice as it was for the audit log
+		before,err := ctl.repos.Invoices.Get(ctx,invoiceId)
+		if err != nil{
+			repositoryError(c,err,"invoice was not found")
+			return
+		}
+
+		// creatinga variable to store any updated data
 		var updateObj primitive.D
 
 		// appending the payment_method to the updateObj variable
@@ -198,7 +218,12 @@ func UpdateInvoice() gin.HandlerFunc{
 			updateObj = append(updateObj, bson.E{Key: "payment_method",Value: invoice.Payment_method})
 		}
 
-        // appending the payment status to the updateObj variable
+        // appending the payment status to the updateObj variable,
+		// only the roles allowed to take payments may change it
+		if invoice.Payment_status != nil && !middleware.Can(c,middleware.InvoicePay){
+			c.JSON(http.StatusForbidden,gin.H{"error":"your role does not allow changing the payment status"})
+			return
+		}
 		if invoice.Payment_status != nil{
 			updateObj = append(updateObj, bson.E{Key: "payment_status",Value: invoice.Payment_status})
 		}
@@ -207,41 +232,32 @@ func UpdateInvoice() gin.HandlerFunc{
 		invoice.Updated_at,_=time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{Key :"updated_at", Value: invoice.Updated_at})
 
-		// combination of the update and insert options
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
-		}
-
-		// declaring the status variable and setting it as the state incase the 
-		// payment status is equal to nil -> success
-		status := "PENDING"
-		if invoice.Payment_status == nil{
-			invoice.Payment_status = &status
-		}
-
-		// using the aggregate function set to update the updateObj variable
-		result,err := invoicesCollection.UpdateOne(
-			// context
-			ctx,
-			// specifies the document to update
-			filter,
-			bson.D{
-				{Key: "$set",Value: updateObj},
-			},
-			&opt,
-		)
+		// updating the invoice with the matching "invoice_id"
+		result,err := ctl.repos.Invoices.Update(ctx,invoiceId,version,updateObj)
 
 		if err != nil{
 			msg := fmt.Sprintf("Invoice item update failed")
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+			repositoryError(c,err,msg)
 			return
 		}
- 
-		// deffering the cancellation of the context until the function exits
-		defer cancel()
-		// returns a JSON response with the result of the operation
+
+		ctl.audit(ctx,c,"invoice","update",invoiceId,before,result)
+
+		// returns a JSON response with the updated invoice
+		c.Header("ETag",etag(result.Version))
 		c.JSON(http.StatusOK,result)
-		
+
+	}
+}
+
+// sentInvoiceFields names the fields of an invoice update that were sent, for validate.StructPartial
+func sentInvoiceFields(invoice models.Invoice) []string{
+	fields := []string{}
+	if invoice.Payment_method != nil{
+		fields = append(fields,"Payment_method")
+	}
+	if invoice.Payment_status != nil{
+		fields = append(fields,"Payment_status")
 	}
-}
\ No newline at end of file
+	return fields
+}
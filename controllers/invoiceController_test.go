@@ -0,0 +1,49 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+func TestInvoiceRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,cashier := ts.createUser("cashier@example.com",models.RoleCashier)
+	_,waiter := ts.createUser("waiter@example.com",models.RoleWaiter)
+	menuId := ts.createMenu(manager)
+	soup := ts.createFood(manager,menuId,"4.50")
+	tableId := ts.createTable(manager)
+	items := expectList(t,ts.do(http.MethodPost,"/orderItems",waiter,`{"table_id":"` + tableId + `","order_items":[{"food_id":"` + soup + `"}]}`),http.StatusOK)
+	orderId := str(items[0],"order_id")
+
+	expect(t,ts.do(http.MethodPost,"/invoices",cashier,`{"order_id":"nope","payment_status":"PENDING"}`),http.StatusNotFound)
+	expect(t,ts.do(http.MethodPost,"/invoices",cashier,`{"order_id":"` + orderId + `","payment_status":"LATER"}`),http.StatusBadRequest)
+	invoice := expect(t,ts.do(http.MethodPost,"/invoices",cashier,`{"order_id":"` + orderId + `","payment_status":"PENDING","payment_method":"CARD"}`),http.StatusOK)
+	invoiceId := str(invoice,"invoice_id")
+
+	// the view keeps the field names it always had
+	view := expect(t,ts.do(http.MethodGet,"/invoices/" + invoiceId,cashier,""),http.StatusOK)
+	if due,_ := view["Payment_due"].(map[string]interface{}); due["amount"] != "4.50"{
+		t.Errorf("expected 4.50 due, got %v",view)
+	}
+	if view["Table_number"] != float64(7) || str(view,"Payment_method") != "CARD"{
+		t.Errorf("unexpected invoice %v",view)
+	}
+	expect(t,ts.do(http.MethodGet,"/invoices/nope",cashier,""),http.StatusNotFound)
+	if invoices := expectList(t,ts.do(http.MethodGet,"/invoices",cashier,""),http.StatusOK); len(invoices) != 1{
+		t.Errorf("expected one invoice, got %v",invoices)
+	}
+
+	// the sent fields are checked, the invoice has to exist
+	expect(t,ts.do(http.MethodPatch,"/invoices/" + invoiceId,cashier,`{"payment_status":"LATER"}`,"If-Match",`"1"`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/invoices/" + invoiceId,cashier,`{"payment_method":"CHEQUE"}`,"If-Match",`"1"`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/invoices/nope",cashier,`{"payment_method":"CASH"}`,"If-Match",`"1"`),http.StatusNotFound)
+
+	// only the roles taking payments mark an invoice paid
+	expect(t,ts.do(http.MethodPatch,"/invoices/" + invoiceId,waiter,`{"payment_status":"PAID"}`,"If-Match",`"1"`),http.StatusForbidden)
+	invoice = expect(t,ts.do(http.MethodPatch,"/invoices/" + invoiceId,cashier,`{"payment_status":"PAID"}`,"If-Match",`"1"`),http.StatusOK)
+	if str(invoice,"payment_status") != "PAID"{
+		t.Errorf("expected the invoice to be paid, got %v",invoice)
+	}
+}
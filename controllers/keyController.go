@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"net/http"
+	helper "restaurant-backend/helpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Jwks publishes the public keys the tokens are verified with, so other applications can
+// check a token without holding a private key. A key that is rotated out stays listed
+// until the tokens it signed have expired.
+func (ctl *Controller) Jwks() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		// clients look the keys up again when they see an unknown kid, a short cache is enough
+		c.Header("Cache-Control","public, max-age=300")
+		c.JSON(http.StatusOK,gin.H{"keys":helper.Keys.JWKS()})
+	}
+}
@@ -0,0 +1,110 @@
+package controllers_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/models"
+	"testing"
+)
+
+// writeKey writes a new Ed25519 key to dir/kid.pem, only its public half when retired
+func writeKey(t *testing.T,dir string,kid string,retired bool) ed25519.PublicKey{
+	t.Helper()
+	public,private,err := ed25519.GenerateKey(rand.Reader)
+	if err != nil{
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	if retired{
+		block.Type = "PUBLIC KEY"
+		block.Bytes,err = x509.MarshalPKIXPublicKey(public)
+	} else{
+		block.Bytes,err = x509.MarshalPKCS8PrivateKey(private)
+	}
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir,kid + ".pem"),pem.EncodeToMemory(block),0600); err != nil{
+		t.Fatal(err)
+	}
+	return public
+}
+
+func TestJwks(t *testing.T){
+	ts := newTestServer(t)
+	dir := t.TempDir()
+	current := writeKey(t,dir,"2026-10",false)
+	writeKey(t,dir,"2026-04",true)
+	var err error
+	if helper.Keys,err = helper.LoadKeyRing(dir,""); err != nil{
+		t.Fatal(err)
+	}
+
+	w := ts.do(http.MethodGet,"/.well-known/jwks.json","","")
+	body := expect(t,w,http.StatusOK)
+	if w.Header().Get("Cache-Control") == ""{
+		t.Error("expected the key set to be cacheable")
+	}
+	keys,_ := body["keys"].([]interface{})
+	if len(keys) != 2{
+		t.Fatalf("expected the signing and the retired key, got %v",body)
+	}
+	newest,_ := keys[1].(map[string]interface{})
+	if str(newest,"kid") != "2026-10" || str(newest,"kty") != "OKP" || str(newest,"alg") != "EdDSA" || str(newest,"x") != base64.RawURLEncoding.EncodeToString(current){
+		t.Errorf("expected the signing key as an OKP key, got %v",newest)
+	}
+	for _,key := range keys{
+		if _,ok := key.(map[string]interface{})["d"]; ok{
+			t.Errorf("a private key was published: %v",key)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T){
+	ts := newTestServer(t)
+	user,oldToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	// the key of newTestServer is retired: only its public half stays on the new ring
+	dir := t.TempDir()
+	writeKey(t,dir,"next",false)
+	old := helper.Keys.JWKS()[0]
+	public,err := base64.RawURLEncoding.DecodeString(old.X)
+	if err != nil{
+		t.Fatal(err)
+	}
+	der,err := x509.MarshalPKIXPublicKey(ed25519.PublicKey(public))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir,old.Kid + ".pem"),pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY",Bytes: der}),0600); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := helper.LoadKeyRing(dir,old.Kid); err == nil{
+		t.Error("a retired key can not sign")
+	}
+	if helper.Keys,err = helper.LoadKeyRing(dir,""); err != nil{
+		t.Fatal(err)
+	}
+
+	expect(t,ts.do(http.MethodGet,"/foods",oldToken,""),http.StatusOK)
+	expect(t,ts.do(http.MethodGet,"/foods",ts.token(user),""),http.StatusOK)
+	if helper.Keys.SigningKid() != "next"{
+		t.Errorf("expected new tokens to be signed with the new key, got %q",helper.Keys.SigningKid())
+	}
+
+	// once the retired key is removed the tokens it signed are refused
+	if err := os.Remove(filepath.Join(dir,old.Kid + ".pem")); err != nil{
+		t.Fatal(err)
+	}
+	if helper.Keys,err = helper.LoadKeyRing(dir,""); err != nil{
+		t.Fatal(err)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods",oldToken,""),http.StatusUnauthorized)
+}
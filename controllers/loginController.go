@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// the brute-force protection of Login. Failed logins are counted per email and per
+// client ip; past a few failures every further attempt has to wait twice as long as
+// the one before, and an email that keeps failing is locked until an admin unlocks it
+// or the lockout runs out.
+const (
+	// the failures of an email or an ip are forgotten after this long without one
+	loginFailureWindow = 15*time.Minute
+	// the failures of an email let through before the backoff starts
+	emailFreeFailures = 3
+	// every device of a restaurant may share one ip behind its router, so an ip gets more
+	ipFreeFailures = 20
+	// the backoff doubles from one second up to this
+	loginMaxBackoff = 5*time.Minute
+	// an email is locked after this many failures in a row
+	loginLockoutFailures = 10
+	loginLockoutDuration = 30*time.Minute
+	// how long the attempts are kept for the history of the users
+	loginHistoryLifetime = 90*24*time.Hour
+)
+
+// the reasons a login attempt failed, see models.LoginAttempt
+const (
+	loginWrongPassword = "wrong_password"
+	loginUnknownEmail = "unknown_email"
+	loginWrongCode = "wrong_mfa_code"
+)
+
+// loginRequest is the body of Login
+type loginRequest struct {
+	Email      *string   `json:"email" validate:"required"`
+	Password   *string   `json:"password" validate:"required"`
+}
+
+func emailKey(email string) string{
+	return "email:" + strings.ToLower(email)
+}
+
+func ipKey(ip string) string{
+	return "ip:" + ip
+}
+
+// backoff is how long to wait after the last failure once there were failures in a row
+func backoff(failures int64,free int64) time.Duration{
+	if failures < free{
+		return 0
+	}
+	// shifting further would only overflow, the cap is reached long before
+	if failures-free >= 20{
+		return loginMaxBackoff
+	}
+	wait := time.Second << uint(failures-free)
+	if wait > loginMaxBackoff{
+		return loginMaxBackoff
+	}
+	return wait
+}
+
+// retryAfter is how long the key has to wait before its next attempt
+func retryAfter(throttle models.LoginThrottle,free int64,now time.Time) time.Duration{
+	if throttle.Locked_until != nil && throttle.Locked_until.After(now){
+		return throttle.Locked_until.Sub(now)
+	}
+	if throttle.Failures == 0{
+		return 0
+	}
+	next := throttle.Last_failure_at.Add(backoff(throttle.Failures,free))
+	if next.After(now){
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// tooManyAttempts answers 429 with the seconds to wait in Retry-After
+func tooManyAttempts(c *gin.Context,wait time.Duration,msg string){
+	c.Header("Retry-After",strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests,gin.H{"error":msg})
+}
+
+// checkThrottles answers 429 when the email or the ip of the request has to wait
+func (ctl *Controller) checkThrottles(ctx context.Context,c *gin.Context,email string,now time.Time) bool{
+	return ctl.checkThrottleKeys(ctx,c,emailKey(email),emailFreeFailures,ipKey(c.ClientIP()),ipFreeFailures,now)
+}
+
+// checkThrottleKeys answers 429 when the account, an email or the PIN of a user, is locked or
+// when the account or the source of the attempt, an ip or a terminal, has to wait
+func (ctl *Controller) checkThrottleKeys(ctx context.Context,c *gin.Context,accountKey string,accountFree int64,sourceKey string,sourceFree int64,now time.Time) bool{
+	accountThrottle,err := ctl.repos.Logins.Throttle(ctx,accountKey,now)
+	if err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking the login attempts"})
+		return false
+	}
+	sourceThrottle,err := ctl.repos.Logins.Throttle(ctx,sourceKey,now)
+	if err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking the login attempts"})
+		return false
+	}
+
+	if accountThrottle.Locked_until != nil && accountThrottle.Locked_until.After(now){
+		tooManyAttempts(c,accountThrottle.Locked_until.Sub(now),"the account is locked after too many failed logins, try again later or ask an admin to unlock it")
+		return false
+	}
+	wait := retryAfter(accountThrottle,accountFree,now)
+	if sourceWait := retryAfter(sourceThrottle,sourceFree,now); sourceWait > wait{
+		wait = sourceWait
+	}
+	if wait > 0{
+		tooManyAttempts(c,wait,"too many failed logins, wait before trying again")
+		return false
+	}
+	return true
+}
+
+// loginFailed counts a failed login against the email and the ip and locks the email once it failed too often
+func (ctl *Controller) loginFailed(ctx context.Context,c *gin.Context,email string,now time.Time) error{
+	return ctl.failThrottleKeys(ctx,emailKey(email),ipKey(c.ClientIP()),loginLockoutFailures,now)
+}
+
+// failThrottleKeys counts a failure against the account and the source and locks the account
+// once it failed lockoutFailures times in a row
+func (ctl *Controller) failThrottleKeys(ctx context.Context,accountKey string,sourceKey string,lockoutFailures int64,now time.Time) error{
+	accountThrottle,err := ctl.repos.Logins.Fail(ctx,accountKey,now,loginFailureWindow)
+	if err != nil{
+		return err
+	}
+	if _,err := ctl.repos.Logins.Fail(ctx,sourceKey,now,loginFailureWindow); err != nil{
+		return err
+	}
+	if accountThrottle.Failures >= lockoutFailures{
+		return ctl.repos.Logins.Lock(ctx,accountKey,now.Add(loginLockoutDuration))
+	}
+	return nil
+}
+
+// recordLogin adds the attempt to the login history, a failure to write it does not fail the login
+func (ctl *Controller) recordLogin(ctx context.Context,c *gin.Context,email string,userId string,reason string,now time.Time){
+	attempt := models.LoginAttempt{
+		ID: primitive.NewObjectID(),
+		Email: email,
+		User_id: userId,
+		Ip: c.ClientIP(),
+		User_agent: c.Request.UserAgent(),
+		Success: reason == "",
+		Reason: reason,
+		Terminal_id: c.GetString("api_key_id"),
+		Created_at: now,
+		Expires_at: now.Add(loginHistoryLifetime),
+	}
+	if err := ctl.repos.Logins.Record(ctx,attempt); err != nil{
+		log.Printf("recording the login of %s: %v",email,err)
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash []byte
+)
+
+// compareDummyHash takes as long as checking a real password, so an unknown email can not be
+// told from a wrong password by the time the answer takes
+func compareDummyHash(password string){
+	dummyHashOnce.Do(func(){
+		dummyHash,_ = bcrypt.GenerateFromPassword([]byte("not a password"),14)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash,[]byte(password))
+}
+
+// GetLoginHistory lists the login attempts on the account of a user, newest first.
+// Users see their own attempts, admins those of everybody.
+func (ctl *Controller) GetLoginHistory() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if userId != c.GetString("uid") && !middleware.IsAdmin(c){
+			c.JSON(http.StatusForbidden,gin.H{"error":"only the user and the admins can see the logins of a user"})
+			return
+		}
+
+		attempts,total,err := ctl.repos.Logins.History(ctx,userId,pagination(c))
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing the login attempts"})
+			return
+		}
+
+		c.JSON(http.StatusOK,gin.H{"total_count":total,"login_attempts":attempts})
+	}
+}
+
+// UnlockUser lifts the lockout of the email and the PIN of a user and forgets their failed logins
+func (ctl *Controller) UnlockUser() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		user,err := ctl.repos.Users.Get(ctx,userId)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		keys := []string{pinKey(userId)}
+		if user.Email != nil{
+			keys = append(keys,emailKey(*user.Email))
+		}
+		for _,key := range keys{
+			if err := ctl.repos.Logins.Clear(ctx,key); err != nil{
+				c.JSON(http.StatusInternalServerError,gin.H{"error":"user could not be unlocked"})
+				return
+			}
+		}
+
+		ctl.audit(ctx,c,"user","unlock",userId,nil,nil)
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,96 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/controllers"
+	"restaurant-backend/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T){
+	free := int64(controllers.EmailFreeFailures)
+	cases := map[int64]time.Duration{
+		0: 0,
+		free - 1: 0,
+		free: time.Second,
+		free + 1: 2*time.Second,
+		free + 4: 16*time.Second,
+		free + 9: controllers.LoginMaxBackoff,
+		free + 100: controllers.LoginMaxBackoff,
+	}
+	for failures,want := range cases{
+		if got := controllers.Backoff(failures,free); got != want{
+			t.Errorf("backoff after %d failures = %v, want %v",failures,got,want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T){
+	now := time.Date(2026,10,18,12,0,0,0,time.UTC)
+	free := int64(controllers.EmailFreeFailures)
+
+	if wait := controllers.RetryAfter(models.LoginThrottle{},free,now); wait != 0{
+		t.Errorf("no failures should not wait, got %v",wait)
+	}
+	recent := models.LoginThrottle{Failures: free + 1,Last_failure_at: now.Add(-500*time.Millisecond)}
+	if wait := controllers.RetryAfter(recent,free,now); wait != 1500*time.Millisecond{
+		t.Errorf("expected to wait the rest of two seconds, got %v",wait)
+	}
+	recent.Last_failure_at = now.Add(-time.Minute)
+	if wait := controllers.RetryAfter(recent,free,now); wait != 0{
+		t.Errorf("the backoff ran out, got %v",wait)
+	}
+	until := now.Add(10*time.Minute)
+	locked := models.LoginThrottle{Failures: 1,Last_failure_at: now,Locked_until: &until}
+	if wait := controllers.RetryAfter(locked,free,now); wait != 10*time.Minute{
+		t.Errorf("a locked account waits for the lockout, got %v",wait)
+	}
+}
+
+func TestLoginThrottle(t *testing.T){
+	ts := newTestServer(t)
+	user,_ := ts.createUser("waiter@example.com",models.RoleWaiter)
+	wrong := `{"email":"waiter@example.com","password":"wrong"}`
+
+	for i := 0; i < controllers.EmailFreeFailures; i++{
+		expect(t,ts.do(http.MethodPost,"/users/login","",wrong),http.StatusUnauthorized)
+	}
+	// past the free failures even the right password has to wait
+	w := ts.do(http.MethodPost,"/users/login","",`{"email":"waiter@example.com","password":"secret1"}`)
+	expect(t,w,http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") != "1"{
+		t.Errorf("expected to be told to retry after a second, got %q",w.Header().Get("Retry-After"))
+	}
+
+	// the failures are in the history of the user
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	history := expect(t,ts.do(http.MethodGet,"/users/" + user.User_id + "/logins",admin,""),http.StatusOK)
+	if history["total_count"] != float64(controllers.EmailFreeFailures){
+		t.Errorf("expected the failed logins in the history, got %v",history)
+	}
+}
+
+func TestLockout(t *testing.T){
+	ts := newTestServer(t)
+	user,userToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+
+	// the failures that lead to a lockout
+	if _,err := ts.repos.Logins.Fail(ts.ctx(),"email:waiter@example.com",time.Now(),15*time.Minute); err != nil{
+		t.Fatal(err)
+	}
+	if err := ts.repos.Logins.Lock(ts.ctx(),"email:waiter@example.com",time.Now().Add(30*time.Minute)); err != nil{
+		t.Fatal(err)
+	}
+	w := ts.do(http.MethodPost,"/users/login","",`{"email":"Waiter@example.com","password":"secret1"}`)
+	body := expect(t,w,http.StatusTooManyRequests)
+	if !strings.Contains(str(body,"error"),"locked") || w.Header().Get("Retry-After") == ""{
+		t.Errorf("expected the account to be locked, got %v",body)
+	}
+
+	expect(t,ts.do(http.MethodPost,"/users/" + user.User_id + "/unlock",userToken,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/users/" + user.User_id + "/unlock",admin,""),http.StatusNoContent)
+	ts.login("waiter@example.com")
+}
@@ -3,51 +3,36 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"restaurant-backend/database"
 	"restaurant-backend/models"
+	"restaurant-backend/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // gin.Handler/func represent a request handler in gin
 // func(ctx *gin.Context) represents the actual request handler for the routes
 // [ctx *gin.Context] represents the actual parameters for the current HTTP request and response
 
-// opens a MongoDb collection specified by the name menu
-var menuCollection *mongo.Collection = database.OpenCollection(database.Client,"menu")
-
-func GetMenus() gin.HandlerFunc{
+func (ctl *Controller) GetMenus() gin.HandlerFunc{
 	// Handler function for getting the menu items
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-		
-		// Finding all the documents in the menuCollection.
-		// bson.M{} is an empty filter indicating that all documents should be retrieved
-		result,err :=  menuCollection.Find(context.TODO(),bson.M{})
-
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
 		// Ensures that the sorrounding context is closed when the GetMenus completes
 		defer cancel()
 
-		// Checks if an error occured during the mongodb operation. If there's the error returns a json
+		// Finding all the menus in the menu repository
+		allMenus,_,err :=  ctl.repos.Menus.List(ctx,repository.ListOptions{})
+
+		// Checks if an error occured during the operation. If there's the error returns a json
 		// and function exits
 		if err != nil {
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing the menu item"})
-		}
-
-		// Declaring a slice to store the retrieved menu items
-		var allMenus []bson.M
-
-		// Extract all documents,from the mongodb result into the  "allmenu" slice
-		if err = result.All(ctx,&allMenus); err != nil {
-			log.Fatal(err)
+			return
 		}
 
 		// If everything is successful, the retrieved menu items are returned as a JSON response
@@ -55,46 +40,47 @@ func GetMenus() gin.HandlerFunc{
 	}
 }
 
-func GetMenu() gin.HandlerFunc{
+func (ctl *Controller) GetMenu() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a time out of 100 seconds
-		var ctx, cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancel the context after the database operation
+		defer cancel()
 
-		// create a menu instance
-		var menu models.Menu
 		// retrieving the value of the menu id from the http request
 		menuId := c.Param("menu_id")
 
-		// Querying the database to check if there is a document with the 
+		// Querying the repository to check if there is a menu with the
 		// corresponding ID
-		err := foodCollection.FindOne(ctx,bson.M{"menu_id":menuId}).Decode(&menu)
-
-		// cancel the context after the database operation
-		defer cancel()
+		menu,err := ctl.repos.Menus.Get(ctx,menuId)
 
 		// handle the error
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error":"error occured while fetching the menu"})
+			repositoryError(c,err,"error occured while fetching the menu")
 			return
 		}
 
 		// if the operation is successful
+		c.Header("ETag",etag(menu.Version))
 		c.JSON(http.StatusOK,menu)
 
 	}
 }
 
-func CreateMenu() gin.HandlerFunc{
+func (ctl *Controller) CreateMenu() gin.HandlerFunc{
 	return func(c *gin.Context) {
         // creating an instance of the menu struct
 		var menu models.Menu
 
 		// creating a context with a time out of 100 seconds
-		var ctx, cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancel the context resources and deadlines
+		defer cancel()
 
 		// used to extract and decode JSON data from a HTTP request body to the menu struct
 		if err := c.BindJSON(&menu); err != nil {
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
 		}
 
 		// validating the data input in the menu whether it's in the right order and format
@@ -104,6 +90,11 @@ func CreateMenu() gin.HandlerFunc{
 			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
 			return
 		}
+		// the hours of the schedule and the exceptions have to be times of the day
+		if err := menu.CheckSchedule(); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
 
 		// creating the time stamps of menu creation times
 		menu.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
@@ -112,37 +103,33 @@ func CreateMenu() gin.HandlerFunc{
 		// creating the id for the struct to match the required id field in the document
 		menu.ID = primitive.NewObjectID()
 		menu.Menu_id = menu.ID.Hex()
+		menu.Version = 1
+		// the document belongs to the branch the request works on
+		menu.Branch_id = c.GetString("branch_id")
 
-		// creating the menu struct into the menu collection
-		result,insertErr := menuCollection.InsertOne(ctx,menu)
+		// creating the menu struct into the menu repository
+		insertErr := ctl.repos.Menus.Create(ctx,menu)
 		if insertErr != nil{
 			msg := fmt.Sprintf("menu item was not created")
 			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
 			return
 		}
-		
-		// cancel the context after the database insertion is done
-		defer cancel()
 
-		// return the result as a json response for the inserted meal with a status code
-		// of 200
-		c.JSON(http.StatusOK,result)
-
-		// cancel the context resources and deadlines
-		defer cancel()
+		ctl.audit(ctx,c,"menu","create",menu.Menu_id,nil,menu)
 
+		// return the inserted menu as a json response with a status code
+		// of 200
+		c.Header("ETag",etag(menu.Version))
+		c.JSON(http.StatusOK,menu)
 	}
 }
 
-// creating the inTimeSpan
-func inTimeSpan(start,end,check time.Time) bool {
-	return start.After(time.Now()) && end.After(time.Now())
-} 
-
-func UpdateMenu() gin.HandlerFunc{
+func (ctl *Controller) UpdateMenu() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a time out of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// Defers the cancellation of the context until the function exits
+		defer cancel()
 
 		// creating an instance of the menu struct
 		var menu models.Menu
@@ -156,30 +143,64 @@ func UpdateMenu() gin.HandlerFunc{
 
 		// Retrieve the value of the "menu_id" parameter from the request, c is the gin context
 		menuId := c.Param("menu_id")
-		
-		// This line creates a MongoDB filter by constructing a map where the key
-		// is "menu_id" and the value is the extracted "menuId". This filter can be used
-		// in MongoDb queries to find documents where the "menu_id" field matches the extracted value
-		filter := bson.M{"menu_id":menuId}
+
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
+		// keeping the menu as it was for the audit log and to check the schedule it will have
+		before,err := ctl.repos.Menus.Get(ctx,menuId)
+		if err != nil{
+			repositoryError(c,err,"menu was not found")
+			return
+		}
 
 		// Declares a variable to store update operations in a Bson document
 		var updateObj primitive.D
 
-		// Checks if the start and end date in the menu struct are not nil 
-		if menu.Start_date != nil && menu.End_date != nil {
-			// and checks if there are in the correct timespan and cancels the operation is an error occurs
-			if !inTimeSpan(*menu.Start_date,*menu.End_date,time.Now()){
-				msg := "kindly retype the time"
-				c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
-				// cancelling the context and exits the function
-				defer cancel()
+		// the dates sent replace the stored ones, a date left out is kept, and the end has
+		// to stay after the start with the dates the menu ends up with
+		updated := before
+		if menu.Start_date != nil{
+			updateObj = append(updateObj, bson.E{Key :"start_date",Value: menu.Start_date})
+			updated.Start_date = menu.Start_date
+		}
+		if menu.End_date != nil{
+			if !menu.End_date.After(time.Now()){
+				c.JSON(http.StatusBadRequest,gin.H{"error":"end_date has to be in the future"})
 				return
 			}
+			updateObj = append(updateObj, bson.E{Key :"end_date", Value: menu.End_date})
+			updated.End_date = menu.End_date
 		}
 
-		// Appending BSON elements to 'updateObj' for the start_date and end_date
-		updateObj = append(updateObj, bson.E{Key :"start_date",Value: menu.Start_date})
-		updateObj = append(updateObj, bson.E{Key :"end_date", Value: menu.End_date})
+		// the schedule and the exceptions are replaced when sent, an empty list removes them
+		if menu.Schedule != nil{
+			for _,window := range menu.Schedule{
+				if validationErr := validate.Struct(window); validationErr != nil{
+					c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+					return
+				}
+			}
+			updateObj = append(updateObj, bson.E{Key :"schedule",Value: menu.Schedule})
+			updated.Schedule = menu.Schedule
+		}
+		if menu.Exceptions != nil{
+			for _,exception := range menu.Exceptions{
+				if validationErr := validate.Struct(exception); validationErr != nil{
+					c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+					return
+				}
+			}
+			updateObj = append(updateObj, bson.E{Key :"exceptions",Value: menu.Exceptions})
+			updated.Exceptions = menu.Exceptions
+		}
+		if err := updated.CheckSchedule(); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
 
 		// updating the "name" field only if 'Name' in the "menu" struct is not an empty string
 		if menu.Name != ""{
@@ -194,39 +215,82 @@ func UpdateMenu() gin.HandlerFunc{
 		// Updates the "Updated_at" field in the 'menu' struct with the current time
 		menu.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{Key :"updated_at",Value: menu.Updated_at})
-		
-		// Sets up the 'Upsert' option to perform an upsert operation(insert a new document if a 
-		// matching document is not found)
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
-		}
-
-		result,err := menuCollection.UpdateOne(
-			// context
-			ctx,
-			// specifies the document to update
-			filter,
-			// using the set operator to set the fields specified in 'updateObj'
-			bson.D{
-				{Key :"$set",Value: updateObj},
-			},
-			// provides the 'UpdateOptions' ('opt') for upsert behaviour
-			&opt,
-		)
+
+		// updating the menu with the matching "menu_id" in the repository
+		result,err := ctl.repos.Menus.Update(ctx,menuId,version,updateObj)
 
 		// Checks for errors during the update operation and returns an error message
 		// if there is an error
 		if err != nil{
 			msg := "menu update failed"
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+			repositoryError(c,err,msg)
+			return
 		}
 
-		// Defers the cancellation of the context until the function exits
-		defer cancel()
+		ctl.audit(ctx,c,"menu","update",menuId,before,result)
 
 		// Incase of a success, the function returns a Json response with the HTTP status
-		// OK and the result of the operation
+		// OK and the updated menu
+		c.Header("ETag",etag(result.Version))
 		c.JSON(http.StatusOK,result)
 	}
-}
\ No newline at end of file
+}
+
+// activeMenu is a menu served at the moment asked for, with its foods
+type activeMenu struct {
+	models.Menu
+	Foods        []models.Food   `json:"foods"`
+}
+
+// GetActiveMenus lists the menus of the branch that are served at the moment of the at
+// query parameter, an RFC 3339 time that is now when left out, each with its foods. The
+// schedules are read in the timezone of the branch.
+func (ctl *Controller) GetActiveMenus() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		at := time.Now()
+		if value := c.Query("at"); value != ""{
+			parsed,err := time.Parse(time.RFC3339,value)
+			if err != nil{
+				c.JSON(http.StatusBadRequest,gin.H{"error":"at has to be an RFC 3339 time like 2026-10-18T08:30:00+02:00"})
+				return
+			}
+			at = parsed
+		}
+
+		loc,err := ctl.branchLocation(repository.AllBranches(ctx),c.GetString("branch_id"))
+		if err != nil{
+			repositoryError(c,err,"error occured while reading the timezone of the branch")
+			return
+		}
+
+		allMenus,_,err := ctl.repos.Menus.List(ctx,repository.ListOptions{})
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing the menus"})
+			return
+		}
+		allFoods,_,err := ctl.repos.Foods.List(ctx,repository.ListOptions{})
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing the foods"})
+			return
+		}
+
+		menus := []activeMenu{}
+		for _,menu := range allMenus{
+			if !menu.ActiveAt(at,loc){
+				continue
+			}
+			foods := []models.Food{}
+			for _,food := range allFoods{
+				if food.Menu_id != nil && *food.Menu_id == menu.Menu_id{
+					foods = append(foods,food)
+				}
+			}
+			menus = append(menus,activeMenu{Menu: menu,Foods: foods})
+		}
+
+		c.JSON(http.StatusOK,gin.H{"at":at.In(loc),"timezone":loc.String(),"menus":menus})
+	}
+}
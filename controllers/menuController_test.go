@@ -0,0 +1,88 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+func TestMenuRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,waiter := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	expect(t,ts.do(http.MethodPost,"/menus",manager,`{"name":"Lunch"}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/menus",waiter,`{"name":"Lunch","category":"main"}`),http.StatusForbidden)
+	menuId := ts.createMenu(manager)
+
+	menu := expect(t,ts.do(http.MethodGet,"/menus/" + menuId,waiter,""),http.StatusOK)
+	if str(menu,"name") != "Lunch" || str(menu,"branch_id") != ts.branch{
+		t.Errorf("expected the menu of the branch, got %v",menu)
+	}
+	expect(t,ts.do(http.MethodGet,"/menus/nope",waiter,""),http.StatusNotFound)
+	if menus := expectList(t,ts.do(http.MethodGet,"/menus",waiter,""),http.StatusOK); len(menus) != 1{
+		t.Errorf("expected one menu, got %v",menus)
+	}
+
+	menu = expect(t,ts.do(http.MethodPatch,"/menus/" + menuId,manager,`{"name":"Dinner"}`,"If-Match",`"1"`),http.StatusOK)
+	if str(menu,"name") != "Dinner"{
+		t.Errorf("expected the menu to be renamed, got %v",menu)
+	}
+	expect(t,ts.do(http.MethodPatch,"/menus/" + menuId,manager,`{"name":"Late"}`,"If-Match",`"1"`),http.StatusPreconditionFailed)
+}
+
+func TestActiveMenus(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,waiter := ts.createUser("waiter@example.com",models.RoleWaiter)
+	expect(t,ts.do(http.MethodPatch,"/branches/" + ts.branch,admin,`{"timezone":"Europe/Berlin"}`,"If-Match","*"),http.StatusOK)
+
+	expect(t,ts.do(http.MethodPost,"/menus",manager,`{"name":"Breakfast","category":"main","schedule":[{"days":["mon"],"start":"7:00","end":"11:00"}]}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/menus",manager,`{"name":"Breakfast","category":"main","schedule":[{"days":["monday"],"start":"07:00","end":"11:00"}]}`),http.StatusBadRequest)
+	breakfast := expect(t,ts.do(http.MethodPost,"/menus",manager,`{"name":"Breakfast","category":"main","schedule":[{"days":["mon","tue","wed","thu","fri"],"start":"07:00","end":"11:00"}]}`),http.StatusOK)
+	ts.createFood(manager,str(breakfast,"menu_id"),"4.50")
+	expect(t,ts.do(http.MethodPost,"/menus",manager,`{"name":"Bar","category":"drinks","schedule":[{"days":["fri","sat"],"start":"22:00","end":"02:00"}],"exceptions":[{"date":"2026-12-25","closed":true}]}`),http.StatusOK)
+
+	active := func(at string) []interface{}{
+		body := expect(t,ts.do(http.MethodGet,"/menus/active?at=" + at,waiter,""),http.StatusOK)
+		if str(body,"timezone") != "Europe/Berlin"{
+			t.Errorf("expected the timezone of the branch, got %v",body)
+		}
+		menus,_ := body["menus"].([]interface{})
+		return menus
+	}
+	// 05:30 UTC is 07:30 in Berlin on a Monday
+	menus := active("2026-10-19T05:30:00Z")
+	if len(menus) != 1{
+		t.Fatalf("expected breakfast only, got %v",menus)
+	}
+	menu := menus[0].(map[string]interface{})
+	if foods,_ := menu["foods"].([]interface{}); str(menu,"name") != "Breakfast" || len(foods) != 1{
+		t.Errorf("expected breakfast with its food, got %v",menu)
+	}
+	if menus := active("2026-10-19T09:30:00Z"); len(menus) != 0{
+		t.Errorf("expected nothing served at 11:30, got %v",menus)
+	}
+	if menus := active("2026-10-24T23:30:00Z"); len(menus) != 1{
+		t.Errorf("expected the bar open past midnight, got %v",menus)
+	}
+	if menus := active("2026-12-25T22:30:00Z"); len(menus) != 0{
+		t.Errorf("expected the bar closed on christmas, got %v",menus)
+	}
+	expect(t,ts.do(http.MethodGet,"/menus/active?at=tomorrow",waiter,""),http.StatusBadRequest)
+
+	// a PATCH keeps the dates it leaves out and checks the ones it sends against them
+	path := "/menus/" + str(breakfast,"menu_id")
+	expect(t,ts.do(http.MethodPatch,path,manager,`{"start_date":"2026-10-01T00:00:00Z","end_date":"2099-01-01T00:00:00Z"}`,"If-Match","*"),http.StatusOK)
+	menu = expect(t,ts.do(http.MethodPatch,path,manager,`{"name":"Early"}`,"If-Match","*"),http.StatusOK)
+	if str(menu,"start_date") != "2026-10-01T00:00:00Z" || str(menu,"end_date") != "2099-01-01T00:00:00Z"{
+		t.Errorf("expected the dates to be kept, got %v",menu)
+	}
+	expect(t,ts.do(http.MethodPatch,path,manager,`{"start_date":"2099-06-01T00:00:00Z"}`,"If-Match","*"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,path,manager,`{"end_date":"2020-01-01T00:00:00Z"}`,"If-Match","*"),http.StatusBadRequest)
+	if menus := active("2026-09-28T05:30:00Z"); len(menus) != 0{
+		t.Errorf("expected breakfast before its start date not to be served, got %v",menus)
+	}
+	expect(t,ts.do(http.MethodGet,"/menus/active",waiter,""),http.StatusOK)
+}
@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// two-factor authentication with the RFC 6238 one-time codes of an authenticator app. A user
+// turns it on with StartMFA and ConfirmMFA, after which Login only answers with an mfa token
+// that LoginMFA exchanges for the access and refresh tokens together with a code. The
+// roles of middleware.MFARequiredRoles only count in the tokens of such a login.
+
+// startMFARequest is the body of StartMFA
+type startMFARequest struct {
+	Password   *string   `json:"password" validate:"required"`
+}
+
+// mfaCodeRequest is the body of the requests confirmed with a one-time or a recovery code
+type mfaCodeRequest struct {
+	Code       *string   `json:"code" validate:"required"`
+}
+
+// loginMFARequest is the body of LoginMFA
+type loginMFARequest struct {
+	Mfa_token  *string   `json:"mfa_token" validate:"required"`
+	Code       *string   `json:"code" validate:"required"`
+}
+
+// LoginMFA exchanges the mfa token of Login and a one-time or recovery code for new tokens.
+// A wrong code counts as a failed login.
+func (ctl *Controller) LoginMFA() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body loginMFARequest
+		if !bindBody(c,&body){
+			return
+		}
+
+		claims,err := helper.ValidateMFAToken(*body.Mfa_token)
+		if err != nil{
+			c.JSON(http.StatusUnauthorized,gin.H{"error":"the mfa token is not valid, log in again"})
+			return
+		}
+		// a password reset or an admin ending the sessions of the user also ends a login half way through
+		revoked,err := ctl.repos.Revocations.IsRevoked(ctx,claims.Id,claims.Uid,claims.IssuedTime())
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking the mfa token"})
+			return
+		}
+		user,err := ctl.repos.Users.Get(ctx,claims.Uid)
+		if err != nil && !errors.Is(err,repository.ErrNotFound){
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while looking the user up"})
+			return
+		}
+		if revoked || err != nil || user.Mfa_enabled_at == nil || user.Email == nil{
+			c.JSON(http.StatusUnauthorized,gin.H{"error":"the mfa token is not valid, log in again"})
+			return
+		}
+
+		email := *user.Email
+		now := time.Now().UTC()
+		if !ctl.checkThrottles(ctx,c,email,now){
+			return
+		}
+
+		user,ok,err := ctl.useSecondFactor(ctx,user,*body.Code,now)
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking the code"})
+			return
+		}
+		if !ok{
+			if err := ctl.loginFailed(ctx,c,email,now); err != nil{
+				c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while counting the failed login"})
+				return
+			}
+			ctl.recordLogin(ctx,c,email,user.User_id,loginWrongCode,now)
+			c.JSON(http.StatusUnauthorized,gin.H{"error":"the code is not valid"})
+			return
+		}
+
+		// the mfa token is used up, it can not start a second session
+		revocation := models.Revocation{
+			ID: primitive.NewObjectID(),
+			Jti: claims.Id,
+			User_id: user.User_id,
+			Created_at: revocationTime(),
+			Expires_at: time.Unix(claims.ExpiresAt,0),
+		}
+		if err := ctl.repos.Revocations.Revoke(ctx,revocation); err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while using the mfa token up"})
+			return
+		}
+
+		ctl.startSession(ctx,c,user,email,true,now)
+	}
+}
+
+// StartMFA creates the secret of an authenticator app for the user the token was issued to.
+// Two-factor authentication is only on once ConfirmMFA got a first code of the app.
+func (ctl *Controller) StartMFA() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body startMFARequest
+		if !bindBody(c,&body){
+			return
+		}
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+		if user.Mfa_enabled_at != nil{
+			c.JSON(http.StatusConflict,gin.H{"error":"two-factor authentication is already on"})
+			return
+		}
+		// somebody holding a stolen token must not lock the user out with an app of their own
+		if !ctl.confirmPassword(ctx,c,user,*body.Password){
+			return
+		}
+
+		secret := helper.NewTOTPSecret()
+		updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		if _,err := ctl.repos.Users.Update(ctx,user.User_id,0,primitive.D{
+			{Key: "mfa_pending_secret",Value: secret},
+			{Key: "updated_at",Value: updated_at},
+		}); err != nil{
+			repositoryError(c,err,"two-factor authentication could not be started")
+			return
+		}
+
+		c.JSON(http.StatusOK,gin.H{"secret":secret,"otpauth_uri":helper.TOTPURI(secret,*user.Email)})
+	}
+}
+
+// ConfirmMFA turns two-factor authentication on with a first code of the app set up by
+// StartMFA and answers with the recovery codes, they are not shown again
+func (ctl *Controller) ConfirmMFA() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body mfaCodeRequest
+		if !bindBody(c,&body){
+			return
+		}
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+		if user.Mfa_enabled_at != nil{
+			c.JSON(http.StatusConflict,gin.H{"error":"two-factor authentication is already on"})
+			return
+		}
+		if user.Mfa_pending_secret == nil{
+			c.JSON(http.StatusConflict,gin.H{"error":"start with POST /users/me/mfa"})
+			return
+		}
+
+		now := time.Now().UTC()
+		step,ok := helper.CheckTOTP(*user.Mfa_pending_secret,*body.Code,now,0)
+		if !ok{
+			c.JSON(http.StatusBadRequest,gin.H{"error":"the code is not valid, check the clock of the device"})
+			return
+		}
+
+		codes,hashes := helper.NewRecoveryCodes()
+		enabled_at,_ := time.Parse(time.RFC3339,now.Format(time.RFC3339))
+		// the version read makes a second confirmation racing this one fail
+		result,err := ctl.repos.Users.Update(ctx,user.User_id,user.Version,primitive.D{
+			{Key: "mfa_secret",Value: *user.Mfa_pending_secret},
+			{Key: "mfa_pending_secret",Value: nil},
+			{Key: "mfa_enabled_at",Value: enabled_at},
+			{Key: "mfa_recovery_codes",Value: hashes},
+			{Key: "mfa_last_step",Value: step},
+			{Key: "updated_at",Value: enabled_at},
+		})
+		if err != nil{
+			repositoryError(c,err,"two-factor authentication could not be turned on")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","enable_mfa",user.User_id,user,result)
+		c.JSON(http.StatusOK,gin.H{"recovery_codes":codes})
+	}
+}
+
+// DisableMFA turns two-factor authentication off, confirmed with a one-time or recovery code.
+// Users whose roles require it can not turn it off, an admin can reset it with ResetMFA.
+func (ctl *Controller) DisableMFA() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body mfaCodeRequest
+		if !bindBody(c,&body){
+			return
+		}
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+		if user.Mfa_enabled_at == nil{
+			c.JSON(http.StatusConflict,gin.H{"error":"two-factor authentication is not on"})
+			return
+		}
+		if middleware.MFARequired(user.User_id,user.Roles){
+			c.JSON(http.StatusConflict,gin.H{"error":"your roles require two-factor authentication"})
+			return
+		}
+		if _,ok := ctl.confirmCode(ctx,c,user,*body.Code); !ok{
+			return
+		}
+
+		result,err := ctl.repos.Users.Update(ctx,user.User_id,0,mfaOff())
+		if err != nil{
+			repositoryError(c,err,"two-factor authentication could not be turned off")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","disable_mfa",user.User_id,user,result)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, confirmed with a one-time
+// or recovery code, and answers with the new ones
+func (ctl *Controller) RegenerateRecoveryCodes() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body mfaCodeRequest
+		if !bindBody(c,&body){
+			return
+		}
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+		if user.Mfa_enabled_at == nil{
+			c.JSON(http.StatusConflict,gin.H{"error":"two-factor authentication is not on"})
+			return
+		}
+		user,ok = ctl.confirmCode(ctx,c,user,*body.Code)
+		if !ok{
+			return
+		}
+
+		codes,hashes := helper.NewRecoveryCodes()
+		updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		result,err := ctl.repos.Users.Update(ctx,user.User_id,user.Version,primitive.D{
+			{Key: "mfa_recovery_codes",Value: hashes},
+			{Key: "updated_at",Value: updated_at},
+		})
+		if err != nil{
+			repositoryError(c,err,"recovery codes could not be replaced")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","regenerate_recovery_codes",user.User_id,user,result)
+		c.JSON(http.StatusOK,gin.H{"recovery_codes":codes})
+	}
+}
+
+// ResetMFA turns two-factor authentication off for a user who lost their device and ends
+// their sessions, admins only. The user has to turn it on again if their roles require it.
+func (ctl *Controller) ResetMFA() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		before,err := ctl.repos.Users.Get(ctx,userId)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+
+		result,err := ctl.repos.Users.Update(ctx,userId,0,mfaOff())
+		if err != nil{
+			repositoryError(c,err,"two-factor authentication could not be reset")
+			return
+		}
+		// whoever holds the lost device may also hold a session
+		if err := ctl.revokeSessions(ctx,userId); err != nil{
+			repositoryError(c,err,"two-factor authentication was reset but the sessions could not be revoked")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","reset_mfa",userId,before,result)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// confirmCode uses up a one-time or recovery code of a logged in user before a change to their
+// two-factor authentication. Like a password, a wrong code counts as a failed login. It answers
+// the request itself when the code is refused and returns the user as the code left it.
+func (ctl *Controller) confirmCode(ctx context.Context,c *gin.Context,user models.User,code string) (models.User,bool){
+	if user.Email == nil{
+		c.JSON(http.StatusBadRequest,gin.H{"error":"the user has no email"})
+		return user,false
+	}
+
+	now := time.Now().UTC()
+	if !ctl.checkThrottles(ctx,c,*user.Email,now){
+		return user,false
+	}
+	user,ok,err := ctl.useSecondFactor(ctx,user,code,now)
+	if err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking the code"})
+		return user,false
+	}
+	if !ok{
+		if err := ctl.loginFailed(ctx,c,*user.Email,now); err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while counting the failed attempt"})
+			return user,false
+		}
+		c.JSON(http.StatusForbidden,gin.H{"error":"the code is not valid"})
+		return user,false
+	}
+	return user,true
+}
+
+// useSecondFactor checks a one-time or recovery code of the user and uses it up: the period
+// of a one-time code is stored so the code can not be replayed, a recovery code is removed.
+// The update is made on the version read, of two requests racing with one code only one succeeds.
+func (ctl *Controller) useSecondFactor(ctx context.Context,user models.User,code string,now time.Time) (models.User,bool,error){
+	if user.Mfa_secret == nil{
+		return user,false,nil
+	}
+
+	var changes primitive.D
+	if step,ok := helper.CheckTOTP(*user.Mfa_secret,code,now,user.Mfa_last_step); ok{
+		changes = primitive.D{{Key: "mfa_last_step",Value: step}}
+	} else{
+		hash := helper.HashRecoveryCode(code)
+		left := []string{}
+		for _,stored := range user.Mfa_recovery_codes{
+			if stored != hash{
+				left = append(left,stored)
+			}
+		}
+		if len(left) == len(user.Mfa_recovery_codes){
+			return user,false,nil
+		}
+		changes = primitive.D{{Key: "mfa_recovery_codes",Value: left}}
+	}
+
+	result,err := ctl.repos.Users.Update(ctx,user.User_id,user.Version,changes)
+	if errors.Is(err,repository.ErrVersionConflict){
+		return user,false,nil
+	}
+	if err != nil{
+		return user,false,err
+	}
+	return result,true,nil
+}
+
+// mfaOff is the change that turns two-factor authentication off
+func mfaOff() primitive.D{
+	updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+	return primitive.D{
+		{Key: "mfa_secret",Value: nil},
+		{Key: "mfa_pending_secret",Value: nil},
+		{Key: "mfa_enabled_at",Value: nil},
+		{Key: "mfa_recovery_codes",Value: nil},
+		{Key: "mfa_last_step",Value: 0},
+		{Key: "updated_at",Value: updated_at},
+	}
+}
@@ -0,0 +1,82 @@
+package controllers_test
+
+import (
+	"net/http"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorAuthentication(t *testing.T){
+	ts := newTestServer(t)
+	middleware.MFARequiredRoles = []string{models.RoleManager}
+	manager,_ := ts.createUser("manager@example.com",models.RoleManager)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	login := `{"email":"manager@example.com","password":"secret1"}`
+
+	// without a second factor the manager role is withheld
+	session := ts.login("manager@example.com")
+	if session["mfa_enrollment_required"] != true{
+		t.Errorf("expected to be told to turn two-factor authentication on, got %v",session)
+	}
+	token := str(session,"token")
+	refused := expect(t,ts.do(http.MethodPost,"/menus",token,`{}`),http.StatusForbidden)
+	if !strings.Contains(str(refused,"error"),"two-factor authentication"){
+		t.Errorf("expected the refusal to point at two-factor authentication, got %v",refused)
+	}
+
+	// turning it on
+	expect(t,ts.do(http.MethodPost,"/users/me/mfa/confirm",token,`{"code":"123456"}`),http.StatusConflict)
+	expect(t,ts.do(http.MethodPost,"/users/me/mfa",token,`{"password":"wrong1"}`),http.StatusForbidden)
+	enrollment := expect(t,ts.do(http.MethodPost,"/users/me/mfa",token,`{"password":"secret1"}`),http.StatusOK)
+	secret := str(enrollment,"secret")
+	if secret == "" || !strings.HasPrefix(str(enrollment,"otpauth_uri"),"otpauth://totp/"){
+		t.Fatalf("expected a secret to enroll, got %v",enrollment)
+	}
+	expect(t,ts.do(http.MethodPost,"/users/me/mfa/confirm",token,`{"code":"000000"}`),http.StatusBadRequest)
+	code,_ := helper.TOTPCode(secret,time.Now())
+	confirmed := expect(t,ts.do(http.MethodPost,"/users/me/mfa/confirm",token,`{"code":"` + code + `"}`),http.StatusOK)
+	recoveryCodes,_ := confirmed["recovery_codes"].([]interface{})
+	if len(recoveryCodes) != helper.RecoveryCodeCount{
+		t.Fatalf("expected the recovery codes, got %v",confirmed)
+	}
+	expect(t,ts.do(http.MethodPost,"/users/me/mfa",token,`{"password":"secret1"}`),http.StatusConflict)
+
+	// the password alone only earns an mfa token
+	challenge := expect(t,ts.do(http.MethodPost,"/users/login","",login),http.StatusOK)
+	mfaToken := str(challenge,"mfa_token")
+	if challenge["mfa_required"] != true || mfaToken == "" || str(challenge,"token") != ""{
+		t.Fatalf("expected an mfa challenge, got %v",challenge)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods",mfaToken,""),http.StatusUnauthorized)
+	// the code used to confirm can not be used again
+	expect(t,ts.do(http.MethodPost,"/users/login/mfa","",`{"mfa_token":"` + mfaToken + `","code":"` + code + `"}`),http.StatusUnauthorized)
+	next,_ := helper.TOTPCode(secret,time.Now().Add(30*time.Second))
+	session = expect(t,ts.do(http.MethodPost,"/users/login/mfa","",`{"mfa_token":"` + mfaToken + `","code":"` + next + `"}`),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/menus",str(session,"token"),`{}`),http.StatusBadRequest)
+
+	// a recovery code stands in for a one-time code once
+	recovery := recoveryCodes[0].(string)
+	mfaToken = str(expect(t,ts.do(http.MethodPost,"/users/login","",login),http.StatusOK),"mfa_token")
+	session = expect(t,ts.do(http.MethodPost,"/users/login/mfa","",`{"mfa_token":"` + mfaToken + `","code":"` + strings.ToUpper(recovery) + `"}`),http.StatusOK)
+	if session["mfa_recovery_codes_left"] != float64(helper.RecoveryCodeCount - 1){
+		t.Errorf("expected a recovery code to be used up, got %v",session)
+	}
+	// the mfa token is used up with the session it started
+	expect(t,ts.do(http.MethodPost,"/users/login/mfa","",`{"mfa_token":"` + mfaToken + `","code":"` + recoveryCodes[2].(string) + `"}`),http.StatusUnauthorized)
+	mfaToken = str(expect(t,ts.do(http.MethodPost,"/users/login","",login),http.StatusOK),"mfa_token")
+	expect(t,ts.do(http.MethodPost,"/users/login/mfa","",`{"mfa_token":"` + mfaToken + `","code":"` + recovery + `"}`),http.StatusUnauthorized)
+
+	// the role requires it, only an admin can reset it
+	token = str(session,"token")
+	expect(t,ts.do(http.MethodPost,"/users/me/mfa/disable",token,`{"code":"` + recoveryCodes[1].(string) + `"}`),http.StatusConflict)
+	expect(t,ts.do(http.MethodPost,"/users/" + manager.User_id + "/mfa/reset",token,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/users/" + manager.User_id + "/mfa/reset",admin,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodGet,"/users/me",token,""),http.StatusUnauthorized)
+	if session := ts.login("manager@example.com"); session["mfa_enrollment_required"] != true{
+		t.Errorf("expected the reset to turn two-factor authentication off, got %v",session)
+	}
+}
@@ -3,234 +3,198 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"restaurant-backend/database"
 	"restaurant-backend/models"
+	"restaurant-backend/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // gin.HandlerFunc represent a request handler in gin
 // func(ctx *gin.Context) represents the actual request handler for the routes
 // [ctx *gin.Context] represents the actual parameters for the current HTTP request and response
 
-// create the order collection
-var orderCollection *mongo.Collection = database.OpenCollection(database.Client,"order")
-
-
-func GetOrders() gin.HandlerFunc{
+func (ctl *Controller) GetOrders() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-
-		// querying the database to get all the items and store the in the bson map
-		result,err := orderCollection.Find(context.TODO(),bson.M{})
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
         // canceling the resources until the function exits
 		defer cancel()
+
+		// querying the repository to get all the orders
+		allOrders,_,err := ctl.repos.Orders.List(ctx,repository.ListOptions{})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing order items"})
+			return
 		}
 
-		// creating varible of type bson slice to store the retrieved items
-		var allOrders []bson.M
-		// extract all documents from the mongodb result into the allOrders slice
-		if err = result.All(ctx,&allOrders); err != nil{
-			log.Fatal(err)
-		}
-
-		// returning a JSON response of the documents extracted from the request
+		// returning a JSON response of the orders
 		c.JSON(http.StatusOK,allOrders)
 
 	}
 }
 
-func GetOrder() gin.HandlerFunc{
+func (ctl *Controller) GetOrder() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-		 
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancelling the resources until the function exits
+		defer cancel()
+
 		// retrieving the value of order_id paramenter from the http request
 		orderId := c.Param("order_id")
-		// creating an instance of the order struct
-		var order models.Order
 
-		// Querying the database to find the document that matches the order_id and 
-		// decoding the result into the order struct
-		err := foodCollection.FindOne(ctx,bson.M{"order_id":orderId}).Decode(&order)
-		// cancelling the resources until the function exits
-		defer cancel()
+		// Querying the repository to find the order that matches the order_id
+		order,err := ctl.repos.Orders.Get(ctx,orderId)
 		if err != nil{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while fetching the orders"})
+			repositoryError(c,err,"error occured while fetching the orders")
 			return
 		}
 
 		// returning the JSON response with the retrieved document
+		c.Header("ETag",etag(order.Version))
 		c.JSON(http.StatusOK,order)
 	}
 }
 
-func CreateOrder() gin.HandlerFunc{
+func (ctl *Controller) CreateOrder() gin.HandlerFunc{
 	return func(c *gin.Context) {
-
-		// creating an instance of the table and the models instance
-		var table models.Table
+		// creating an instance of the order struct
 		var order models.Order
 
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-
-		// creating a variable to track the updates in the bson document
-		var updateObj primitive.D
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancelling the resources and context until the function exits
+		defer cancel()
 
-		// retrieving the value of the order id from the http request
-		orderId := c.Param("order_id")
 		// extracting and decoding the http request body into the order struct
 		if err := c.BindJSON(&order); err != nil{
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
 			return
 		}
 
+		// validating the format of the input data in the order struct
+		validationErr := validate.Struct(order)
+		if validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+
 		if order.Table_id != nil{
-			// querying the database to find the document that matches the id  table id and decoding
-			// data of the result into the table struct
-			err := orderCollection.FindOne(ctx,bson.M{"table_id":order.Table_id}).Decode(&table)
-			// cancelling the resources until the function exits
-			defer cancel()
+			// querying the table that matches the table_id
+			_,err := ctl.repos.Tables.Get(ctx,*order.Table_id)
 			if err != nil{
-				msg := fmt.Sprintf("message: Order was not found")
-				c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+				msg := fmt.Sprintf("message:Table was not found")
+				repositoryError(c,err,msg)
 				return
 			}
-			// updating the "table id" incase the  table id is not null
-			updateObj = append(updateObj, bson.E{Key :"table_id",Value: order.Table_id})
 		}
 
-		// updating the "updated_at" field to the current time
-		order.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
-		updateObj = append(updateObj, bson.E{Key: "updated_at",Value: order.Updated_at})
-
-		// setting the upsert option to true to insert the  document if it doesn't 
-		// exist or update it.
-		upsert := true
-		// This line creates a MongoDB filter by constructing a map where the key
-		// is "order_id" and the value is the extracted "orderId". This filter can be used
-		// in MongoDb queries to find documents where the "menu_id" field matches the extracted value
-		filter := bson.M{"order_id":orderId}
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
-		}
+		// updating the time stamps of the created_at and the updated at to the current time
+		order.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		order.Updated_at,_= time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 
-		// updating the bson document using the aggregate functions
-		result,err := orderCollection.UpdateOne(
-			// context
-			ctx,
-			// specifies the document to update
-			filter,
-			// using the set operation to update the updateObj fields
-			bson.D{
-				{Key :"$set",Value: updateObj},
-			},
-			// provides the updateOptions for upsert behaviour
-			&opt,
-		)
+		// Initializing the the order id and giving it hexadecimal representation
+		order.ID = primitive.NewObjectID()
+		order.Order_id = order.ID.Hex()
+		order.Version = 1
+		// the document belongs to the branch the request works on
+		order.Branch_id = c.GetString("branch_id")
 
-		if err != nil{
-			msg := fmt.Sprintf("order item update failed")
+		// creating the order in the order repository
+		insertErr := ctl.repos.Orders.Create(ctx,order)
+		if insertErr != nil {
+			msg := fmt.Sprintf("order item was not created")
 			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
 			return
 		}
 
-		// cancelling the context resources until the function exits
-		defer cancel()
-		// returning a JSON response with the result and status OK
-		c.JSON(http.StatusOK,result)
+		ctl.audit(ctx,c,"order","create",order.Order_id,nil,order)
 
+		// returns a JSON response with the created order
+		c.Header("ETag",etag(order.Version))
+		c.JSON(http.StatusOK,order)
 	}
 }
 
-func UpdateOrder() gin.HandlerFunc{
+func (ctl *Controller) UpdateOrder() gin.HandlerFunc{
 	return func(c *gin.Context) {
-		// creating an instance of the table and order struct
-		var table models.Table
+
+		// creating an instance of the order struct
 		var order models.Order
 
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancelling the context resources until the function exits
+		defer cancel()
 
+		// creating a variable to track the updates in the bson document
+		var updateObj primitive.D
+
+		// retrieving the value of the order id from the http request
+		orderId := c.Param("order_id")
+
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
 		// extracting and decoding the http request body into the order struct
 		if err := c.BindJSON(&order); err != nil{
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
 			return
 		}
 
-		// validating the format of the input data in the order struct
-		validationErr := validate.Struct(order)
-		if validationErr != nil{
-			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
-			return
-		}
-
 		if order.Table_id != nil{
-			// querying the document that matches the table_id and decoding the data into the table struct
-			err := tableCollection.FindOne(ctx,bson.M{"table_id":order.Table_id}).Decode(&table)
-			// cancelling the resources and context until the function exits 
-			defer cancel()
+			// querying the repository to find the table that matches the table id
+			_,err := ctl.repos.Tables.Get(ctx,*order.Table_id)
 			if err != nil{
-				msg := fmt.Sprintf("message:Table was not found")
-				c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+				msg := fmt.Sprintf("message: Table was not found")
+				repositoryError(c,err,msg)
 				return
 			}
+			// updating the "table id" incase the  table id is not null
+			updateObj = append(updateObj, bson.E{Key :"table_id",Value: order.Table_id})
 		}
 
-		// updating the time stamps of the created_at and the updated at to the current time
-		order.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
-		order.Updated_at,_= time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		// updating the "updated_at" field to the current time
+		order.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at",Value: order.Updated_at})
 
-		// Initializing the the order id and giving it hexadecimal representation
-		order.ID = primitive.NewObjectID()
-		order.Order_id = order.ID.Hex()
+		// updating the order that matches the "order_id"
+		before,err := ctl.repos.Orders.Get(ctx,orderId)
+		if err != nil{
+			repositoryError(c,err,"order was not found")
+			return
+		}
+		result,err := ctl.repos.Orders.Update(ctx,orderId,version,updateObj)
 
-		// creating the order struct in the orderCollection
-		result,insertErr := orderCollection.InsertOne(ctx,order)
-		if insertErr != nil {
-			msg := fmt.Sprintf("order item was not created")
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+		if err != nil{
+			msg := fmt.Sprintf("order item update failed")
+			repositoryError(c,err,msg)
 			return
 		}
 
-		// cancelling the resources and context until the function exits
-		defer cancel()
+		ctl.audit(ctx,c,"order","update",orderId,before,result)
 
-		// returns a JSON response with the inserted data to the database
+		// returning a JSON response with the updated order and status OK
+		c.Header("ETag",etag(result.Version))
 		c.JSON(http.StatusOK,result)
+
 	}
 }
 
-func orderItemOrderCreator(order models.Order) string{
-
-	// creating a context with a timeout of 100 seconds
-	var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+// orderItemOrderCreator inserts the order the items of CreateOrderItem belong to.
+// It must be called with the context of the transaction that also inserts the items.
+func (ctl *Controller) orderItemOrderCreator(ctx context.Context,order models.Order) error{
 
 	// parsing and setting the created_at time and updated_at time field of the order
 	order.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 	order.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 
-	// generating a unique order_id using the hexadecimal representation
-	// of the order's id
-	order.Order_id = order.ID.Hex()
-
-	// inserting the order into the orderCollection in the database
-	orderCollection.InsertOne(ctx,order)
-
-	// deferring the cancellation of the context until the function returns
-	defer cancel()
-
-	// returning the generated Order_id
-	return order.Order_id
-}
\ No newline at end of file
+	// inserting the order into the order repository and reporting a failure to the caller
+	return ctl.repos.Orders.Create(ctx,order)
+}
@@ -0,0 +1,34 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+func TestOrderRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,kitchen := ts.createUser("kitchen@example.com",models.RoleKitchen)
+	tableId := ts.createTable(manager)
+
+	expect(t,ts.do(http.MethodPost,"/orders",manager,`{"order_date":"2026-03-02T12:00:00Z","table_id":"nope"}`),http.StatusNotFound)
+	expect(t,ts.do(http.MethodPost,"/orders",kitchen,`{"order_date":"2026-03-02T12:00:00Z","table_id":"` + tableId + `"}`),http.StatusForbidden)
+	order := expect(t,ts.do(http.MethodPost,"/orders",manager,`{"order_date":"2026-03-02T12:00:00Z","table_id":"` + tableId + `"}`),http.StatusOK)
+	orderId := str(order,"order_id")
+
+	order = expect(t,ts.do(http.MethodGet,"/orders/" + orderId,kitchen,""),http.StatusOK)
+	if str(order,"table_id") != tableId{
+		t.Errorf("expected the order of the table, got %v",order)
+	}
+	expect(t,ts.do(http.MethodGet,"/orders/nope",kitchen,""),http.StatusNotFound)
+	if orders := expectList(t,ts.do(http.MethodGet,"/orders",kitchen,""),http.StatusOK); len(orders) != 1{
+		t.Errorf("expected one order, got %v",orders)
+	}
+
+	otherTable := ts.createTable(manager)
+	order = expect(t,ts.do(http.MethodPatch,"/orders/" + orderId,manager,`{"table_id":"` + otherTable + `"}`,"If-Match",`"1"`),http.StatusOK)
+	if str(order,"table_id") != otherTable{
+		t.Errorf("expected the order to move to the other table, got %v",order)
+	}
+}
@@ -2,18 +2,19 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"restaurant-backend/database"
+	"restaurant-backend/middleware"
 	"restaurant-backend/models"
+	"restaurant-backend/money"
+	"restaurant-backend/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // gin.HandlerFunc represent a request handler in gin
@@ -25,63 +26,56 @@ type orderItemsPack struct{
 	Order_items []models.OrderItem
 }
 
-// creating the orderItems collection in the database
-var orderItemsCollection *mongo.Collection = database.OpenCollection(database.Client,"orderItems")
-
-func GetOrderItems() gin.HandlerFunc{
+func (ctl *Controller) GetOrderItems() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-        // quering all the orderitem in the database
-		result,err := orderItemsCollection.Find(context.TODO(),bson.M{})
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
 		// defering the cancellation of context resources until the function exits
 		defer cancel()
+
+        // quering all the orderitem in the repository
+		allOrderItems,_,err := ctl.repos.OrderItems.List(ctx,repository.ListOptions{})
 		if err != nil{
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing ordered items"})
 			return
 		}
-        // creating a slice to store the retrieved items form the database
-		var allOrderItems []bson.M
-		// storing the items from the database to the allOrderItems
-		if err = result.All(ctx,&allOrderItems); err != nil{
-			log.Fatal(err)
-			return
-		}
 		// returning the response of the retrieved items as a JSON response
 		c.JSON(http.StatusOK,allOrderItems)
 
 	}
 }
 
-func GetOrderItem() gin.HandlerFunc{
+func (ctl *Controller) GetOrderItem() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
- 
-		// retrieving the order_item_id from the http request
-		orderItemId := c.Param("order_item_id")
-		// creating an instance of the orderItem struct
-		var orderItem models.OrderItem
-
-		// querying the database to find the document that matches the order_item_id
-		err := orderItemsCollection.FindOne(ctx,bson.M{"orderItem_id":orderItemId}).Decode(&orderItem)
-		// cancelling the context resources until the function exits 
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancelling the context resources until the function exits
 		defer cancel()
+
+		// retrieving the orderItem_id from the http request
+		orderItemId := c.Param("orderItem_id")
+
+		// querying the repository to find the item that matches the order_item_id
+		orderItem,err := ctl.repos.OrderItems.Get(ctx,orderItemId)
 		if err != nil{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing ordered item"})
+			repositoryError(c,err,"error occured while listing ordered item")
 			return
 		}
 		// returning a JSON response for document that matched the orderItem_id
+		c.Header("ETag",etag(orderItem.Version))
 		c.JSON(http.StatusOK,orderItem)
 
 	}
 }
 
-func GetOrderItemsByOrder() gin.HandlerFunc{
+func (ctl *Controller) GetOrderItemsByOrder() gin.HandlerFunc{
 	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
 		orderId := c.Param("order_id")
 
-		allOrderItems,err := ItemByOrder(orderId)
+		allOrderItems,err := ctl.ItemByOrder(ctx,orderId)
 
 		if err != nil{
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing order items by ID"})
@@ -91,135 +85,313 @@ func GetOrderItemsByOrder() gin.HandlerFunc{
 	}
 }
 
-func ItemByOrder(id string) (orderItems []primitive.M, err error){
-	var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-
-	// filtering the documents where id matches the order_id
-	matchStage := bson.D{{Key: "$match",Value: bson.D{{Key: "order_id",Value: id}}}}
-	// {
-	// 	$lookup:
-	// 	  {
-	// 		from: <collection to join>,
-	// 		localField: <field from the input documents>,
-	// 		foreignField: <field from the documents of the "from" collection>,
-	// 		as: <output array field>
-	// 	  }
-	//  }
-	lookupStage := bson.D{{Key: "$lookup",Value: bson.D{{Key: "from",Value: "food"},{Key: "localField",Value: "food_id"},{Key: "foreignField",Value: "food_id"},{Key: "as",Value: "food"}}}}
-	unwindStage := bson.D{{Key: "$unwind",Value: bson.D{{Key: "path",Value: "$food"},{Key: "preserveNullAndEmptyArrays",Value: true}}}}
-
-	lookupOrderStage := bson.D{{Key: "$lookup",Value: bson.D{{Key: "from",Value: "order"},{Key: "localField",Value: "order_id"},{Key: "foreignField",Value: "order_id"},{Key: "as",Value: "order"}}}}
-	unwindOrderStage := bson.D{{Key: "$unwind",Value: bson.D{{Key: "path",Value: "$order"},{Key: "preserveNullAndEmptyArrays",Value: true}}}}
-
-    lookTableStage := bson.D{{Key: "$lookup",Value: bson.D{{Key: "from",Value: "table"},{Key: "localField",Value: "order.table_id"},{Key: "foreignField",Value: "table_id"},{Key: "as",Value: "table"}}}}
-	unwindTableStage := bson.D{{Key: "$unwind",Value: bson.D{{Key: "path",Value: "$table"},{Key: "preserveNullAndEmptyArrays",Value: true}}}}
-
-	projectStage := bson.D{
-		{Key: "$project",Value: bson.D{
-			{Key: "id",Value: 0},
-			{Key: "amount",Value: "$food.price"},
-			{Key: "total_count",Value: 1},
-			{Key: "food_name",Value: "$food.name"},
-			{Key: "food_image",Value: "$food.food_image"},
-			{Key: "table_number",Value: "$table.table_number"},
-			{Key: "table_id",Value: "$table.table_id"}, 
-			{Key: "order_id",Value: "$order.order_id"},
-			{Key: "price",Value: "$food.price"},
-			{Key: "quantity",Value: 1},
-		},},}
-
-	groupStage := bson.D{{Key: "$group",Value: bson.D{{Key: "_id",Value: bson.D{{Key: "order_id",Value: "$order_id"},{Key: "table_id",Value: "$table_id"},{Key: "table_number",Value: "$table_number"}}},{Key: "payment_due",Value: bson.D{{Key: "$sum",Value: "$amount"}}},{Key: "total_count",Value: bson.D{{Key: "$sum",Value: 1}}},{Key: "order_items",Value: bson.D{{Key: "$push",Value: "$$ROOT"}}}}}} 
-
-	projectStage2 := bson.D{
-		{Key: "$project",Value: bson.D{
-			{Key: "id",Value: 0},
-			{Key: "payment_due",Value: 1},
-			{Key: "total_count",Value: 1},
-			{Key: "table_number",Value: "$_id.table_number"},
-			{Key: "order_items",Value: 1},
-		},},}
-
-	result,err := orderItemsCollection.Aggregate(ctx,mongo.Pipeline{
-		matchStage,
-		lookupStage,
-		unwindStage,
-		lookupOrderStage,
-		unwindOrderStage,
-		lookTableStage,
-		unwindTableStage,
-		projectStage,
-		groupStage,
-		projectStage2,
-	})	
-
+// ItemByOrder joins the items of an order with their food, the order and its table
+// and groups them into the payment summary used by the invoices
+func (ctl *Controller) ItemByOrder(ctx context.Context,id string) (orderItems []primitive.M, err error){
+	// filtering the items where id matches the order_id
+	items,err := ctl.repos.OrderItems.ListByOrder(ctx,id)
 	if err != nil{
-		log.Panic(err)
+		return nil,err
+	}
+	if len(items) == 0{
+		return []primitive.M{},nil
+	}
+
+	// looking up the order and the table it was placed at, both may be missing.
+	// Foods and tables that were deleted since are still shown on the bill.
+	lookupCtx := repository.WithDeleted(ctx)
+	var table models.Table
+	order,err := ctl.repos.Orders.Get(ctx,id)
+	if err == nil && order.Table_id != nil{
+		table,_ = ctl.repos.Tables.Get(lookupCtx,*order.Table_id)
+	}
+
+	// projecting every item with the details of its food, each line is its unit price times
+	// its quantity and the lines are added up in cents so the total is exact
+	prices := []money.Money{}
+	projected := []primitive.M{}
+	for _,item := range items{
+		var food models.Food
+		if item.Food_id != nil{
+			food,_ = ctl.repos.Foods.Get(lookupCtx,*item.Food_id)
+		}
+		count,err := item.Count()
+		if err != nil{
+			return nil,fmt.Errorf("order item %s: %w",item.Order_item_id,err)
+		}
+
+		// the unit price includes the options picked for the item, the items stored
+		// without one are priced with their food
+		unitPrice := item.Unit_price
+		if unitPrice == nil{
+			if unitPrice,err = itemPrice(food,nil,item.Modifiers); err != nil{
+				return nil,fmt.Errorf("order item %s: %w",item.Order_item_id,err)
+			}
+		}
+		var price,amount interface{}
+		if unitPrice != nil{
+			line,err := unitPrice.Times(count)
+			if err != nil{
+				return nil,fmt.Errorf("order item %s: %w",item.Order_item_id,err)
+			}
+			price,amount = *unitPrice,line
+			prices = append(prices,line)
+		}
+
+		projected = append(projected,primitive.M{
+			"amount":amount,
+			"food_name":food.Name,
+			"food_image":food.Food_image,
+			"modifiers":item.Modifiers,
+			"table_number":table.Table_number,
+			"table_id":table.Table_id,
+			"order_id":order.Order_id,
+			"price":price,
+			"quantity":count,
+		})
 	}
 
-	if err = result.All(ctx,&orderItems); err != nil{
-		log.Panic(err)
+	// a bill in more than one currency can not be totalled
+	paymentDue,err := money.Sum(prices...)
+	if err != nil{
+		return nil,err
 	}
 
-	defer cancel()
+	// grouping the items of the order into a single summary
+	orderItems = []primitive.M{{
+		"payment_due":paymentDue,
+		"total_count":len(projected),
+		"table_number":table.Table_number,
+		"order_items":projected,
+	}}
 
-	return orderItems,err
-} 
+	return orderItems,nil
+}
 
-func UpdateOrderItem() gin.HandlerFunc{
+func (ctl *Controller) UpdateOrderItem() gin.HandlerFunc{
 	return func(c *gin.Context) {
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
 
 		var orderItem models.OrderItem
 
-		orderItemId := c.Param("order_item_id")
-		filter := bson.M{"order_item_id":orderItemId}
+		orderItemId := c.Param("orderItem_id")
+
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
+		if err := c.BindJSON(&orderItem); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+
+		// keeping the item as it was for the audit log and for the options picked before
+		before,err := ctl.repos.OrderItems.Get(ctx,orderItemId)
+		if err != nil{
+			repositoryError(c,err,"order item was not found")
+			return
+		}
 
 		var updateObj primitive.D
 
 		orderItem.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
         updateObj = append(updateObj, bson.E{Key: "updated_at",Value: orderItem.Updated_at})
 
-		if orderItem.Unit_price != nil{
-			updateObj = append(updateObj, bson.E{Key: "unit_price",Value: &orderItem.Unit_price})
+		if !validPrice(c,orderItem.Unit_price) || !canPriceItem(c,orderItem.Unit_price){
+			return
 		}
 
 		if orderItem.Quantity != nil{
-			updateObj = append(updateObj, bson.E{Key: "quantity",Value: &orderItem.Quantity})
+			if _,err := orderItem.Count(); err != nil{
+				c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "quantity",Value: orderItem.Quantity})
 		}
 
-		if orderItem.Food_id != nil{
-			updateObj = append(updateObj, bson.E{Key: "food_id",Value: &orderItem.Food_id})
-		}
+		// another food or other options are checked against the food, and the item is priced
+		// again with the options it ends up with
+		modifiers := before.Modifiers
+		var food models.Food
+		if orderItem.Food_id != nil || orderItem.Modifiers != nil{
+			foodId := before.Food_id
+			picked := before.Modifiers
+			if orderItem.Food_id != nil{
+				// the options of the food before do not carry over
+				foodId,picked = orderItem.Food_id,nil
+			}
+			if orderItem.Modifiers != nil{
+				picked = orderItem.Modifiers
+			}
+			if foodId == nil{
+				c.JSON(http.StatusBadRequest,gin.H{"error":"the order item has no food, send a food_id"})
+				return
+			}
+
+			food,err = ctl.repos.Foods.Get(ctx,*foodId)
+			if err != nil{
+				repositoryError(c,err,fmt.Sprintf("food %s was not found",*foodId))
+				return
+			}
+			if orderItem.Food_id != nil{
+				// another food can only be put on the order while its menu is served
+				menus,ok := ctl.menusServed(ctx,c,time.Now())
+				if !ok{
+					return
+				}
+				served,err := menus.serves(ctx,food)
+				if err != nil{
+					c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking the menu of the food"})
+					return
+				}
+				if !served{
+					c.JSON(http.StatusBadRequest,gin.H{"error":fmt.Sprintf("food %s can not be ordered now, its menu is not served",*orderItem.Food_id)})
+					return
+				}
+				updateObj = append(updateObj, bson.E{Key: "food_id",Value: orderItem.Food_id})
+			}
 
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+			if modifiers,err = food.ChooseModifiers(picked); err != nil{
+				c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "modifiers",Value: modifiers})
+		}
+		unitPrice := before.Unit_price
+		if orderItem.Food_id != nil || orderItem.Modifiers != nil || orderItem.Unit_price != nil{
+			price,err := itemPrice(food,orderItem.Unit_price,modifiers)
+			if err != nil{
+				c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+				return
+			}
+			if !validPrice(c,price){
+				return
+			}
+			if price != nil{
+				unitPrice = price
+				updateObj = append(updateObj, bson.E{Key: "unit_price",Value: price})
+			}
+		}
+		// the item has to stay billable with the quantity and the price it ends up with
+		updated := before
+		if orderItem.Quantity != nil{
+			updated.Quantity = orderItem.Quantity
+		}
+		if err := lineFits(unitPrice,updated); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
 		}
 
-		result,err := orderItemsCollection.UpdateOne(
-			ctx,
-			filter,
-			bson.D{
-				{Key: "$set",Value: updateObj},
-			},
-			&opt,
-		)
+		result,err := ctl.repos.OrderItems.Update(ctx,orderItemId,version,updateObj)
 
 		if err != nil{
 			msg := fmt.Sprintf("order item update failed")
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+			repositoryError(c,err,msg)
 			return
 		}
+		ctl.audit(ctx,c,"orderItem","update",orderItemId,before,result)
 
-		defer cancel()
-
+		c.Header("ETag",etag(result.Version))
 		c.JSON(http.StatusOK,result)
 	}
 }
 
-func CreateOrderItem() gin.HandlerFunc{
+// itemPrice is the price of one item of the food with the modifiers picked for it: the price
+// of the food, or the base price sent in its place, plus the price deltas of the options.
+// It is nil when there is no price at all.
+func itemPrice(food models.Food,base *money.Money,modifiers []models.OrderItemModifier) (*money.Money,error){
+	if base == nil{
+		base = food.Price
+	}
+	if base == nil{
+		return nil,nil
+	}
+	deltas,err := models.OrderItem{Modifiers: modifiers}.ModifiersPrice(base.Currency)
+	if err != nil{
+		return nil,err
+	}
+	price,err := base.Add(deltas)
+	if err != nil{
+		return nil,err
+	}
+	return &price,nil
+}
+
+// lineFits checks that the unit price times the quantity of the item is an amount that can
+// be billed, a quantity too large for it would overflow the total
+func lineFits(price *money.Money,item models.OrderItem) error{
+	count,err := item.Count()
+	if err != nil || price == nil{
+		return err
+	}
+	_,err = price.Times(count)
+	return err
+}
+
+// canPriceItem answers 403 when an item is sent with a price of its own and the caller is not
+// allowed to price an item other than its food
+func canPriceItem(c *gin.Context,price *money.Money) bool{
+	if price != nil && !middleware.Can(c,middleware.OrderItemPrice){
+		c.JSON(http.StatusForbidden,gin.H{"error":"your role does not allow setting the price of an item"})
+		return false
+	}
+	return true
+}
+
+// servedMenus tells whether the menus of the branch are served at one moment, every
+// menu is looked up once
+type servedMenus struct {
+	ctl      *Controller
+	at       time.Time
+	loc      *time.Location
+	served   map[string]bool
+}
+
+// menusServed reads the timezone of the branch of the request for the menus served at the
+// moment at. It answers the request itself when the branch can not be read.
+func (ctl *Controller) menusServed(ctx context.Context,c *gin.Context,at time.Time) (*servedMenus,bool){
+	loc,err := ctl.branchLocation(repository.AllBranches(ctx),c.GetString("branch_id"))
+	if err != nil{
+		repositoryError(c,err,"error occured while reading the timezone of the branch")
+		return nil,false
+	}
+	return &servedMenus{ctl: ctl,at: at,loc: loc,served: map[string]bool{}},true
+}
+
+// serves reports whether the menu of the food is served, a food whose menu was deleted is not
+func (m *servedMenus) serves(ctx context.Context,food models.Food) (bool,error){
+	if food.Menu_id == nil{
+		return false,nil
+	}
+	if served,ok := m.served[*food.Menu_id]; ok{
+		return served,nil
+	}
+	menu,err := m.ctl.repos.Menus.Get(ctx,*food.Menu_id)
+	if errors.Is(err,repository.ErrNotFound){
+		m.served[*food.Menu_id] = false
+		return false,nil
+	}
+	if err != nil{
+		return false,err
+	}
+	m.served[*food.Menu_id] = menu.ActiveAt(m.at,m.loc)
+	return m.served[*food.Menu_id],nil
+}
+
+// orderItemError is the response of CreateOrderItem when one of the items is rejected
+type orderItemError struct {
+	Error        string   `json:"error"`
+	Item_index   int      `json:"item_index"`
+	Field        string   `json:"field,omitempty"`
+}
+
+func (ctl *Controller) CreateOrderItem() gin.HandlerFunc{
 	return func(c *gin.Context) {
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
 
 		var orderItemPack orderItemsPack
 		var order models.Order
@@ -229,40 +401,137 @@ func CreateOrderItem() gin.HandlerFunc{
 			return
 		}
 
-		order.Order_date,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		if len(orderItemPack.Order_items) == 0{
+			c.JSON(http.StatusBadRequest,gin.H{"error":"an order needs at least one order item"})
+			return
+		}
+
+		// checking the table before anything is written
+		if orderItemPack.Table_id != nil{
+			if _,err := ctl.repos.Tables.Get(ctx,*orderItemPack.Table_id); err != nil{
+				repositoryError(c,err,"message:Table was not found")
+				return
+			}
+		}
 
-		orderItemToBeInserted := []interface{}{}
+		// the order id is generated up front so every item can point at it
+		order.Order_date,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		order.Table_id = orderItemPack.Table_id
-		order_id := orderItemOrderCreator(order)
+		order.ID = primitive.NewObjectID()
+		order.Order_id = order.ID.Hex()
+		order.Version = 1
+		order.Branch_id = c.GetString("branch_id")
+
+		// only the foods of the menus served now can be ordered
+		menus,ok := ctl.menusServed(ctx,c,time.Now())
+		if !ok{
+			return
+		}
 
-		for _,orderItem := range orderItemPack.Order_items{
-			orderItem.Order_id = order_id
+		// validating every item before the transaction starts, the first bad item is reported by its index
+		orderItemToBeInserted := []models.OrderItem{}
+		for index,orderItem := range orderItemPack.Order_items{
+			orderItem.Order_id = order.Order_id
+
+			if validationErr := validate.Struct(orderItem); validationErr != nil{
+				response := orderItemError{Error: validationErr.Error(),Item_index: index}
+				var fieldErrs validator.ValidationErrors
+				if errors.As(validationErr,&fieldErrs) && len(fieldErrs) > 0{
+					response.Field = fieldErrs[0].Field()
+				}
+				c.JSON(http.StatusBadRequest,response)
+				return
+			}
 
-			validationErr := validate.Struct(orderItem)
+			if _,err := orderItem.Count(); err != nil{
+				c.JSON(http.StatusBadRequest,orderItemError{Error: err.Error(),Item_index: index,Field: "Quantity"})
+				return
+			}
 
-			if validationErr != nil{
-				c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			// the food has to exist, its price is used when the item has none
+			food,err := ctl.repos.Foods.Get(ctx,*orderItem.Food_id)
+			if err != nil{
+				status := http.StatusInternalServerError
+				msg := "error occured while checking the food"
+				if errors.Is(err,repository.ErrNotFound){
+					status = http.StatusBadRequest
+					msg = fmt.Sprintf("food %s was not found",*orderItem.Food_id)
+				}
+				c.JSON(status,orderItemError{Error: msg,Item_index: index,Field: "Food_id"})
+				return
+			}
+			served,err := menus.serves(ctx,food)
+			if err != nil{
+				c.JSON(http.StatusInternalServerError,orderItemError{Error: "error occured while checking the menu of the food",Item_index: index,Field: "Food_id"})
+				return
+			}
+			if !served{
+				c.JSON(http.StatusBadRequest,orderItemError{Error: fmt.Sprintf("food %s can not be ordered now, its menu is not served",*orderItem.Food_id),Item_index: index,Field: "Food_id"})
+				return
+			}
+			// the picked options are checked against the food and priced with it
+			modifiers,err := food.ChooseModifiers(orderItem.Modifiers)
+			if err != nil{
+				c.JSON(http.StatusBadRequest,orderItemError{Error: err.Error(),Item_index: index,Field: "Modifiers"})
+				return
+			}
+			orderItem.Modifiers = modifiers
+			// a price sent for the item replaces the price of the food, the options are added to it
+			if orderItem.Unit_price != nil && !middleware.Can(c,middleware.OrderItemPrice){
+				c.JSON(http.StatusForbidden,orderItemError{Error: "your role does not allow setting the price of an item",Item_index: index,Field: "Unit_price"})
+				return
+			}
+			if orderItem.Unit_price,err = itemPrice(food,orderItem.Unit_price,modifiers); err != nil{
+				c.JSON(http.StatusBadRequest,orderItemError{Error: err.Error(),Item_index: index,Field: "Modifiers"})
+				return
+			}
+			if orderItem.Unit_price == nil{
+				c.JSON(http.StatusBadRequest,orderItemError{Error: "the item has no unit price",Item_index: index,Field: "Unit_price"})
+				return
+			}
+			if orderItem.Unit_price.IsNegative(){
+				c.JSON(http.StatusBadRequest,orderItemError{Error: "a price can not be negative",Item_index: index,Field: "Unit_price"})
+				return
+			}
+			if err := lineFits(orderItem.Unit_price,orderItem); err != nil{
+				c.JSON(http.StatusBadRequest,orderItemError{Error: err.Error(),Item_index: index,Field: "Quantity"})
 				return
 			}
 
 			orderItem.ID = primitive.NewObjectID()
 			orderItem.Order_item_id = orderItem.ID.Hex()
+			orderItem.Version = 1
+			orderItem.Branch_id = order.Branch_id
 
 			orderItem.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 			orderItem.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
-
-			var num = toFixed(*orderItem.Unit_price,2)
-			orderItem.Unit_price = &num
 			orderItemToBeInserted = append(orderItemToBeInserted, orderItem)
-			
+
 		}
 
-		insertedOrderItem, err := orderItemsCollection.InsertMany(ctx,orderItemToBeInserted)
+		// inserting the order and its items in one transaction, a failure leaves nothing behind
+		err := ctl.repos.WithTransaction(ctx,func(txCtx context.Context) error{
+			if err := ctl.orderItemOrderCreator(txCtx,order); err != nil{
+				return err
+			}
+			return ctl.repos.OrderItems.CreateMany(txCtx,orderItemToBeInserted)
+		})
 		if err != nil{
-			log.Fatal(err)
+			var writeErr *repository.WriteError
+			if errors.As(err,&writeErr){
+				c.JSON(http.StatusInternalServerError,orderItemError{Error: "order item was not created: " + writeErr.Err.Error(),Item_index: writeErr.Index})
+				return
+			}
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"order was not created: " + err.Error()})
+			return
+		}
+
+		// the audit log is written once the transaction committed
+		ctl.audit(ctx,c,"order","create",order.Order_id,nil,order)
+		for _,orderItem := range orderItemToBeInserted{
+			ctl.audit(ctx,c,"orderItem","create",orderItem.Order_item_id,nil,orderItem)
 		}
-		defer cancel()
 
-		c.JSON(http.StatusOK,insertedOrderItem)
+		c.JSON(http.StatusOK,orderItemToBeInserted)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,200 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderItemRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,waiter := ts.createUser("waiter@example.com",models.RoleWaiter)
+	menuId := ts.createMenu(manager)
+	soup := ts.createFood(manager,menuId,"4.50")
+	tableId := ts.createTable(manager)
+
+	// an order and its items are created together, a bad item is reported by its index
+	expect(t,ts.do(http.MethodPost,"/orderItems",waiter,`{"table_id":"` + tableId + `","order_items":[]}`),http.StatusBadRequest)
+	bad := expect(t,ts.do(http.MethodPost,"/orderItems",waiter,`{"table_id":"` + tableId + `","order_items":[{"food_id":"` + soup + `"},{"food_id":"nope"}]}`),http.StatusBadRequest)
+	if bad["item_index"] != float64(1) || str(bad,"field") != "Food_id"{
+		t.Errorf("expected the second item to be rejected, got %v",bad)
+	}
+	if orders := expectList(t,ts.do(http.MethodGet,"/orders",waiter,""),http.StatusOK); len(orders) != 0{
+		t.Errorf("a rejected item must not leave an order behind, got %v",orders)
+	}
+
+	items := expectList(t,ts.do(http.MethodPost,"/orderItems",waiter,`{"table_id":"` + tableId + `","order_items":[{"food_id":"` + soup + `"},{"food_id":"` + soup + `"}]}`),http.StatusOK)
+	if len(items) != 2{
+		t.Fatalf("expected two items, got %v",items)
+	}
+	orderId,itemId := str(items[0],"order_id"),str(items[0],"order_item_id")
+	if price := items[0]["unit_price"].(map[string]interface{}); price["amount"] != "4.50"{
+		t.Errorf("an item without a unit price costs the price of the food, got %v",price)
+	}
+
+	item := expect(t,ts.do(http.MethodGet,"/orderItems/" + itemId,waiter,""),http.StatusOK)
+	if str(item,"food_id") != soup{
+		t.Errorf("expected the item of the soup, got %v",item)
+	}
+	expect(t,ts.do(http.MethodGet,"/orderItems/nope",waiter,""),http.StatusNotFound)
+	if all := expectList(t,ts.do(http.MethodGet,"/orderItems",waiter,""),http.StatusOK); len(all) != 2{
+		t.Errorf("expected two items, got %v",all)
+	}
+
+	summary := expectList(t,ts.do(http.MethodGet,"/orderItems-order/" + orderId,waiter,""),http.StatusOK)
+	if len(summary) != 1 || summary[0]["total_count"] != float64(2) || summary[0]["table_number"] != float64(7){
+		t.Fatalf("expected a summary of two items at table 7, got %v",summary)
+	}
+	if due := summary[0]["payment_due"].(map[string]interface{}); due["amount"] != "9.00"{
+		t.Errorf("expected 9.00 due, got %v",due)
+	}
+
+	// only a manager prices an item other than its food
+	expect(t,ts.do(http.MethodPatch,"/orderItems/" + itemId,waiter,`{"unit_price":"3.00"}`,"If-Match",`"1"`),http.StatusForbidden)
+	item = expect(t,ts.do(http.MethodPatch,"/orderItems/" + itemId,manager,`{"unit_price":"3.00"}`,"If-Match",`"1"`),http.StatusOK)
+	if price := item["unit_price"].(map[string]interface{}); price["amount"] != "3.00"{
+		t.Errorf("expected the new unit price, got %v",price)
+	}
+	expect(t,ts.do(http.MethodPatch,"/orderItems/" + itemId,manager,`{"unit_price":"-3.00"}`,"If-Match",`"2"`),http.StatusBadRequest)
+}
+
+func TestOrderAndItemsAreCreatedTogether(t *testing.T){
+	ts := newTestServer(t)
+	tableId := "t1"
+	newOrder := func() models.Order{
+		id := primitive.NewObjectID()
+		return models.Order{ID: id,Order_id: id.Hex(),Order_date: time.Now(),Table_id: &tableId,Version: 1,Branch_id: ts.branch}
+	}
+	newItem := func(orderId string) models.OrderItem{
+		id := primitive.NewObjectID()
+		return models.OrderItem{ID: id,Order_item_id: id.Hex(),Order_id: orderId,Version: 1,Branch_id: ts.branch}
+	}
+
+	// the second item clashes with the first, the order written before goes too
+	order := newOrder()
+	first := newItem(order.Order_id)
+	err := ts.repos.WithTransaction(ts.ctx(),func(ctx context.Context) error{
+		if err := ts.repos.Orders.Create(ctx,order); err != nil{
+			return err
+		}
+		return ts.repos.OrderItems.CreateMany(ctx,[]models.OrderItem{first,first})
+	})
+	var writeErr *repository.WriteError
+	if !errors.As(err,&writeErr) || writeErr.Index != 1{
+		t.Fatalf("expected the second item to fail, got %v",err)
+	}
+	if _,err := ts.repos.Orders.Get(ts.ctx(),order.Order_id); !errors.Is(err,repository.ErrNotFound){
+		t.Errorf("the order must be rolled back with its items, got %v",err)
+	}
+	if _,err := ts.repos.OrderItems.Get(ts.ctx(),first.Order_item_id); !errors.Is(err,repository.ErrNotFound){
+		t.Errorf("no item may be left behind, got %v",err)
+	}
+
+	// both are kept when every write succeeds
+	order = newOrder()
+	items := []models.OrderItem{newItem(order.Order_id),newItem(order.Order_id)}
+	err = ts.repos.WithTransaction(ts.ctx(),func(ctx context.Context) error{
+		if err := ts.repos.Orders.Create(ctx,order); err != nil{
+			return err
+		}
+		return ts.repos.OrderItems.CreateMany(ctx,items)
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _,err := ts.repos.Orders.Get(ts.ctx(),order.Order_id); err != nil{
+		t.Errorf("expected the order, got %v",err)
+	}
+	if stored,err := ts.repos.OrderItems.ListByOrder(ts.ctx(),order.Order_id); err != nil || len(stored) != 2{
+		t.Errorf("expected the two items of the order, got %v, %v",stored,err)
+	}
+}
+
+func TestModifiersAndQuantities(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,waiter := ts.createUser("waiter@example.com",models.RoleWaiter)
+	menuId := ts.createMenu(manager)
+	tableId := ts.createTable(manager)
+	soup := ts.createFood(manager,menuId,"4.50")
+
+	groups := `"modifier_groups":[{"group_id":"size","name":"Size","required":true,"max_selections":1,"options":[{"option_id":"small","name":"Small","price_delta":"-1.00"},{"option_id":"large","name":"Large","price_delta":"2.50"}]},{"group_id":"extras","name":"Extras","options":[{"option_id":"cheese","name":"Cheese","price_delta":"0.75"}]}]`
+	expect(t,ts.do(http.MethodPost,"/foods",manager,`{"name":"Burger","price":"9.00","food_image":"burger.png","menu_id":"` + menuId + `","modifier_groups":[{"group_id":"size","name":"Size","max_selections":3,"options":[{"option_id":"small","name":"Small"}]}]}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/foods",manager,`{"name":"Burger","price":"9.00","food_image":"burger.png","menu_id":"` + menuId + `","modifier_groups":[{"group_id":"size","name":"Size","options":[]}]}`),http.StatusBadRequest)
+	burger := str(expect(t,ts.do(http.MethodPost,"/foods",manager,`{"name":"Burger","price":"9.00","food_image":"burger.png","menu_id":"` + menuId + `",` + groups + `}`),http.StatusOK),"food_id")
+
+	order := func(items string) *httptest.ResponseRecorder{
+		return ts.do(http.MethodPost,"/orderItems",waiter,`{"table_id":"` + tableId + `","order_items":[` + items + `]}`)
+	}
+	// the size has to be picked, and the quantity has to be a whole number above zero
+	expect(t,order(`{"food_id":"` + burger + `"}`),http.StatusBadRequest)
+	expect(t,order(`{"food_id":"` + burger + `","modifiers":[{"option_id":"small"},{"option_id":"large"}]}`),http.StatusBadRequest)
+	expect(t,order(`{"food_id":"` + burger + `","modifiers":[{"option_id":"truffle"}]}`),http.StatusBadRequest)
+	bad := expect(t,order(`{"food_id":"` + soup + `","quantity":"0"}`),http.StatusBadRequest)
+	if str(bad,"field") != "Quantity"{
+		t.Errorf("expected the quantity to be reported, got %v",bad)
+	}
+	// a quantity the bill could not add up is refused like a malformed one
+	bad = expect(t,order(`{"food_id":"` + soup + `","quantity":"9223372036854775807"}`),http.StatusBadRequest)
+	if str(bad,"field") != "Quantity"{
+		t.Errorf("expected the quantity to be reported, got %v",bad)
+	}
+
+	items := expectList(t,order(`{"food_id":"` + burger + `","quantity":"2","modifiers":[{"option_id":"large"},{"option_id":"cheese"}]},{"food_id":"` + soup + `","quantity":"3"}`),http.StatusOK)
+	if len(items) != 2{
+		t.Fatalf("expected two items, got %v",items)
+	}
+	modifiers,_ := items[0]["modifiers"].([]interface{})
+	if len(modifiers) != 2 || str(modifiers[0].(map[string]interface{}),"name") != "Large"{
+		t.Errorf("expected the names of the options to be copied, got %v",items[0])
+	}
+	if price := items[0]["unit_price"].(map[string]interface{}); price["amount"] != "12.25"{
+		t.Errorf("expected the burger with its options at 12.25, got %v",price)
+	}
+
+	// the bill is the quantity times the unit price of each item
+	summary := expectList(t,ts.do(http.MethodGet,"/orderItems-order/" + str(items[0],"order_id"),waiter,""),http.StatusOK)
+	if due := summary[0]["payment_due"].(map[string]interface{}); due["amount"] != "38.00"{
+		t.Errorf("expected 2 x 12.25 + 3 x 4.50 = 38.00 due, got %v",due)
+	}
+	amounts := map[float64]interface{}{}
+	lines,_ := summary[0]["order_items"].([]interface{})
+	for _,line := range lines{
+		line := line.(map[string]interface{})
+		quantity,_ := line["quantity"].(float64)
+		amounts[quantity] = line["amount"].(map[string]interface{})["amount"]
+	}
+	if amounts[2] != "24.50" || amounts[3] != "13.50"{
+		t.Errorf("expected the lines to come to 24.50 and 13.50, got %v",lines)
+	}
+
+	// a price sent for the item replaces the price of the food, the options still count
+	expect(t,order(`{"food_id":"` + burger + `","unit_price":"5.00","modifiers":[{"option_id":"small"}]}`),http.StatusForbidden)
+	burgerId := str(items[0],"order_item_id")
+	item := expect(t,ts.do(http.MethodPatch,"/orderItems/" + burgerId,manager,`{"unit_price":"5.00"}`,"If-Match","*"),http.StatusOK)
+	if price := item["unit_price"].(map[string]interface{}); price["amount"] != "8.25"{
+		t.Errorf("expected 5.00 with the large size and cheese at 8.25, got %v",price)
+	}
+	item = expect(t,ts.do(http.MethodPatch,"/orderItems/" + burgerId,waiter,`{"modifiers":[{"option_id":"small"}]}`,"If-Match","*"),http.StatusOK)
+	if price := item["unit_price"].(map[string]interface{}); price["amount"] != "8.00"{
+		t.Errorf("expected other options to price the item with its food again, got %v",price)
+	}
+	expect(t,ts.do(http.MethodPatch,"/orderItems/" + burgerId,manager,`{"unit_price":"0.50"}`,"If-Match","*"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/orderItems/" + burgerId,manager,`{"modifiers":[{"option_id":"large"},{"option_id":"cheese"}]}`,"If-Match","*"),http.StatusOK)
+
+	expect(t,ts.do(http.MethodPatch,"/orderItems/" + str(items[1],"order_item_id"),waiter,`{"quantity":"two"}`,"If-Match","*"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/orderItems/" + str(items[1],"order_item_id"),waiter,`{"quantity":"9223372036854775807"}`,"If-Match","*"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,"/orderItems/" + str(items[1],"order_item_id"),waiter,`{"quantity":"1"}`,"If-Match","*"),http.StatusOK)
+	summary = expectList(t,ts.do(http.MethodGet,"/orderItems-order/" + str(items[0],"order_id"),waiter,""),http.StatusOK)
+	if due := summary[0]["payment_due"].(map[string]interface{}); due["amount"] != "29.00"{
+		t.Errorf("expected 2 x 12.25 + 4.50 = 29.00 due, got %v",due)
+	}
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/middleware"
+	"restaurant-backend/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// quick switching between the staff sharing a terminal. The terminal itself is logged in with
+// an api key holding the user:pin_login scope, a member of staff types their PIN on it and gets
+// an access token of their own for a few minutes, so the orders and invoices they touch are
+// attributed to them. A PIN is far easier to guess than a password, so it is throttled harder:
+// per user and per terminal, with a lockout after a few failures.
+const (
+	// the failures of a PIN let through before the backoff starts
+	pinFreeFailures = 2
+	// the failures of a terminal, several people type their PINs on it
+	terminalFreeFailures = 10
+	// a PIN is locked after this many failures in a row, the password still works
+	pinLockoutFailures = 5
+	// a PIN only guards a short lived token on a terminal that is already logged in,
+	// it is hashed at the default cost to keep switching quick
+	pinCost = bcrypt.DefaultCost
+)
+
+// the reason a PIN login failed, see models.LoginAttempt
+const loginWrongPin = "wrong_pin"
+
+// setPinRequest is the body of SetPin
+type setPinRequest struct {
+	Pin        *string   `json:"pin" validate:"required,min=4,max=6"`
+	Password   *string   `json:"password" validate:"required"`
+}
+
+// pinLoginRequest is the body of PinLogin
+type pinLoginRequest struct {
+	User_id    *string   `json:"user_id" validate:"required"`
+	Pin        *string   `json:"pin" validate:"required"`
+}
+
+// pinSessionResponse answers a PIN login, the user with a token that can not be refreshed
+type pinSessionResponse struct {
+	userResponse
+	Token                string                  `json:"token"`
+	Expires_at           time.Time               `json:"expires_at"`
+}
+
+func pinKey(userId string) string{
+	return "pin:" + userId
+}
+
+func terminalKey(keyId string) string{
+	return "terminal:" + keyId
+}
+
+// weakPin reports why a PIN is refused: it has to be 4 to 6 digits, and neither one digit
+// repeated nor a run of digits counting up or down like 1234 or 9876
+func weakPin(pin string) string{
+	if len(pin) < 4 || len(pin) > 6{
+		return "the PIN has to be 4 to 6 digits"
+	}
+	for _,digit := range pin{
+		if digit < '0' || digit > '9'{
+			return "the PIN has to be 4 to 6 digits"
+		}
+	}
+	same,up,down := true,true,true
+	for i := 1; i < len(pin); i++{
+		same = same && pin[i] == pin[i-1]
+		up = up && pin[i] == pin[i-1]+1
+		down = down && pin[i] == pin[i-1]-1
+	}
+	if same || up || down{
+		return "the PIN is too easy to guess, do not repeat one digit or count up or down"
+	}
+	return ""
+}
+
+// SetPin sets the PIN of the user the token was issued to, once their password is confirmed.
+// It replaces the PIN the user had and lifts its lockout.
+func (ctl *Controller) SetPin() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body setPinRequest
+		if !bindBody(c,&body){
+			return
+		}
+		if msg := weakPin(*body.Pin); msg != ""{
+			c.JSON(http.StatusBadRequest,gin.H{"error":msg})
+			return
+		}
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+		if !ctl.confirmPassword(ctx,c,user,*body.Password){
+			return
+		}
+
+		hash,err := bcrypt.GenerateFromPassword([]byte(*body.Pin),pinCost)
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while hashing the PIN"})
+			return
+		}
+		updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		result,err := ctl.repos.Users.Update(ctx,user.User_id,0,primitive.D{
+			{Key: "pin_hash",Value: string(hash)},
+			{Key: "pin_set_at",Value: updated_at},
+			{Key: "updated_at",Value: updated_at},
+		})
+		if err != nil{
+			repositoryError(c,err,"PIN could not be set")
+			return
+		}
+		if err := ctl.repos.Logins.Clear(ctx,pinKey(user.User_id)); err != nil{
+			log.Printf("clearing the failed PIN logins of user %s after a new PIN: %v",user.User_id,err)
+		}
+
+		ctl.audit(ctx,c,"user","set_pin",user.User_id,user,result)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RemovePin removes the PIN of the user the token was issued to, they can no longer switch
+// to their account on a shared terminal
+func (ctl *Controller) RemovePin() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+		if user.Pin_hash == nil{
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		result,err := ctl.repos.Users.Update(ctx,user.User_id,0,primitive.D{
+			{Key: "pin_hash",Value: nil},
+			{Key: "pin_set_at",Value: nil},
+			{Key: "updated_at",Value: updated_at},
+		})
+		if err != nil{
+			repositoryError(c,err,"PIN could not be removed")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","remove_pin",user.User_id,user,result)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// PinLogin switches a shared terminal to a member of staff who works at its branch. Only an
+// api key can call it, the token it answers with expires after helper.PinTokenLifetime and
+// stops working with the api key. A wrong PIN counts against the user and the terminal.
+func (ctl *Controller) PinLogin() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		terminalId := c.GetString("api_key_id")
+		if middleware.APIKey(c) == nil || terminalId == ""{
+			c.JSON(http.StatusForbidden,gin.H{"error":"a PIN can only be used on a terminal logged in with an api key"})
+			return
+		}
+
+		var body pinLoginRequest
+		if !bindBody(c,&body){
+			return
+		}
+		userId := *body.User_id
+		branchId := c.GetString("branch_id")
+
+		now := time.Now().UTC()
+		if !ctl.checkThrottleKeys(ctx,c,pinKey(userId),pinFreeFailures,terminalKey(terminalId),terminalFreeFailures,now){
+			return
+		}
+
+		user,err := ctl.repos.Users.Get(ctx,userId)
+		if err != nil && !errors.Is(err,repository.ErrNotFound){
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while looking the user up"})
+			return
+		}
+		found := err == nil
+		email := ""
+		if found && user.Email != nil{
+			email = *user.Email
+		}
+
+		// an unknown user, a user without a PIN and a user of another branch are answered like a wrong PIN
+		pinValid := false
+		if found && user.Pin_hash != nil{
+			pinValid = bcrypt.CompareHashAndPassword([]byte(*user.Pin_hash),[]byte(*body.Pin)) == nil
+		}
+		if !pinValid || !containsString(user.Branches,branchId){
+			if err := ctl.failThrottleKeys(ctx,pinKey(userId),terminalKey(terminalId),pinLockoutFailures,now); err != nil{
+				c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while counting the failed login"})
+				return
+			}
+			if found{
+				ctl.recordLogin(ctx,c,email,user.User_id,loginWrongPin,now)
+			}
+			c.JSON(http.StatusUnauthorized,gin.H{"error":"the user or the PIN is not valid"})
+			return
+		}
+
+		if err := ctl.repos.Logins.Clear(ctx,pinKey(userId)); err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while counting the login"})
+			return
+		}
+		ctl.recordLogin(ctx,c,email,user.User_id,"",now)
+
+		token,err := helper.GeneratePinToken(user,branchId,terminalId)
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while signing the token"})
+			return
+		}
+
+		c.JSON(http.StatusOK,pinSessionResponse{
+			userResponse: newUserResponse(user),
+			Token: token,
+			Expires_at: now.Add(helper.PinTokenLifetime),
+		})
+	}
+}
+
+func containsString(list []string,value string) bool{
+	for _,item := range list{
+		if item == value{
+			return true
+		}
+	}
+	return false
+}
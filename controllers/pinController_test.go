@@ -0,0 +1,85 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/controllers"
+	"restaurant-backend/models"
+	"testing"
+)
+
+func TestWeakPin(t *testing.T){
+	for pin,weak := range map[string]bool{
+		"2580": false,
+		"902741": false,
+		"1357": false,
+		"123": true,
+		"1234567": true,
+		"12a4": true,
+		"0000": true,
+		"1234": true,
+		"987654": true,
+		"7890": false,
+	}{
+		if msg := controllers.WeakPin(pin); (msg != "") != weak{
+			t.Errorf("weakPin(%q) = %q, weak should be %v",pin,msg,weak)
+		}
+	}
+}
+
+func TestPinLogin(t *testing.T){
+	ts := newTestServer(t)
+	waiter,waiterToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	keyId,terminal := ts.createAPIKey(admin,`"user:pin_login"`)
+
+	expect(t,ts.do(http.MethodPut,"/users/me/pin",waiterToken,`{"pin":"1111","password":"secret1"}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPut,"/users/me/pin",waiterToken,`{"pin":"2580","password":"wrong1"}`),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPut,"/users/me/pin",waiterToken,`{"pin":"2580","password":"secret1"}`),http.StatusNoContent)
+
+	body := `{"user_id":"` + waiter.User_id + `","pin":"2580"}`
+	// a member of staff can not switch, only a terminal
+	expect(t,ts.do(http.MethodPost,"/users/pin-login",waiterToken,body),http.StatusForbidden)
+	session := expect(t,ts.do(http.MethodPost,"/users/pin-login",terminal,body),http.StatusOK)
+	pinToken := str(session,"token")
+	if str(session,"user_id") != waiter.User_id || pinToken == "" || str(session,"expires_at") == ""{
+		t.Fatalf("expected a short lived token of the waiter, got %v",session)
+	}
+	expect(t,ts.do(http.MethodGet,"/orders",pinToken,""),http.StatusOK)
+
+	// leaving the terminal ends the PIN token only
+	expect(t,ts.do(http.MethodPost,"/users/logout",pinToken,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodGet,"/orders",pinToken,""),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodGet,"/orders",waiterToken,""),http.StatusOK)
+
+	// the PIN tokens stop working with the api key of the terminal
+	pinToken = str(expect(t,ts.do(http.MethodPost,"/users/pin-login",terminal,body),http.StatusOK),"token")
+	expect(t,ts.do(http.MethodDelete,"/api-keys/" + keyId,admin,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodGet,"/orders",pinToken,""),http.StatusUnauthorized)
+}
+
+func TestPinThrottle(t *testing.T){
+	ts := newTestServer(t)
+	waiter,waiterToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	_,terminal := ts.createAPIKey(admin,`"user:pin_login"`)
+	expect(t,ts.do(http.MethodPut,"/users/me/pin",waiterToken,`{"pin":"2580","password":"secret1"}`),http.StatusNoContent)
+
+	// a user of another branch is refused like a wrong PIN
+	other,otherToken := ts.createUser("other@example.com",models.RoleWaiter)
+	expect(t,ts.do(http.MethodPut,"/users/me/pin",otherToken,`{"pin":"2580","password":"secret1"}`),http.StatusNoContent)
+	outsider := ts.createBranch("Other")
+	expect(t,ts.do(http.MethodPut,"/users/" + other.User_id + "/branches",admin,`{"branches":["` + outsider + `"]}`,"If-Match","*"),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/users/pin-login",terminal,`{"user_id":"` + other.User_id + `","pin":"2580"}`),http.StatusUnauthorized)
+
+	wrong := `{"user_id":"` + waiter.User_id + `","pin":"1470"}`
+	expect(t,ts.do(http.MethodPost,"/users/pin-login",terminal,wrong),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/pin-login",terminal,wrong),http.StatusUnauthorized)
+	// past two failures the PIN has to wait, the right one too
+	w := ts.do(http.MethodPost,"/users/pin-login",terminal,`{"user_id":"` + waiter.User_id + `","pin":"2580"}`)
+	expect(t,w,http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == ""{
+		t.Error("expected to be told when to retry")
+	}
+	// the password of the user is not throttled by their PIN
+	ts.login("waiter@example.com")
+}
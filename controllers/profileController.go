@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the endpoints staff use to look after their own account, and the managers to look after
+// the accounts of their staff
+
+// updateUserRequest is the body of UpdateUser, the fields left out are not changed.
+// The email, the password, the branches and the roles have endpoints of their own.
+type updateUserRequest struct {
+	First_name   *string   `json:"first_name" validate:"omitempty,min=2,max=100"`
+	Last_name    *string   `json:"last_name" validate:"omitempty,min=2,max=100"`
+	Phone        *string   `json:"phone" validate:"omitempty,min=1"`
+	Avatar       *string   `json:"avatar"`
+}
+
+// changePasswordRequest is the body of ChangePassword
+type changePasswordRequest struct {
+	Current_password   *string   `json:"current_password" validate:"required"`
+	New_password       *string   `json:"new_password" validate:"required,min=6"`
+}
+
+// currentUser reads the user the token was issued to. It answers the request itself when
+// there is none, an api key does not belong to a user.
+func (ctl *Controller) currentUser(ctx context.Context,c *gin.Context) (models.User,bool){
+	claims := middleware.Claims(c)
+	if claims == nil{
+		c.JSON(http.StatusBadRequest,gin.H{"error":"an api key does not belong to a user"})
+		return models.User{},false
+	}
+	user,err := ctl.repos.Users.Get(ctx,claims.Uid)
+	if err != nil{
+		repositoryError(c,err,"user was not found")
+		return models.User{},false
+	}
+	return user,true
+}
+
+// GetMe returns the user the token was issued to
+func (ctl *Controller) GetMe() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+
+		c.Header("ETag",etag(user.Version))
+		c.JSON(http.StatusOK,newUserResponse(user))
+	}
+}
+
+// UpdateUser changes the names, the phone number and the avatar of a user. Users may update
+// themselves, updating somebody else takes the user:write permission at one of their branches.
+func (ctl *Controller) UpdateUser() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		userId := c.Param("user_id")
+
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
+		var body updateUserRequest
+		if err := c.BindJSON(&body); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		// keeping the user as it was for the audit log
+		before,err := ctl.repos.Users.Get(ctx,userId)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		if !canUpdateUser(c,before){
+			c.JSON(http.StatusForbidden,gin.H{"error":"only the user and the managers of their branches can update a user"})
+			return
+		}
+
+		var updateObj primitive.D
+		if body.First_name != nil{
+			updateObj = append(updateObj,bson.E{Key: "first_name",Value: body.First_name})
+		}
+		if body.Last_name != nil{
+			updateObj = append(updateObj,bson.E{Key: "last_name",Value: body.Last_name})
+		}
+		if body.Phone != nil{
+			if ctl.userTaken(ctx,c,ctl.repos.Users.GetByPhone,*body.Phone,"phone number",userId){
+				return
+			}
+			updateObj = append(updateObj,bson.E{Key: "phone",Value: body.Phone})
+		}
+		if body.Avatar != nil{
+			updateObj = append(updateObj,bson.E{Key: "avatar",Value: body.Avatar})
+		}
+		if len(updateObj) == 0{
+			c.JSON(http.StatusBadRequest,gin.H{"error":"nothing to update, send first_name, last_name, phone or avatar"})
+			return
+		}
+
+		updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj,bson.E{Key: "updated_at",Value: updated_at})
+
+		// the unique index on the phone number still answers 409 for a number taken meanwhile
+		result,err := ctl.repos.Users.Update(ctx,userId,version,updateObj)
+		if err != nil{
+			repositoryError(c,err,"user update failed, the phone number may belong to another user")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","update",userId,before,result)
+
+		c.Header("ETag",etag(result.Version))
+		c.JSON(http.StatusOK,newUserResponse(result))
+	}
+}
+
+// canUpdateUser reports whether the caller may update the user: the user themselves, an admin,
+// or a caller with the user:write permission who works at one of the branches of the user
+func canUpdateUser(c *gin.Context,user models.User) bool{
+	if user.User_id == c.GetString("uid") || middleware.IsAdmin(c){
+		return true
+	}
+	if !middleware.Can(c,middleware.UserWrite){
+		return false
+	}
+	if c.GetBool("any_branch"){
+		return true
+	}
+	for _,branch := range c.GetStringSlice("branches"){
+		for _,userBranch := range user.Branches{
+			if branch == userBranch{
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ChangePassword sets a new password for the user the token was issued to, once the current
+// one is confirmed. Every session of the user ends, the new password is used to log in again.
+// A wrong current password counts as a failed login, see loginController.go.
+func (ctl *Controller) ChangePassword() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		var body changePasswordRequest
+		if !bindBody(c,&body){
+			return
+		}
+		user,ok := ctl.currentUser(ctx,c)
+		if !ok{
+			return
+		}
+		if !ctl.confirmPassword(ctx,c,user,*body.Current_password){
+			return
+		}
+
+		password := HashPassword(*body.New_password)
+		updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		changes := primitive.D{
+			{Key: "password",Value: password},
+			{Key: "updated_at",Value: updated_at},
+		}
+		result,err := ctl.repos.Users.Update(ctx,user.User_id,0,changes)
+		if err != nil{
+			repositoryError(c,err,"password could not be changed")
+			return
+		}
+
+		// whoever else knew the old password is logged out
+		if err := ctl.revokeSessions(ctx,user.User_id); err != nil{
+			repositoryError(c,err,"password was changed but the sessions could not be revoked")
+			return
+		}
+		if err := ctl.repos.Logins.Clear(ctx,emailKey(*user.Email)); err != nil{
+			log.Printf("clearing the failed logins of user %s after a password change: %v",user.User_id,err)
+		}
+
+		ctl.audit(ctx,c,"user","change_password",user.User_id,user,result)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// confirmPassword checks the password of a logged in user before a change to their account.
+// A stolen token must not be a way around the throttling of the logins, so a wrong password
+// counts as a failed login. It answers the request itself when the password is refused.
+func (ctl *Controller) confirmPassword(ctx context.Context,c *gin.Context,user models.User,password string) bool{
+	if user.Email == nil || user.Password == nil{
+		c.JSON(http.StatusBadRequest,gin.H{"error":"the user has no password"})
+		return false
+	}
+
+	now := time.Now().UTC()
+	if !ctl.checkThrottles(ctx,c,*user.Email,now){
+		return false
+	}
+	if passwordValid,_ := verifyPassword(password,*user.Password); !passwordValid{
+		if err := ctl.loginFailed(ctx,c,*user.Email,now); err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while counting the failed attempt"})
+			return false
+		}
+		c.JSON(http.StatusForbidden,gin.H{"error":"the current password is incorrect"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+func TestProfile(t *testing.T){
+	ts := newTestServer(t)
+	waiter,token := ts.createUser("waiter@example.com",models.RoleWaiter)
+	_,colleague := ts.createUser("colleague@example.com",models.RoleWaiter)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+
+	w := ts.do(http.MethodGet,"/users/me",token,"")
+	me := expect(t,w,http.StatusOK)
+	if str(me,"user_id") != waiter.User_id || w.Header().Get("ETag") != `"1"`{
+		t.Errorf("expected the user of the token with its ETag, got %v %q",me,w.Header().Get("ETag"))
+	}
+	for _,field := range []string{"password","token","refresh_token","totp_secret","pin"}{
+		if _,ok := me[field]; ok{
+			t.Errorf("%s must not be answered, got %v",field,me)
+		}
+	}
+	_,key := ts.createAPIKey(admin,`"food:read"`)
+	expect(t,ts.do(http.MethodGet,"/users/me",key,""),http.StatusBadRequest)
+
+	path := "/users/" + waiter.User_id
+	expect(t,ts.do(http.MethodPatch,path,token,`{}`,"If-Match","*"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,path,token,`{"first_name":"A"}`,"If-Match","*"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPatch,path,token,`{"phone":"colleague@example.com-phone"}`,"If-Match","*"),http.StatusConflict)
+	// an email or a role can not be slipped into a profile update
+	me = expect(t,ts.do(http.MethodPatch,path,token,`{"first_name":"Sam","avatar":"sam.png","email":"x@example.com","roles":["admin"]}`,"If-Match",`"1"`),http.StatusOK)
+	if str(me,"first_name") != "Sam" || str(me,"avatar") != "sam.png" || str(me,"email") != "waiter@example.com"{
+		t.Errorf("expected the names and the avatar only to change, got %v",me)
+	}
+	if roles,_ := me["roles"].([]interface{}); len(roles) != 1 || roles[0] != models.RoleWaiter{
+		t.Errorf("expected the roles to stay, got %v",me)
+	}
+
+	expect(t,ts.do(http.MethodPatch,path,colleague,`{"last_name":"Smith"}`,"If-Match","*"),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPatch,path,manager,`{"last_name":"Smith"}`,"If-Match","*"),http.StatusOK)
+	expect(t,ts.do(http.MethodPatch,"/users/000000000000000000000000",admin,`{"last_name":"Smith"}`,"If-Match","*"),http.StatusNotFound)
+}
+
+func TestChangePassword(t *testing.T){
+	ts := newTestServer(t)
+	_,token := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	expect(t,ts.do(http.MethodPost,"/users/me/password",token,`{"current_password":"secret1","new_password":"short"}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/users/me/password",token,`{"current_password":"wrong1","new_password":"secret2"}`),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/users/me/password",token,`{"current_password":"secret1","new_password":"secret2"}`),http.StatusNoContent)
+
+	// every session ended with the old password
+	expect(t,ts.do(http.MethodGet,"/users/me",token,""),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/login","",`{"email":"waiter@example.com","password":"secret1"}`),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/login","",`{"email":"waiter@example.com","password":"secret2"}`),http.StatusOK)
+}
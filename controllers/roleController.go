@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"restaurant-backend/middleware"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetRoles lists the roles and the permissions Policy grants each of them, and every
+// permission an api key can be given as a scope
+func (ctl *Controller) GetRoles() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		permissions := map[string][]string{}
+		for _,role := range models.Roles{
+			permissions[role] = []string{}
+		}
+		scopes := []string{}
+		for permission,roles := range middleware.Policy{
+			scopes = append(scopes,permission)
+			for _,role := range roles{
+				permissions[role] = append(permissions[role],permission)
+			}
+		}
+		// admins are granted everything without being listed
+		permissions[models.RoleAdmin] = []string{"*"}
+
+		sort.Strings(scopes)
+
+		c.JSON(http.StatusOK,gin.H{"roles":models.Roles,"permissions":permissions,"scopes":scopes})
+	}
+}
+
+// userRoles is the body of SetUserRoles
+type userRoles struct {
+	Roles []string `json:"roles" validate:"required"`
+}
+
+// SetUserRoles replaces the roles of a user and signs them out, they log in again
+// for the new roles to be part of their token.
+func (ctl *Controller) SetUserRoles() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		// roles are given across branches like the memberships
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
+		defer cancel()
+
+		userId := c.Param("user_id")
+
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
+
+		var body userRoles
+		if err := c.BindJSON(&body); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+		for _,role := range body.Roles{
+			if !models.IsRole(role){
+				c.JSON(http.StatusBadRequest,gin.H{"error":fmt.Sprintf("unknown role %q",role)})
+				return
+			}
+		}
+
+		updatedAt,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+		updateObj := primitive.D{
+			{Key: "roles",Value: body.Roles},
+			{Key: "updated_at",Value: updatedAt},
+		}
+
+		before,err := ctl.repos.Users.Get(ctx,userId)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		result,err := ctl.repos.Users.Update(ctx,userId,version,updateObj)
+		if err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+		// the tokens issued before carry the old roles
+		if err := ctl.revokeSessions(ctx,userId); err != nil{
+			repositoryError(c,err,"roles were changed but the sessions could not be revoked")
+			return
+		}
+
+		ctl.audit(ctx,c,"user","update",userId,before,result)
+
+		c.Header("ETag",etag(result.Version))
+		c.JSON(http.StatusOK,newUserResponse(result))
+	}
+}
@@ -0,0 +1,66 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+func TestRolesAreEnforced(t *testing.T){
+	ts := newTestServer(t)
+	_,kitchen := ts.createUser("kitchen@example.com",models.RoleKitchen)
+	_,cashier := ts.createUser("cashier@example.com",models.RoleCashier)
+	_,nobody := ts.createUser("nobody@example.com")
+
+	expect(t,ts.do(http.MethodGet,"/foods",kitchen,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/foods",kitchen,`{}`),http.StatusForbidden)
+	expect(t,ts.do(http.MethodGet,"/tables",kitchen,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodGet,"/audit",kitchen,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodGet,"/invoices",cashier,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/orders",cashier,`{}`),http.StatusForbidden)
+	// a user without roles can not do anything
+	expect(t,ts.do(http.MethodGet,"/foods",nobody,""),http.StatusForbidden)
+}
+
+func TestRoleRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	waiter,waiterToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	roles := expect(t,ts.do(http.MethodGet,"/roles",waiterToken,""),http.StatusOK)
+	if list,_ := roles["roles"].([]interface{}); len(list) != len(models.Roles){
+		t.Errorf("expected every role to be listed, got %v",roles)
+	}
+	permissions,_ := roles["permissions"].(map[string]interface{})
+	if admin,_ := permissions[models.RoleAdmin].([]interface{}); len(admin) != 1 || admin[0] != "*"{
+		t.Errorf("expected admins to be granted everything, got %v",permissions)
+	}
+
+	path := "/users/" + waiter.User_id + "/roles"
+	expect(t,ts.do(http.MethodPut,path,waiterToken,`{"roles":["admin"]}`,"If-Match","*"),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPut,path,admin,`{"roles":["chef"]}`,"If-Match","*"),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPut,"/users/000000000000000000000000/roles",admin,`{"roles":["waiter"]}`,"If-Match","*"),http.StatusNotFound)
+
+	user := expect(t,ts.do(http.MethodPut,path,admin,`{"roles":["waiter","cashier"]}`,"If-Match","*"),http.StatusOK)
+	if list,_ := user["roles"].([]interface{}); len(list) != 2{
+		t.Errorf("expected the user to have two roles, got %v",user)
+	}
+	if _,ok := user["password"]; ok{
+		t.Errorf("the password must not be answered, got %v",user)
+	}
+}
+
+func TestRoleAndBranchChangesSignTheUserOut(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	waiter,waiterToken := ts.createUser("waiter@example.com",models.RoleWaiter)
+	cashier,cashierToken := ts.createUser("cashier@example.com",models.RoleCashier)
+
+	expect(t,ts.do(http.MethodGet,"/foods",waiterToken,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPut,"/users/" + waiter.User_id + "/roles",admin,`{"roles":["kitchen"]}`,"If-Match","*"),http.StatusOK)
+	expect(t,ts.do(http.MethodGet,"/foods",waiterToken,""),http.StatusUnauthorized)
+
+	expect(t,ts.do(http.MethodGet,"/foods",cashierToken,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPut,"/users/" + cashier.User_id + "/branches",admin,`{"branches":["` + ts.branch + `"]}`,"If-Match","*"),http.StatusOK)
+	expect(t,ts.do(http.MethodGet,"/foods",cashierToken,""),http.StatusUnauthorized)
+}
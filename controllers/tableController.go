@@ -3,79 +3,69 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"restaurant-backend/database"
 	"restaurant-backend/models"
+	"restaurant-backend/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // gin.HandlerFunc represent a request handler in gin
 // func(ctx *gin.Context) represents the actual request handler for the routes
 // [ctx *gin.Context] represents the actual parameters for the current HTTP request and response
 
-// creating a table collection in the database
-var tableCollection *mongo.Collection = database.OpenCollection(database.Client,"table")
-
-func GetTables() gin.HandlerFunc{
+func (ctl *Controller) GetTables() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-
-	    // Retrieving the tableCollection data from the database and mapping the into the bson document
-		result,err := tableCollection.Find(context.TODO(),bson.M{})
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
 		// cancelling the resources context until the functions exits
 		defer cancel()
+
+	    // Retrieving all the tables from the table repository
+		allTables,_,err := ctl.repos.Tables.List(ctx,repository.ListOptions{})
 		if err != nil{
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing table items"})
+			return
 		}
 
-		// creating a slice to store the retrieved data fromthe table collection
-		var allTables []bson.M
-		if err = result.All(ctx,&allTables); err != nil{
-			log.Fatal(err)
-		}
-
-		// returning the table collection data in a JSON response
+		// returning the tables in a JSON response
 		c.JSON(http.StatusOK,allTables)
 	}
 }
 
-func GetTable() gin.HandlerFunc{
+func (ctl *Controller) GetTable() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// cancelling the context resources until the function exits
+		defer cancel()
 
-		// creating an instance of the table struct
-		var table models.Table
 		// retrieving the table_id from the http request
 		tableId := c.Param("table_id")
 
-		// querying the database to find the document that matches the table_id
-		err := tableCollection.FindOne(ctx,bson.M{"table_id":tableId}).Decode(&table)
-		// cancelling the context resources until the function exits 
-		defer cancel()
+		// querying the repository to find the table that matches the table_id
+		table,err := ctl.repos.Tables.Get(ctx,tableId)
 		if err != nil{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"error when getting a table"})
+			repositoryError(c,err,"error when getting a table")
 			return
 		}
 
 		// returning a JSON response for document that matched the table id
+		c.Header("ETag",etag(table.Version))
 		c.JSON(http.StatusOK,table)
 
 	}
 }
 
-func CreateTable() gin.HandlerFunc{
+func (ctl *Controller) CreateTable() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a time context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// canceling the context resources until the the function exits
+		defer cancel()
 
 		// creating an instance of the table struct
 		var table models.Table
@@ -102,32 +92,43 @@ func CreateTable() gin.HandlerFunc{
 		// initializing the table id in a hexadecimal representation
 		table.ID = primitive.NewObjectID()
 		table.Table_id = table.ID.Hex()
+		table.Version = 1
+		// the document belongs to the branch the request works on
+		table.Branch_id = c.GetString("branch_id")
 
-		// inserting the table document into the table collection
-		result,insertErr := tableCollection.InsertOne(ctx,table)
+		// inserting the table into the table repository
+		insertErr := ctl.repos.Tables.Create(ctx,table)
 		if insertErr != nil{
 			msg := fmt.Sprintf("Table item was not created")
 			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
 			return
 		}
 
-		// canceling the context resources until the the function exits
-		defer cancel()
+		ctl.audit(ctx,c,"table","create",table.Table_id,nil,table)
 
 		// returning the created table item as a JSON response
-		c.JSON(http.StatusOK,result)
+		c.Header("ETag",etag(table.Version))
+		c.JSON(http.StatusOK,table)
 	}
 }
 
-func UpdateTable() gin.HandlerFunc{
+func (ctl *Controller) UpdateTable() gin.HandlerFunc{
 	return func(c *gin.Context) {
 		// creating a context with a timeout of 100 seconds
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-		 
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		// deffering the cancellation of the context resources until the function exits
+		defer cancel()
+
 		// creating an instance of the table struct
 		var table models.Table
         // retrieving the table_id from the http request
 		tableId := c.Param("table_id")
+
+		// the caller has to send back the ETag it read, see ifMatch
+		version,ok := ifMatch(c)
+		if !ok{
+			return
+		}
         // extracting and decoding the http body to the table struct
 		if err := c.BindJSON(&table); err != nil{
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
@@ -151,38 +152,25 @@ func UpdateTable() gin.HandlerFunc{
 		table.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{Key: "updated_at",Value: table.Updated_at})
 
-		// setting the operation of update and insert to true 
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+        // updating the table with the corresponding ID in the repository
+		before,err := ctl.repos.Tables.Get(ctx,tableId)
+		if err != nil{
+			repositoryError(c,err,"table was not found")
+			return
 		}
-
-		// creating a filter to select the document which should be updated
-		filter := bson.M{"table_id":tableId}
-        // updating the document with the corresponding ID in the database
-		result,err := tableCollection.UpdateOne(
-			// context
-			ctx,
-			// document to update
-			filter,
-			// updating the document using the set operator
-			bson.D{
-				{Key: "$set",Value: updateObj},
-			},
-			// providing the upsert optinks behaviour
-			&opt,
-		)
+		result,err := ctl.repos.Tables.Update(ctx,tableId,version,updateObj)
 
 		// handling the error
 		if err != nil{
 			msg := fmt.Sprintf("table item update failed")
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+			repositoryError(c,err,msg)
 			return
 		}
 
-		// deffering the cancellation of the context resources until the function exits
-		defer cancel()
-		// returning the updated document result as a JSON response
+		ctl.audit(ctx,c,"table","update",tableId,before,result)
+
+		// returning the updated table as a JSON response
+		c.Header("ETag",etag(result.Version))
 		c.JSON(http.StatusOK,result)
 	}
-}
\ No newline at end of file
+}
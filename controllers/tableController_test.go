@@ -0,0 +1,36 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"testing"
+)
+
+// createTable creates a table through the API and returns its id
+func (ts *testServer) createTable(token string) string{
+	ts.t.Helper()
+	table := expect(ts.t,ts.do(http.MethodPost,"/tables",token,`{"number_of_guests":4,"table_number":7}`),http.StatusOK)
+	return str(table,"table_id")
+}
+
+func TestTableRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+
+	expect(t,ts.do(http.MethodPost,"/tables",manager,`{"number_of_guests":4}`),http.StatusBadRequest)
+	tableId := ts.createTable(manager)
+
+	table := expect(t,ts.do(http.MethodGet,"/tables/" + tableId,manager,""),http.StatusOK)
+	if table["table_number"] != float64(7){
+		t.Errorf("expected table 7, got %v",table)
+	}
+	expect(t,ts.do(http.MethodGet,"/tables/nope",manager,""),http.StatusNotFound)
+	if tables := expectList(t,ts.do(http.MethodGet,"/tables",manager,""),http.StatusOK); len(tables) != 1{
+		t.Errorf("expected one table, got %v",tables)
+	}
+
+	table = expect(t,ts.do(http.MethodPatch,"/tables/" + tableId,manager,`{"number_of_guests":6}`,"If-Match",`"1"`),http.StatusOK)
+	if table["number_of_guests"] != float64(6){
+		t.Errorf("expected 6 guests, got %v",table)
+	}
+}
@@ -2,19 +2,18 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"restaurant-backend/database"
 	helper "restaurant-backend/helpers"
+	"restaurant-backend/middleware"
 	"restaurant-backend/models"
-	"strconv"
+	"restaurant-backend/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,75 +21,136 @@ import (
 // func(ctx *gin.Context) represents the actual request handler for the routes
 // [ctx *gin.Context] represents the actual parameters for the current HTTP request and response
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client,"users")
+// userResponse is a user as it is sent to clients: the password hash, the tokens and the
+// token family stay on the server
+type userResponse struct {
+	ID                   primitive.ObjectID
+	First_name           *string                 `json:"first_name"`
+	Last_name            *string                 `json:"last_name"`
+	Email                *string                 `json:"email"`
+	Email_verified_at    *time.Time              `json:"email_verified_at"`
+	Mfa_enabled_at       *time.Time              `json:"mfa_enabled_at"`
+	// how many recovery codes are left, only sent while two-factor authentication is on
+	Mfa_recovery_codes_left *int                 `json:"mfa_recovery_codes_left,omitempty"`
+	Pin_set_at           *time.Time              `json:"pin_set_at"`
+	Avatar               *string                 `json:"avatar"`
+	Phone                *string                 `json:"phone"`
+	Created_at           time.Time               `json:"created_at"`
+	Updated_at           time.Time               `json:"updated_at"`
+	Deleted_at           *time.Time              `json:"deleted_at,omitempty"`
+	Version              int64                   `json:"version"`
+	User_id              string                  `json:"user_id"`
+	Branches             []string                `json:"branches"`
+	Roles                []string                `json:"roles"`
+}
 
-func GetUsers() gin.HandlerFunc{
-	return func(c *gin.Context) {
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+// sessionResponse answers a sign up or a login, the user with the tokens just issued to them
+type sessionResponse struct {
+	userResponse
+	Token                string                  `json:"token"`
+	Refresh_token        string                  `json:"refresh_token"`
+	// set when some roles of the user only count once two-factor authentication is on
+	Mfa_enrollment_required bool                 `json:"mfa_enrollment_required,omitempty"`
+}
 
-		recordPerPage,rpgError := strconv.Atoi(c.Query("recordPerPage"))
-		if rpgError != nil || recordPerPage < 1{
-			recordPerPage = 10
-		}
+func newUserResponse(user models.User) userResponse{
+	var recoveryCodesLeft *int
+	if user.Mfa_enabled_at != nil{
+		left := len(user.Mfa_recovery_codes)
+		recoveryCodesLeft = &left
+	}
+	return userResponse{
+		ID: user.ID,
+		First_name: user.First_name,
+		Last_name: user.Last_name,
+		Email: user.Email,
+		Email_verified_at: user.Email_verified_at,
+		Mfa_enabled_at: user.Mfa_enabled_at,
+		Mfa_recovery_codes_left: recoveryCodesLeft,
+		Pin_set_at: user.Pin_set_at,
+		Avatar: user.Avatar,
+		Phone: user.Phone,
+		Created_at: user.Created_at,
+		Updated_at: user.Updated_at,
+		Deleted_at: user.Deleted_at,
+		Version: user.Version,
+		User_id: user.User_id,
+		Branches: user.Branches,
+		Roles: user.Roles,
+	}
+}
 
-		page, pageError := strconv.Atoi(c.Query("page"))
-		if pageError != nil || page < 1{
-			page = 1
-		}
+func newUserResponses(users []models.User) []userResponse{
+	responses := make([]userResponse,0,len(users))
+	for _,user := range users{
+		responses = append(responses,newUserResponse(user))
+	}
+	return responses
+}
 
-		startIndex := (page-1)* recordPerPage
-		startIndex,_ = strconv.Atoi(c.Query("startIndex"))
+func (ctl *Controller) GetUsers() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
 
-		matchStage := bson.D{{Key: "$match",Value: bson.D{{}}}}
-		projectStage := bson.D{
-			{Key: "$project",Value: bson.D{
-				{Key: "_id",Value: 0},
-				{Key: "total_count",Value: 1},
-				{Key: "user_items",Value: bson.D{{Key: "$slice",Value: []interface{}{"$data",startIndex,recordPerPage}}}},
-			}},
-		}
+		opts := pagination(c)
 
-		result,err := userCollection.Aggregate(ctx,mongo.Pipeline{
-			matchStage,
-			projectStage,
-		})
-		defer cancel()
+		allUsers,total,err := ctl.repos.Users.List(ctx,opts)
 		if err != nil{
 			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing user items"})
 			return
 		}
 
-		var allUsers []bson.M
-		if err = result.All(ctx,&allUsers); err != nil{
-			log.Fatal(err)
-		}
-		
-		c.JSON(http.StatusOK,allUsers[0])
+		c.JSON(http.StatusOK,gin.H{"total_count":total,"user_items":newUserResponses(allUsers)})
 	}
 }
 
-func GetUser() gin.HandlerFunc{
+func (ctl *Controller) GetUser() gin.HandlerFunc{
 	return func(c *gin.Context) {
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-		userId := c.Param("user_id")
-
-		var user models.User
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
 
-		err := userCollection.FindOne(ctx,bson.M{"user_id":userId}).Decode(&user)
+		userId := c.Param("user_id")
 
-		defer cancel()
+		user,err := ctl.repos.Users.Get(ctx,userId)
 		if err != nil{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while listing user items"})
+			repositoryError(c,err,"error occured while listing user items")
 			return
 		}
 
-		c.JSON(http.StatusOK,user)        
+		c.Header("ETag",etag(user.Version))
+		c.JSON(http.StatusOK,newUserResponse(user))
+	}
+}
+
+// userTaken answers 409 when a user other than userId has the email or phone number. The
+// unique indexes count the deleted users as well so that they can always be restored, such
+// a user is named as deleted rather than failing the write.
+func (ctl *Controller) userTaken(ctx context.Context,c *gin.Context,find func(context.Context,string) (models.User,error),value string,field string,userId string) bool{
+	found,err := find(repository.WithDeleted(ctx),value)
+	if errors.Is(err,repository.ErrNotFound){
+		return false
+	}
+	if err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking for the " + field})
+		return true
+	}
+	if found.User_id == userId{
+		return false
 	}
+	if found.Deleted_at != nil{
+		c.JSON(http.StatusConflict,gin.H{"error":fmt.Sprintf("this %s belongs to a deleted user, an admin can restore or purge that user",field)})
+		return true
+	}
+	c.JSON(http.StatusConflict,gin.H{"error":fmt.Sprintf("this %s already exists",field)})
+	return true
 }
 
-func SignUp() gin.HandlerFunc{
+func (ctl *Controller) SignUp() gin.HandlerFunc{
 	return func(c *gin.Context) {
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
 		var user models.User
 
 		// convert the JSON data coming from postman to something golang understands
@@ -107,99 +167,309 @@ func SignUp() gin.HandlerFunc{
 		}
 
 		// You'll check if the email has already been used by another user
-  
-		emailCount,err := userCollection.CountDocuments(ctx,bson.M{"email":user.Email})
-		defer cancel()
-		if err != nil{
-			c.JSON(http.StatusInternalServerError,gin.H{"erro":"error occured while checking for the email"})
+		if ctl.userTaken(ctx,c,ctl.repos.Users.GetByEmail,*user.Email,"email",""){
 			return
 		}
 
-		if emailCount > 0{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"this email already exists"})
-		}
 		// hash password
 
 		password := HashPassword(*user.Password)
 		user.Password = &password
 
-		if err := c.BindJSON(&user); err != nil{
-			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
-			return
-		}	// You'll also check if the phone number has already been used by another person
-
-		phoneCount,err := userCollection.CountDocuments(ctx,bson.M{"phone":user.Phone})
-		defer cancel()
-		if err != nil{
-			log.Panic(err)
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while checking for the phone number"})
+		// You'll also check if the phone number has already been used by another person
+		if ctl.userTaken(ctx,c,ctl.repos.Users.GetByPhone,*user.Phone,"phone number",""){
 			return
 		}
 
-		if phoneCount > 0{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"this phone number already exists"})
-		}
-
 		// Create some extra details for the user object - created_at,updated_at, ID
 		user.Created_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		user.Updated_at,_ = time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
+		user.Version = 1
+		// a new user works nowhere until an admin adds them to a branch
+		user.Branches = []string{}
+		// and may do nothing until an admin gives them a role
+		user.Roles = []string{}
+		// the email is verified through the link mailed below
+		user.Email_verified_at = nil
+		// two-factor authentication is turned on once logged in
+		user.Mfa_enabled_at = nil
+		// and so is the PIN
+		user.Pin_hash = nil
+		user.Pin_set_at = nil
 
 		// Generate token and refresh token(generate all tokens function helper)
-		token,refreshToken,_ := helper.GenerateAllTokens(*user.Email,*user.First_name,*user.Last_name,*&user.User_id)
+		family := helper.NewTokenFamily()
+		token,refreshToken,err := helper.GenerateAllTokens(user,family,false)
+		if err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while signing the tokens"})
+			return
+		}
 		user.Token = &token
 		user.Refresh_token = &refreshToken
+		user.Token_family = &family
 
-		// If all OK, then you insert this new user into the user collection
-		resultInsertionNumber,insertErr := userCollection.InsertOne(ctx,user)
+		// If all OK, then you insert this new user into the user repository
+		insertErr := ctl.repos.Users.Create(ctx,user)
 		if insertErr != nil{
 			msg := fmt.Sprintf("user item was not created")
-			c.JSON(http.StatusInternalServerError,gin.H{"email":msg})
+			repositoryError(c,insertErr,msg)
 			return
 		}
 
-		// returns status OK and send the result back
-		c.JSON(http.StatusOK,resultInsertionNumber)
+		// nobody is logged in yet when signing up, the new user is the actor
+		c.Set("uid",user.User_id)
+		ctl.audit(ctx,c,"user","create",user.User_id,nil,user)
+
+		// the user can still ask for another link when this one does not arrive
+		if err := ctl.sendVerification(ctx,user); err != nil{
+			log.Printf("mailing the email verification of user %s: %v",user.User_id,err)
+		}
+
+		// returns status OK and send the created user back with its tokens
+		c.Header("ETag",etag(user.Version))
+		c.JSON(http.StatusOK,sessionResponse{
+			userResponse: newUserResponse(user),
+			Token: token,
+			Refresh_token: refreshToken,
+			Mfa_enrollment_required: middleware.MFARequired(user.User_id,user.Roles),
+		})
 
 	}
 }
 
-func Login() gin.HandlerFunc{
+// Login answers with new tokens for the email and password. Failed logins are throttled,
+// see loginController.go, and every attempt goes to the login history of the user.
+func (ctl *Controller) Login() gin.HandlerFunc{
 	return func(c *gin.Context) {
-		var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
-		var user models.User
-		var foundUser models.User
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		var body loginRequest
 
 		// convert the login data from postman which is in JSON to golang readable format
-		if err := c.BindJSON(&user); err != nil{
+		if err := c.BindJSON(&body); err != nil{
 			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
 			return
 		}
+		if validationErr := validate.Struct(body); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
+		email,password := *body.Email,*body.Password
+
+		// refuse the attempt without looking at the password while the email or the ip has to wait
+		now := time.Now().UTC()
+		if !ctl.checkThrottles(ctx,c,email,now){
+			return
+		}
 
 		// find a user with that email and see if that user even exists
-		err := userCollection.FindOne(ctx,bson.M{"email":user.Email}).Decode(&foundUser)
+		foundUser,err := ctl.repos.Users.GetByEmail(ctx,email)
+		if err != nil && !errors.Is(err,repository.ErrNotFound){
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while looking the email up"})
+			return
+		}
+
+		// then you will verify the password, an unknown email fails the same way as a wrong password
+		reason := ""
+		if err != nil{
+			compareDummyHash(password)
+			reason = loginUnknownEmail
+		} else if passwordValid,_ := verifyPassword(password,*foundUser.Password); !passwordValid{
+			reason = loginWrongPassword
+		}
+
+		if reason != ""{
+			if err := ctl.loginFailed(ctx,c,email,now); err != nil{
+				c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while counting the failed login"})
+				return
+			}
+			ctl.recordLogin(ctx,c,email,foundUser.User_id,reason,now)
+			c.JSON(http.StatusUnauthorized,gin.H{"error":"email or password is incorrect"})
+			return
+		}
+
+		// with two-factor authentication the password only earns an mfa token, see LoginMFA
+		if foundUser.Mfa_enabled_at != nil{
+			mfaToken,err := helper.GenerateMFAToken(foundUser)
+			if err != nil{
+				c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while signing the tokens"})
+				return
+			}
+			c.JSON(http.StatusOK,gin.H{"mfa_required":true,"mfa_token":mfaToken})
+			return
+		}
+
+		ctl.startSession(ctx,c,foundUser,email,false,now)
+	}
+}
+
+// startSession answers a successful login with new tokens, mfa tells whether the login checked
+// a one-time code. Every login starts a new refresh token family.
+func (ctl *Controller) startSession(ctx context.Context,c *gin.Context,user models.User,email string,mfa bool,now time.Time){
+	// a successful login forgets the failures of the email, those of the ip run out on their own
+	if err := ctl.repos.Logins.Clear(ctx,emailKey(email)); err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while counting the login"})
+		return
+	}
+	ctl.recordLogin(ctx,c,email,user.User_id,"",now)
+
+	// if all goes well then you'll generate tokens
+	family := helper.NewTokenFamily()
+	tokens,refreshTokens,err := helper.GenerateAllTokens(user,family,mfa)
+	if err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while signing the tokens"})
+		return
+	}
+
+	// Update tokens - tokens and refresh token, a refresh token that was not stored can not be used
+	if err := helper.UpdateAllTokens(ctx,ctl.repos.Users,tokens,refreshTokens,family,user.User_id,0); err != nil{
+		c.JSON(http.StatusInternalServerError,gin.H{"error":"error occured while storing the tokens"})
+		return
+	}
+
+	// return OK, the user was read before the update and answers with the new tokens
+	c.JSON(http.StatusOK,sessionResponse{
+		userResponse: newUserResponse(user),
+		Token: tokens,
+		Refresh_token: refreshTokens,
+		Mfa_enrollment_required: !mfa && middleware.MFARequired(user.User_id,user.Roles),
+	})
+}
+
+// Logout revokes the token of the request and the refresh tokens of the user
+func (ctl *Controller) Logout() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
 		defer cancel()
-	    if err!= nil{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":"user not found, Enter correct email"})
+
+		// an api key is not logged out of, it is revoked
+		claims := middleware.Claims(c)
+		if claims == nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":"api keys are revoked with DELETE /api-keys/:key_id"})
+			return
+		}
+
+		uid := claims.Uid
+		revocation := models.Revocation{
+			ID: primitive.NewObjectID(),
+			Jti: claims.Id,
+			User_id: uid,
+			Expires_at: time.Unix(claims.ExpiresAt,0),
+		}
+		revocation.Created_at = revocationTime()
+
+		// a token issued before tokens had an id can only be revoked with all the others of the user
+		if revocation.Jti == ""{
+			revocation.Expires_at = revocation.Created_at.Add(helper.AccessTokenLifetime)
+		}
+
+		if err := ctl.repos.Revocations.Revoke(ctx,revocation); err != nil{
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"logout failed"})
 			return
 		}
+		// leaving a shared terminal ends the PIN token only, the user stays logged in on their other devices
+		if claims.Terminal == ""{
+			if err := helper.RevokeTokens(ctx,ctl.repos.Users,uid); err != nil && !errors.Is(err,repository.ErrNotFound){
+				c.JSON(http.StatusInternalServerError,gin.H{"error":"logout failed"})
+				return
+			}
+		}
 
-		// then you will verify the password
-		passwordValid, msg := verifyPassword(*user.Password,*foundUser.Password)
+		ctl.audit(ctx,c,"user","logout",uid,nil,nil)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RevokeSessions revokes every token issued to a user so far, for a lost device
+// or a member of staff who left
+func (ctl *Controller) RevokeSessions() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(repository.AllBranches(c.Request.Context()),100*time.Second)
 		defer cancel()
-		if passwordValid != true{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
+
+		userId := c.Param("user_id")
+		if _,err := ctl.repos.Users.Get(ctx,userId); err != nil{
+			repositoryError(c,err,"user was not found")
+			return
+		}
+
+		if err := ctl.revokeSessions(ctx,userId); err != nil{
+			repositoryError(c,err,"sessions could not be revoked")
+			return
 		}
 
-		// if all goes well then you'll generate tokens
-		tokens,refreshTokens,_ := helper.GenerateAllTokens(*foundUser.Email,*foundUser.First_name,*foundUser.Last_name,*&foundUser.User_id)
+		ctl.audit(ctx,c,"user","revoke",userId,nil,nil)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// revocationTime returns the time of a revocation rounded up to the next millisecond, the
+// database keeps no more of it. Every token issued before is older by its Issued_at, one
+// issued in the rest of that millisecond is taken for older as well.
+func revocationTime() time.Time{
+	return time.Now().UTC().Truncate(time.Millisecond).Add(time.Millisecond)
+}
+
+// revokeSessions revokes every access token issued to the user so far and forgets the refresh token
+func (ctl *Controller) revokeSessions(ctx context.Context,userId string) error{
+	revocation := models.Revocation{ID: primitive.NewObjectID(),User_id: userId}
+	revocation.Created_at = revocationTime()
+	// the last token issued before now expires by then
+	revocation.Expires_at = revocation.Created_at.Add(helper.AccessTokenLifetime)
+
+	if err := ctl.repos.Revocations.Revoke(ctx,revocation); err != nil{
+		return err
+	}
+	return helper.RevokeTokens(ctx,ctl.repos.Users,userId)
+}
+
+// refreshRequest is the body of Refresh
+type refreshRequest struct {
+	Refresh_token   string   `json:"refresh_token" validate:"required"`
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token,
+// the refresh token presented can not be used again
+func (ctl *Controller) Refresh() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		var ctx,cancel = context.WithTimeout(c.Request.Context(),100*time.Second)
+		defer cancel()
+
+		var body refreshRequest
+		if err := c.BindJSON(&body); err != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil{
+			c.JSON(http.StatusBadRequest,gin.H{"error":validationErr.Error()})
+			return
+		}
 
-		// Update tokens - tokens and refresh token
-		helper.UpdateAllTokens(tokens,refreshTokens,foundUser.User_id)
+		user,token,refreshToken,err := helper.RotateRefreshToken(ctx,ctl.repos.Users,body.Refresh_token)
+		switch {
+		case errors.Is(err,helper.ErrRefreshReused):
+			// somebody else holds a token of this family, the refresh tokens were forgotten
+			// and the access tokens already issued are revoked as well
+			if err := ctl.revokeSessions(ctx,user.User_id); err != nil{
+				repositoryError(c,err,"refresh token was already used but the sessions could not be revoked")
+				return
+			}
+			c.Set("uid",user.User_id)
+			ctl.audit(ctx,c,"user","revoke",user.User_id,nil,nil)
+			c.JSON(http.StatusUnauthorized,gin.H{"error":"refresh token was already used, log in again"})
+			return
+		case errors.Is(err,helper.ErrRefreshInvalid):
+			c.JSON(http.StatusUnauthorized,gin.H{"error":"refresh token is not valid, log in again"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError,gin.H{"error":"tokens could not be refreshed"})
+			return
+		}
 
-		// return OK
-		c.JSON(http.StatusOK,foundUser)
+		c.JSON(http.StatusOK,gin.H{"token":token,"refresh_token":refreshToken})
 	}
 }
 
@@ -215,11 +485,11 @@ func verifyPassword(userPassword string,providePassword string)(bool,string){
 	err := bcrypt.CompareHashAndPassword([]byte(providePassword),[]byte(userPassword))
 	check := true
 	msg := ""
-	
+
 	if err != nil{
 		msg = fmt.Sprintf("login password is incorrect")
 		check = false
 	}
 
 	return check,msg
-}
\ No newline at end of file
+}
@@ -0,0 +1,141 @@
+package controllers_test
+
+import (
+	"net/http"
+	"restaurant-backend/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserRoutes(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+
+	// signing up
+	expect(t,ts.do(http.MethodPost,"/users/signup","",`{"first_name":"Ann","email":"ann@example.com"}`),http.StatusBadRequest)
+	user := expect(t,ts.do(http.MethodPost,"/users/signup","",`{"first_name":"Ann","last_name":"Lee","password":"secret1","email":"ann@example.com","phone":"555-0100"}`),http.StatusOK)
+	userId := str(user,"user_id")
+	if userId == "" || str(user,"token") == "" || str(user,"refresh_token") == ""{
+		t.Fatalf("expected the new user with tokens, got %v",user)
+	}
+	if _,ok := user["password"]; ok{
+		t.Errorf("the password must not be answered, got %v",user)
+	}
+	expect(t,ts.do(http.MethodPost,"/users/signup","",`{"first_name":"Ann","last_name":"Lee","password":"secret1","email":"ann@example.com","phone":"555-0101"}`),http.StatusConflict)
+	expect(t,ts.do(http.MethodPost,"/users/signup","",`{"first_name":"Ann","last_name":"Lee","password":"secret1","email":"ann2@example.com","phone":"555-0100"}`),http.StatusConflict)
+
+	// logging in
+	expect(t,ts.do(http.MethodPost,"/users/login","",`{"email":"ann@example.com","password":"wrong1"}`),http.StatusUnauthorized)
+	session := expect(t,ts.do(http.MethodPost,"/users/login","",`{"email":"ann@example.com","password":"secret1"}`),http.StatusOK)
+	if str(session,"user_id") != userId || str(session,"token") == ""{
+		t.Errorf("expected a session of the user, got %v",session)
+	}
+
+	// a new user works at no branch yet, the manager sees the users of the branch
+	list := expect(t,ts.do(http.MethodGet,"/users",manager,""),http.StatusOK)
+	if list["total_count"] != float64(1){
+		t.Errorf("expected the manager alone at the branch, got %v",list)
+	}
+	managerUser,_ := ts.repos.Users.GetByEmail(ts.ctx(),"manager@example.com")
+	found := expect(t,ts.do(http.MethodGet,"/users/" + managerUser.User_id,manager,""),http.StatusOK)
+	if str(found,"email") != "manager@example.com"{
+		t.Errorf("expected the manager, got %v",found)
+	}
+	if _,ok := found["password"]; ok{
+		t.Errorf("the password must not be answered, got %v",found)
+	}
+	expect(t,ts.do(http.MethodGet,"/users/" + userId,manager,""),http.StatusNotFound)
+}
+
+func TestDeletedUsersKeepTheirEmailAndPhone(t *testing.T){
+	ts := newTestServer(t)
+	_,manager := ts.createUser("manager@example.com",models.RoleManager)
+	gone,_ := ts.createUser("gone@example.com",models.RoleWaiter)
+	if _,err := ts.repos.Users.Delete(ts.ctx(),gone.User_id); err != nil{
+		t.Fatal(err)
+	}
+
+	conflict := expect(t,ts.do(http.MethodPost,"/users/signup","",`{"first_name":"Ann","last_name":"Lee","password":"secret1","email":"gone@example.com","phone":"555-0100"}`),http.StatusConflict)
+	if !strings.Contains(str(conflict,"error"),"deleted user"){
+		t.Errorf("expected the conflict to name the deleted user, got %v",conflict)
+	}
+
+	managerUser,_ := ts.repos.Users.GetByEmail(ts.ctx(),"manager@example.com")
+	conflict = expect(t,ts.do(http.MethodPatch,"/users/" + managerUser.User_id,manager,`{"phone":"` + *gone.Phone + `"}`,"If-Match","*"),http.StatusConflict)
+	if !strings.Contains(str(conflict,"error"),"deleted user"){
+		t.Errorf("expected the conflict to name the deleted user, got %v",conflict)
+	}
+	// keeping one's own phone number is no conflict
+	expect(t,ts.do(http.MethodPatch,"/users/" + managerUser.User_id,manager,`{"phone":"` + *managerUser.Phone + `"}`,"If-Match","*"),http.StatusOK)
+}
+
+// login signs in with the password of createUser and returns the session
+func (ts *testServer) login(email string) map[string]interface{}{
+	ts.t.Helper()
+	return expect(ts.t,ts.do(http.MethodPost,"/users/login","",`{"email":"` + email + `","password":"secret1"}`),http.StatusOK)
+}
+
+func TestRefreshRotation(t *testing.T){
+	ts := newTestServer(t)
+	ts.createUser("waiter@example.com",models.RoleWaiter)
+
+	session := ts.login("waiter@example.com")
+	if str(session,"token") == "" || str(session,"refresh_token") == ""{
+		t.Fatalf("expected a login to answer both tokens, got %v",session)
+	}
+	expect(t,ts.do(http.MethodPost,"/users/refresh","",`{}`),http.StatusBadRequest)
+	expect(t,ts.do(http.MethodPost,"/users/refresh","",`{"refresh_token":"garbage"}`),http.StatusUnauthorized)
+	// an access token is not a refresh token
+	expect(t,ts.do(http.MethodPost,"/users/refresh","",`{"refresh_token":"` + str(session,"token") + `"}`),http.StatusUnauthorized)
+
+	first := str(session,"refresh_token")
+	rotated := expect(t,ts.do(http.MethodPost,"/users/refresh","",`{"refresh_token":"` + first + `"}`),http.StatusOK)
+	if str(rotated,"refresh_token") == "" || str(rotated,"refresh_token") == first{
+		t.Fatalf("expected a new refresh token, got %v",rotated)
+	}
+	expect(t,ts.do(http.MethodGet,"/foods",str(rotated,"token"),""),http.StatusOK)
+
+	// the first refresh token shows up again: the whole family is ended
+	expect(t,ts.do(http.MethodPost,"/users/refresh","",`{"refresh_token":"` + first + `"}`),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/refresh","",`{"refresh_token":"` + str(rotated,"refresh_token") + `"}`),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodGet,"/foods",str(rotated,"token"),""),http.StatusUnauthorized)
+}
+
+func TestLogout(t *testing.T){
+	ts := newTestServer(t)
+	user,_ := ts.createUser("waiter@example.com",models.RoleWaiter)
+	other := ts.token(user)
+
+	expect(t,ts.do(http.MethodPost,"/users/logout","",""),http.StatusUnauthorized)
+
+	session := ts.login("waiter@example.com")
+	token := str(session,"token")
+	expect(t,ts.do(http.MethodPost,"/users/logout",token,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodGet,"/foods",token,""),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/logout",token,""),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/refresh","",`{"refresh_token":"` + str(session,"refresh_token") + `"}`),http.StatusUnauthorized)
+
+	// the access tokens of the other devices keep working until they expire
+	expect(t,ts.do(http.MethodGet,"/foods",other,""),http.StatusOK)
+}
+
+func TestRevokeSessions(t *testing.T){
+	ts := newTestServer(t)
+	_,admin := ts.createUser("admin@example.com",models.RoleAdmin)
+	user,_ := ts.createUser("waiter@example.com",models.RoleWaiter)
+	session := ts.login("waiter@example.com")
+	token := str(session,"token")
+
+	expect(t,ts.do(http.MethodPost,"/users/" + user.User_id + "/revoke-sessions",token,""),http.StatusForbidden)
+	expect(t,ts.do(http.MethodPost,"/users/" + user.User_id + "/revoke-sessions",admin,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodGet,"/foods",token,""),http.StatusUnauthorized)
+	expect(t,ts.do(http.MethodPost,"/users/refresh","",`{"refresh_token":"` + str(session,"refresh_token") + `"}`),http.StatusUnauthorized)
+
+	// logging in again in the same second as the revocation gives a token that works
+	time.Sleep(2*time.Millisecond)
+	again := str(ts.login("waiter@example.com"),"token")
+	expect(t,ts.do(http.MethodGet,"/foods",again,""),http.StatusOK)
+	expect(t,ts.do(http.MethodPost,"/users/" + user.User_id + "/revoke-sessions",admin,""),http.StatusNoContent)
+	expect(t,ts.do(http.MethodGet,"/foods",again,""),http.StatusUnauthorized)
+}
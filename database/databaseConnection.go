@@ -3,52 +3,160 @@ package database
 // importing necessary packages
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"restaurant-backend/config"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-// a function that returns a mongo client pointer
-func DBinstance() *mongo.Client{
-	// initializing a connection string and printing it out
-	MongoDb := "mongodb://localhost:27017"
-	fmt.Println(MongoDb)
+// the connected mongodb client, set by Connect once the server answered a ping
+var Client *mongo.Client
 
-	// creating a new mongodb client using connection string to the mongodb server 
-	client, err := mongo.NewClient(options.Client().ApplyURI(MongoDb))
-	// logging the error and exiting the program if an error occurs
+// the name of the database every collection is opened from
+var DatabaseName = "restaurant"
+
+// Connect dials the mongodb server described by cfg and retries with an exponential
+// backoff until the server answers a ping or the retries are used up
+func Connect(ctx context.Context, cfg config.MongoConfig) (*mongo.Client, error) {
+	// building the client options from the configuration
+	opts, err := clientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// creating the client, this does not talk to the server yet
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("invalid mongodb configuration for %s: %w", redact(cfg.URI), err)
 	}
 
-	// setting a timer of 10 minutes to attempt connecting to the mongodb server
-	ctx,cancel := context.WithTimeout(context.Background(),10*time.Second)
+	backoff := cfg.RetryBackoff.Duration
+	for attempt := 1; ; attempt++ {
+		// pinging the primary to make sure the server is really reachable
+		pingCtx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout.Duration)
+		err = client.Ping(pingCtx, readpref.Primary())
+		cancel()
+		if err == nil {
+			break
+		}
 
-	// cancelling the context if the timer is over to prevent delays
-	defer cancel()
+		// giving up once all the attempts have been used
+		if attempt >= cfg.ConnectRetries {
+			_ = client.Disconnect(context.Background())
+			return nil, fmt.Errorf("could not connect to mongodb at %s after %d attempt(s): %w", redact(cfg.URI), attempt, err)
+		}
 
-	// connecting the context to a client(mongodb server) if successful and catching an error if it fails
-	err = client.Connect(ctx)
-	// loggs the error and exits the program if an error occurs
-	if err != nil{
-		log.Fatal(err)
+		log.Printf("mongodb at %s is not reachable yet (attempt %d of %d): %v, retrying in %s", redact(cfg.URI), attempt, cfg.ConnectRetries, err, backoff)
+
+		// waiting before the next attempt unless the caller gave up
+		select {
+		case <-ctx.Done():
+			_ = client.Disconnect(context.Background())
+			return nil, fmt.Errorf("connecting to mongodb at %s: %w", redact(cfg.URI), ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if cfg.MaxRetryBackoff.Duration > 0 && backoff > cfg.MaxRetryBackoff.Duration {
+			backoff = cfg.MaxRetryBackoff.Duration
+		}
 	}
 
-	// returning a client if a successful connection is established
-	fmt.Println("connected to mongodb")
-	return client
+	log.Printf("connected to mongodb at %s (database %q)", redact(cfg.URI), cfg.Database)
+	Client = client
+	DatabaseName = cfg.Database
+	return client, nil
 }
 
-// creating a global variable for the DBinstance with a mongodb client pointer
-var Client *mongo.Client = DBinstance()
+// Ping checks that the connected client still reaches the primary
+func Ping(ctx context.Context) error {
+	if Client == nil {
+		return fmt.Errorf("mongodb client is not connected")
+	}
+	return Client.Ping(ctx, readpref.Primary())
+}
+
+// clientOptions translates the configuration into mongo driver options
+func clientOptions(cfg config.MongoConfig) (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(cfg.URI)
+
+	// pool sizes and timeouts
+	if cfg.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(cfg.MaxPoolSize)
+	}
+	if cfg.MinPoolSize > 0 {
+		opts.SetMinPoolSize(cfg.MinPoolSize)
+	}
+	if cfg.ConnectTimeout.Duration > 0 {
+		opts.SetConnectTimeout(cfg.ConnectTimeout.Duration)
+	}
+	if cfg.ServerSelectionTimeout.Duration > 0 {
+		opts.SetServerSelectionTimeout(cfg.ServerSelectionTimeout.Duration)
+	}
+
+	// credentials given outside of the uri
+	if cfg.Username != "" {
+		opts.SetAuth(options.Credential{
+			Username:   cfg.Username,
+			Password:   cfg.Password,
+			AuthSource: cfg.AuthSource,
+		})
+	}
+
+	// tls settings
+	if cfg.TLS || cfg.TLSCAFile != "" || cfg.TLSCertificateKeyFile != "" {
+		tlsConfig := &tls.Config{InsecureSkipVerify: cfg.TLSInsecure}
+
+		if cfg.TLSCAFile != "" {
+			pem, err := os.ReadFile(cfg.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading mongodb tls ca file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("mongodb tls ca file %s contains no certificates", cfg.TLSCAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if cfg.TLSCertificateKeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.TLSCertificateKeyFile, cfg.TLSCertificateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading mongodb tls certificate key file: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid mongodb options: %w", err)
+	}
+	return opts, nil
+}
+
+// redact hides the password of a connection string before it is logged
+func redact(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "<unparseable uri>"
+	}
+	return parsed.Redacted()
+}
 
 // function that receives two argunments a pointer and a string and returns a pointer to a collection
-func OpenCollection(client *mongo.Client,collectionName string) *mongo.Collection{
-	// retrieving a specified collection form the restaurant database using the provided client
-    var collection *mongo.Collection = client.Database("restaurant").Collection(collectionName)
+func OpenCollection(client *mongo.Client, collectionName string) *mongo.Collection {
+	// retrieving a specified collection form the configured database using the provided client
+	var collection *mongo.Collection = client.Database(DatabaseName).Collection(collectionName)
 	// returning the collection
 	return collection
-}
\ No newline at end of file
+}
@@ -8,7 +8,7 @@ require (
 	github.com/go-playground/validator/v10 v10.17.0
 	go.mongodb.org/mongo-driver v1.13.1
 	golang.org/x/crypto v0.18.0
-
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -42,5 +42,4 @@ require (
 	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
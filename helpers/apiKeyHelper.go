@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"strings"
+)
+
+// APIKeyPrefix starts every api key, it tells them apart from the tokens of the users
+const APIKeyPrefix = "rk_"
+
+// NewAPIKey returns the key handed to the device once, "rk_<key id>_<secret>", and the hash
+// of its secret that is stored instead
+func NewAPIKey(keyId string)(key string,secretHash string){
+	b := make([]byte,32)
+	if _,err := rand.Read(b); err != nil{
+		log.Panic(err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	return APIKeyPrefix + keyId + "_" + secret,HashSecret(secret)
+}
+
+// ParseAPIKey splits a key made by NewAPIKey into the id of the key and its secret
+func ParseAPIKey(key string)(keyId string,secret string,ok bool){
+	if !strings.HasPrefix(key,APIKeyPrefix){
+		return "","",false
+	}
+	// the id is hex, the secret base64url which may contain "_" as well
+	keyId,secret,ok = strings.Cut(strings.TrimPrefix(key,APIKeyPrefix),"_")
+	if !ok || keyId == "" || secret == ""{
+		return "","",false
+	}
+	return keyId,secret,true
+}
+
+// CheckAPIKeySecret compares a secret with the stored hash in constant time
+func CheckAPIKeySecret(secret string,secretHash string) bool{
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)),[]byte(secretHash)) == 1
+}
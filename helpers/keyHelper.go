@@ -0,0 +1,246 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// the smallest RSA key accepted for signing or verifying tokens
+const minRSABits = 2048
+
+// SigningMethodEdDSA signs tokens with an Ed25519 key, the jwt library only knows RSA, ECDSA and HMAC
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+type signingMethodEdDSA struct{}
+
+func init(){
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(),func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string{
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string,key interface{}) (string,error){
+	privateKey,ok := key.(ed25519.PrivateKey)
+	if !ok{
+		return "",jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey,[]byte(signingString))),nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString string,signature string,key interface{}) error{
+	publicKey,ok := key.(ed25519.PublicKey)
+	if !ok{
+		return jwt.ErrInvalidKeyType
+	}
+	sig,err := jwt.DecodeSegment(signature)
+	if err != nil{
+		return err
+	}
+	if !ed25519.Verify(publicKey,[]byte(signingString),sig){
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// signingKey is one key of the ring, Private is nil for a key that is only kept to verify
+// the tokens it signed before it was retired
+type signingKey struct {
+	Kid string
+	Method jwt.SigningMethod
+	Private crypto.Signer
+	Public crypto.PublicKey
+}
+
+// KeyRing holds the keys tokens are verified with and the one new tokens are signed with.
+// Every key is known by its kid, the name of its file without the extension, and every
+// token carries the kid of its key in its header.
+type KeyRing struct {
+	keys map[string]*signingKey
+	signing *signingKey
+}
+
+// Keys is the key ring tokens are signed and verified with, it is loaded at startup
+var Keys *KeyRing
+
+// ErrUnknownKey is returned for a token signed with a key that is not on the ring
+var ErrUnknownKey = errors.New("token was signed with an unknown key")
+
+// LoadKeyRing reads every .pem file of the directory. A file holds an RSA or Ed25519
+// private key, or only the public key of a retired key. New tokens are signed with the
+// key named signingKid, which may be left empty when the directory has one private key.
+func LoadKeyRing(dir string,signingKid string) (*KeyRing,error){
+	files,err := filepath.Glob(filepath.Join(dir,"*.pem"))
+	if err != nil{
+		return nil,err
+	}
+	ring := &KeyRing{keys: map[string]*signingKey{}}
+	for _,file := range files{
+		key,err := readKey(file)
+		if err != nil{
+			return nil,fmt.Errorf("%s: %w",file,err)
+		}
+		ring.keys[key.Kid] = key
+	}
+	if len(ring.keys) == 0{
+		return nil,fmt.Errorf("no keys in %s, add a .pem file with a private key",dir)
+	}
+
+	if signingKid == ""{
+		for _,key := range ring.keys{
+			if key.Private == nil{
+				continue
+			}
+			if ring.signing != nil{
+				return nil,fmt.Errorf("%s has several private keys, name the one to sign with",dir)
+			}
+			ring.signing = key
+		}
+		if ring.signing == nil{
+			return nil,fmt.Errorf("%s has no private key to sign with",dir)
+		}
+		return ring,nil
+	}
+
+	key,ok := ring.keys[signingKid]
+	if !ok{
+		return nil,fmt.Errorf("the signing key %q is not in %s",signingKid,dir)
+	}
+	if key.Private == nil{
+		return nil,fmt.Errorf("the signing key %q has no private key",signingKid)
+	}
+	ring.signing = key
+	return ring,nil
+}
+
+// readKey parses the first PEM block of a file
+func readKey(file string) (*signingKey,error){
+	content,err := os.ReadFile(file)
+	if err != nil{
+		return nil,err
+	}
+	block,_ := pem.Decode(content)
+	if block == nil{
+		return nil,fmt.Errorf("no PEM block found")
+	}
+
+	var parsed interface{}
+	switch block.Type{
+	case "PRIVATE KEY":
+		parsed,err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed,err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed,err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed,err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil,fmt.Errorf("unsupported PEM block %q",block.Type)
+	}
+	if err != nil{
+		return nil,err
+	}
+
+	key := &signingKey{Kid: strings.TrimSuffix(filepath.Base(file),filepath.Ext(file))}
+	switch k := parsed.(type){
+	case *rsa.PrivateKey:
+		key.Method,key.Private,key.Public = jwt.SigningMethodRS256,k,&k.PublicKey
+	case *rsa.PublicKey:
+		key.Method,key.Public = jwt.SigningMethodRS256,k
+	case ed25519.PrivateKey:
+		key.Method,key.Private,key.Public = SigningMethodEdDSA,k,k.Public()
+	case ed25519.PublicKey:
+		key.Method,key.Public = SigningMethodEdDSA,k
+	default:
+		return nil,fmt.Errorf("unsupported key type %T, use RSA or Ed25519",parsed)
+	}
+	if rsaKey,ok := key.Public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSABits{
+		return nil,fmt.Errorf("RSA key has %d bits, at least %d are needed",rsaKey.N.BitLen(),minRSABits)
+	}
+	return key,nil
+}
+
+// SigningKid returns the kid of the key new tokens are signed with
+func (ring *KeyRing) SigningKid() string{
+	return ring.signing.Kid
+}
+
+// sign signs the claims with the signing key and names the key in the kid header
+func (ring *KeyRing) sign(claims jwt.Claims) (string,error){
+	if ring == nil{
+		return "",errors.New("no signing keys were loaded")
+	}
+	token := jwt.NewWithClaims(ring.signing.Method,claims)
+	token.Header["kid"] = ring.signing.Kid
+	return token.SignedString(ring.signing.Private)
+}
+
+// verificationKey is the jwt.Keyfunc of the ring: it picks the key named by the kid header
+// and refuses a token whose algorithm is not the one of that key
+func (ring *KeyRing) verificationKey(t *jwt.Token) (interface{},error){
+	if ring == nil{
+		return nil,errors.New("no signing keys were loaded")
+	}
+	kid,_ := t.Header["kid"].(string)
+	key,ok := ring.keys[kid]
+	if !ok{
+		return nil,ErrUnknownKey
+	}
+	if t.Method.Alg() != key.Method.Alg(){
+		return nil,fmt.Errorf("unexpected signing method %v",t.Header["alg"])
+	}
+	return key.Public,nil
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of the ring, ordered by kid, for the clients that verify tokens
+func (ring *KeyRing) JWKS() []JWK{
+	keys := []JWK{}
+	for _,key := range ring.keys{
+		jwk := JWK{Kid: key.Kid,Use: "sig",Alg: key.Method.Alg()}
+		switch public := key.Public.(type){
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		keys = append(keys,jwk)
+	}
+	sort.Slice(keys,func(i,j int) bool {
+		return keys[i].Kid < keys[j].Kid
+	})
+	return keys
+}
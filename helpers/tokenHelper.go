@@ -2,16 +2,26 @@ package helpers
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"log"
-	"os"
-	"restaurant-backend/database"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the kinds of token, only an access token can call the api. An mfa token is handed out
+// once the password of a user with two-factor authentication was checked, it can only be
+// exchanged for the other tokens together with a one-time code.
+const (
+	AccessToken = "access"
+	RefreshToken = "refresh"
+	MFAToken = "mfa"
 )
 
 // Defines a struct with the below details and embeds jwt.
@@ -20,52 +30,105 @@ type SignedDetails struct{
 	First_name string
 	Last_name string
 	Uid string
+	// the branches the user works at, the requests of the user are scoped to one of them
+	Branches []string
+	// the roles of the user, they decide which routes the user may call
+	Roles []string
+	// AccessToken or RefreshToken
+	Token_type string
+	// the refresh tokens rotated out of one login share a family, see RotateRefreshToken
+	Family string
+	// set when the login checked a one-time code, the roles that require two-factor
+	// authentication only count then
+	Mfa bool
+	// the api key of the shared terminal a PIN token was issued on, see GeneratePinToken
+	Terminal string
+	// when the token was issued in milliseconds, iat only counts whole seconds and would take a
+	// token issued in the second of a revocation of all the tokens of the user for an older one
+	Issued_at int64
 	jwt.StandardClaims
 }
-// creates a user collection in the database
-var userCollection *mongo.Collection = database.OpenCollection(database.Client,"user")
-// value retrieved from the environment variable
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
 
-// function that takes four arguments and returns 3 values
-func GenerateAllTokens(email string,firstName string,lastName string,uid string)(signedToken string,signedRefreshToken string, err error){
+// IssuedTime returns when the token was issued, to the second for a token without Issued_at
+func (claims *SignedDetails) IssuedTime() time.Time{
+	if claims.Issued_at != 0{
+		return time.UnixMilli(claims.Issued_at)
+	}
+	return time.Unix(claims.IssuedAt,0)
+}
+
+// how long the tokens are valid
+const (
+	AccessTokenLifetime = 24*time.Hour
+	RefreshTokenLifetime = 168*time.Hour
+	MFATokenLifetime = 5*time.Minute
+	PinTokenLifetime = 15*time.Minute
+)
+
+// ErrRefreshReused is returned when a refresh token that was already exchanged is presented again
+var ErrRefreshReused = errors.New("refresh token was already used")
+
+// ErrRefreshInvalid is returned for a refresh token that is malformed, expired or no longer current
+var ErrRefreshInvalid = errors.New("refresh token is not valid")
+
+// NewTokenFamily returns a random id for the refresh tokens of a new login
+func NewTokenFamily() string{
+	return randomId()
+}
+
+func randomId() string{
+	b := make([]byte,16)
+	if _,err := rand.Read(b); err != nil{
+		log.Panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// function that takes the user, the family of its refresh token and whether the login checked
+// a one-time code and returns 3 values
+func GenerateAllTokens(user models.User,family string,mfa bool)(signedToken string,signedRefreshToken string, err error){
 	// creates a variable of type *SignedDetails and initializes it with the received values
-	// sets the expiry time to 24hrs from the current time
+	// sets the expiry time to 24hrs from the current time. The id lets the token be revoked.
+	now := time.Now()
 	claims := &SignedDetails{
-		Email: email,
-		First_name: firstName,
-		Last_name: lastName,
-		Uid: uid,
+		Email: stringValue(user.Email),
+		First_name: stringValue(user.First_name),
+		Last_name: stringValue(user.Last_name),
+		Uid: user.User_id,
+		Branches: user.Branches,
+		Roles: user.Roles,
+		Token_type: AccessToken,
+		Mfa: mfa,
+		Issued_at: now.UnixMilli(),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Hour*time.Duration(24)).Unix(),
+			Id: randomId(),
+			IssuedAt: now.Unix(),
+			ExpiresAt: time.Now().Local().Add(AccessTokenLifetime).Unix(),
 		},
 	}
 
-    // creates a refreshClaims variable of type *SignedDetails with only Standardclaims initalized
-	// setting its expiration time to 168 hours
+	// creates a refreshClaims variable that only identifies the user and the family of the token
+	// setting its expiration time to 168 hours. The random id makes every refresh token unique.
 	refreshClaims := &SignedDetails{
+		Uid: user.User_id,
+		Token_type: RefreshToken,
+		Family: family,
+		Mfa: mfa,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Hour*time.Duration(168)).Unix(),
+			Id: randomId(),
+			ExpiresAt: time.Now().Local().Add(RefreshTokenLifetime).Unix(),
 		},
 	}
 
-	// Generates a JWT token and a refresh token using the claims and refresh claims respectively signed with the 
-	// HMAC-SHA256 algorithm
-	token,err := jwt.NewWithClaims(jwt.SigningMethodHS256,claims).SignedString([]byte(SECRET_KEY))
-
-    // panics the token err generation and logs it
+	// Generates a JWT token and a refresh token using the claims and refresh claims respectively signed with the
+	// signing key of the key ring, the kid header names the key
+	token,err := Keys.sign(claims)
 	if err != nil{
-		log.Panic(err)
 		return
 	}
 
-	// Generates a JWT token and a refresh token using the claims and refresh claims respectively signed with the 
-	// HMAC-SHA256 algorithm
-	refreshToken,rtErr := jwt.NewWithClaims(jwt.SigningMethodHS256,refreshClaims).SignedString([]byte(SECRET_KEY))
-
-	// panics the token err generation and logs it
-	if rtErr != nil {
-		log.Panic(rtErr)
+	refreshToken,err := Keys.sign(refreshClaims)
+	if err != nil{
 		return
 	}
 	
@@ -73,10 +136,13 @@ func GenerateAllTokens(email string,firstName string,lastName string,uid string)
 	return token,refreshToken,err
 }
 
-// A function that takes three arguments
-func UpdateAllTokens(signedToken string,signedRefreshToken string,userid string){
+// A function that stores the freshly generated tokens on the user with the given id.
+// A version other than 0 only stores them if the user was not changed since it was read.
+func UpdateAllTokens(ctx context.Context,users repository.UserRepository,signedToken string,signedRefreshToken string,family string,userid string,version int64) error{
 	// creating a context with a timeout of 100 seconds
-	var ctx,cancel = context.WithTimeout(context.Background(),100*time.Second)
+	ctx,cancel := context.WithTimeout(ctx,100*time.Second)
+	// ensures that context is canceled when the function completes, releasing anu resource associeted with it
+	defer cancel()
 
 	// creating a variable to track the bson document that is changed and store the changes
 	var updateObj primitive.D
@@ -85,66 +151,168 @@ func UpdateAllTokens(signedToken string,signedRefreshToken string,userid string)
 	// for the document.
 	updateObj = append(updateObj, bson.E{Key: "token",Value: signedToken})
 	updateObj = append(updateObj, bson.E{Key: "refresh_token",Value: signedRefreshToken})
+	updateObj = append(updateObj, bson.E{Key: "token_family",Value: family})
 
 	//The line retrieves the current time formats it to RFC3339 and then parses it back to time and adds a current time
 	Updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
 	updateObj = append(updateObj, bson.E{Key: "updated_at",Value: Updated_at})
 
-	// initializing an update and insert operation to true and using it in the update options
-	upsert := true
-	// creating a filter to the document we want to update which matches the id
-	filter := bson.M{"user_id":userid}
-	opt:= options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	// performs the update operations on the usercollection wiht all Operations in the updateObj
-	// uisng the set operator
-	_,err := userCollection.UpdateOne(
-		ctx,
-		filter,
-		bson.D{
-			{Key: "$set",Value: updateObj},
-		},
-		&opt,
-	)
-	
-	// ensures that context is canceled when the function completes, releasing anu resource associeted with it
-	defer cancel()
+	// performs the update operations on the user repository with all Operations in the updateObj
+	_,err := users.Update(ctx,userid,version,updateObj)
+	return err
+}
 
-	// logs and panics the error during the update operation
+// RotateRefreshToken exchanges a refresh token for a new access and refresh token of the same family.
+// Only the refresh token stored on the user is accepted. Presenting one of its predecessors means
+// the family leaked, so the whole family is revoked and ErrRefreshReused returned. The access
+// tokens issued to the user are still valid then, the caller records their revocation.
+func RotateRefreshToken(ctx context.Context,users repository.UserRepository,signedRefreshToken string)(user models.User,signedToken string,newRefreshToken string,err error){
+	claims,err := validateRefreshToken(signedRefreshToken)
 	if err != nil{
-		log.Panic(err)
-		return
+		return user,"","",err
 	}
+
+	user,err = users.Get(ctx,claims.Uid)
+	if errors.Is(err,repository.ErrNotFound){
+		return user,"","",ErrRefreshInvalid
+	}
+	if err != nil{
+		return user,"","",err
+	}
+
+	// a token of an older login, it was replaced by logging in again and not stolen
+	if user.Token_family == nil || *user.Token_family != claims.Family{
+		return user,"","",ErrRefreshInvalid
+	}
+	if user.Refresh_token == nil || *user.Refresh_token != signedRefreshToken{
+		return user,"","",reused(RevokeTokens(ctx,users,user.User_id))
+	}
+
+	signedToken,newRefreshToken,err = GenerateAllTokens(user,claims.Family,claims.Mfa)
+	if err != nil{
+		return user,"","",err
+	}
+	// two requests racing with the same token, only the first one gets a new pair
+	err = UpdateAllTokens(ctx,users,signedToken,newRefreshToken,claims.Family,user.User_id,user.Version)
+	if errors.Is(err,repository.ErrVersionConflict){
+		return user,"","",reused(RevokeTokens(ctx,users,user.User_id))
+	}
+	return user,signedToken,newRefreshToken,err
 }
 
-// function that receives an argument and returns claims and a message
-func ValidateToken(signedToken string)(claims *SignedDetails,msg string){
-	// passing the signedToken and the signedDetails and uses an anonymous jwt token
-	// to return a string slice of the secret key
-	token,err := jwt.ParseWithClaims(
-		signedToken,
-		&SignedDetails{},
-		func(t *jwt.Token) (interface{}, error) {
-			return []byte(SECRET_KEY),nil
-		})	
-
-    // asseriting the token claims to the *SignedDetails. If successful it assigns
-	// the claims to the claim variable. If it fails it throws an error.
-	claims,ok := token.Claims.(*SignedDetails)
-	if !ok {
-		msg = "The token is invalid :" + err.Error()
-		return
+// RevokeTokens forgets the tokens stored on the user so no refresh token of the
+// current family can be exchanged anymore
+func RevokeTokens(ctx context.Context,users repository.UserRepository,userid string) error{
+	Updated_at,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+	updateObj := primitive.D{
+		{Key: "token",Value: nil},
+		{Key: "refresh_token",Value: nil},
+		{Key: "token_family",Value: nil},
+		{Key: "updated_at",Value: Updated_at},
 	}
+	_,err := users.Update(ctx,userid,0,updateObj)
+	return err
+}
 
-	// This line checks if the token has expired by comparing its expiration time with
-	// the current time
-	if claims.ExpiresAt < time.Now().Local().Unix(){
-		msg = "Token is expired :" + err.Error()
-		return
+// reused reports the reuse of a refresh token once its family was revoked
+func reused(err error) error{
+	if err != nil{
+		return err
+	}
+	return ErrRefreshReused
+}
+
+// validateRefreshToken checks the signature, the expiry and the kind of a refresh token
+func validateRefreshToken(signedToken string)(*SignedDetails,error){
+	claims := &SignedDetails{}
+	token,err := jwt.ParseWithClaims(signedToken,claims,Keys.verificationKey)
+	if err != nil || !token.Valid || claims.Token_type != RefreshToken || claims.Uid == "" || claims.Family == ""{
+		return nil,ErrRefreshInvalid
+	}
+	return claims,nil
+}
+
+func stringValue(s *string) string{
+	if s == nil{
+		return ""
+	}
+	return *s
+}
+
+// the reasons ValidateToken refuses a token
+var (
+	ErrTokenExpired = errors.New("the token is expired")
+	ErrTokenInvalid = errors.New("the token is not valid")
+)
+
+// ValidateToken checks the signature and the expiry of a token and returns its claims
+func ValidateToken(signedToken string)(*SignedDetails,error){
+	claims := &SignedDetails{}
+	// passing the signedToken and the signedDetails, the key ring picks the key named by the kid header
+	token,err := jwt.ParseWithClaims(signedToken,claims,Keys.verificationKey)
+
+	// an expired token is only reported as such when its signature is good, the library
+	// sets every error it found
+	var validationErr *jwt.ValidationError
+	if errors.As(err,&validationErr) && validationErr.Errors == jwt.ValidationErrorExpired{
+		return nil,ErrTokenExpired
+	}
+	if err != nil || !token.Valid{
+		return nil,ErrTokenInvalid
+	}
+	return claims,nil
+}
+
+// ErrMFATokenInvalid is returned for an mfa token that is malformed or expired
+var ErrMFATokenInvalid = errors.New("mfa token is not valid")
+
+// GenerateMFAToken returns the token that stands for the checked password of the user until
+// the one-time code is sent
+func GenerateMFAToken(user models.User)(string,error){
+	now := time.Now()
+	claims := &SignedDetails{
+		Uid: user.User_id,
+		Token_type: MFAToken,
+		Issued_at: now.UnixMilli(),
+		StandardClaims: jwt.StandardClaims{
+			Id: randomId(),
+			IssuedAt: now.Unix(),
+			ExpiresAt: time.Now().Local().Add(MFATokenLifetime).Unix(),
+		},
 	}
+	return Keys.sign(claims)
+}
 
-	// returns the claims and the message
-	return claims,msg
-}
\ No newline at end of file
+// ValidateMFAToken checks the signature, the expiry and the kind of an mfa token
+func ValidateMFAToken(signedToken string)(*SignedDetails,error){
+	claims := &SignedDetails{}
+	token,err := jwt.ParseWithClaims(signedToken,claims,Keys.verificationKey)
+	if err != nil || !token.Valid || claims.Token_type != MFAToken || claims.Uid == ""{
+		return nil,ErrMFATokenInvalid
+	}
+	return claims,nil
+}
+
+// GeneratePinToken returns the access token of a member of staff who switched to themselves
+// on a shared terminal with their PIN. It only works at the branch of the terminal, is not
+// refreshed and names the api key of the terminal, a PIN is not a second factor.
+func GeneratePinToken(user models.User,branchId string,terminalId string)(string,error){
+	now := time.Now()
+	claims := &SignedDetails{
+		Email: stringValue(user.Email),
+		First_name: stringValue(user.First_name),
+		Last_name: stringValue(user.Last_name),
+		Uid: user.User_id,
+		Branches: []string{branchId},
+		Roles: user.Roles,
+		Token_type: AccessToken,
+		Terminal: terminalId,
+		Issued_at: now.UnixMilli(),
+		StandardClaims: jwt.StandardClaims{
+			Id: randomId(),
+			IssuedAt: now.Unix(),
+			ExpiresAt: time.Now().Local().Add(PinTokenLifetime).Unix(),
+		},
+	}
+	return Keys.sign(claims)
+}
@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// the parameters of the one-time codes, the ones every authenticator app uses by default
+const (
+	totpDigits = 6
+	// 10 to the power of totpDigits
+	totpModulus = 1000000
+	totpPeriod = 30
+	// the codes of the periods right before and after the current one are accepted as well,
+	// for clocks that are a little off and codes typed in just as they changed
+	totpSkew = 1
+)
+
+// RecoveryCodeCount is the number of recovery codes handed out at once
+const RecoveryCodeCount = 10
+
+// TOTPIssuer names the service in the authenticator apps, set by main from the config
+var TOTPIssuer = "Restaurant"
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random secret for RFC 6238 one-time codes, base32 encoded the way
+// the authenticator apps expect it
+func NewTOTPSecret() string{
+	b := make([]byte,20)
+	if _,err := rand.Read(b); err != nil{
+		log.Panic(err)
+	}
+	return base32NoPadding.EncodeToString(b)
+}
+
+// TOTPURI returns the otpauth:// URI of a secret, shown as a QR code to enroll an authenticator app
+func TOTPURI(secret string,account string) string{
+	label := url.PathEscape(TOTPIssuer) + ":" + url.PathEscape(account)
+	query := url.Values{}
+	query.Set("secret",secret)
+	query.Set("issuer",TOTPIssuer)
+	query.Set("algorithm","SHA1")
+	query.Set("digits",fmt.Sprint(totpDigits))
+	query.Set("period",fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code an authenticator app shows for the secret at the time t
+func TOTPCode(secret string,t time.Time) (string,error){
+	key,err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil{
+		return "",err
+	}
+	return hotp(key,totpStep(t)),nil
+}
+
+// CheckTOTP checks a code against the secret and returns the period it belongs to. A code of
+// lastStep or an earlier period is refused, so every code can be used only once.
+func CheckTOTP(secret string,code string,now time.Time,lastStep int64) (int64,bool){
+	code = strings.ReplaceAll(strings.TrimSpace(code)," ","")
+	if len(code) != totpDigits{
+		return 0,false
+	}
+	key,err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil{
+		return 0,false
+	}
+	current := totpStep(now)
+	for step := current-totpSkew; step <= current+totpSkew; step++{
+		if step <= lastStep{
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key,step)),[]byte(code)) == 1{
+			return step,true
+		}
+	}
+	return 0,false
+}
+
+func totpStep(t time.Time) int64{
+	return t.Unix()/totpPeriod
+}
+
+// hotp is the HMAC-based one-time password of RFC 4226 for the counter
+func hotp(key []byte,counter int64) string{
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:],uint64(counter))
+	mac := hmac.New(sha1.New,key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d",totpDigits,value%totpModulus)
+}
+
+// NewRecoveryCodes returns the recovery codes to show the user once, "xxxx-xxxx-xxxx-xxxx",
+// and their hashes to store. Each code stands in for a one-time code once.
+func NewRecoveryCodes() (codes []string,hashes []string){
+	for i := 0; i < RecoveryCodeCount; i++{
+		b := make([]byte,10)
+		if _,err := rand.Read(b); err != nil{
+			log.Panic(err)
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(b))
+		code = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		codes = append(codes,code)
+		hashes = append(hashes,HashRecoveryCode(code))
+	}
+	return codes,hashes
+}
+
+// HashRecoveryCode returns the hash a recovery code is stored and looked up by, the code
+// may be typed in upper case or without its dashes
+func HashRecoveryCode(code string) string{
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.NewReplacer("-","","_",""," ","").Replace(code)
+	return HashSecret(code)
+}
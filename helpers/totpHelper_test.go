@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA1 secret of the test vectors of RFC 6238, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T){
+	// appendix B of RFC 6238, the last 6 of its 8 digits
+	vectors := map[int64]string{
+		59: "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix,want := range vectors{
+		code,err := TOTPCode(rfcSecret,time.Unix(unix,0))
+		if err != nil || code != want{
+			t.Errorf("code at %d = %q, %v, want %q",unix,code,err,want)
+		}
+	}
+	if code,_ := TOTPCode(strings.ToLower(rfcSecret),time.Unix(59,0)); code != "287082"{
+		t.Errorf("a lower case secret should work, got %q",code)
+	}
+	if _,err := TOTPCode("not base32!",time.Now()); err == nil{
+		t.Error("expected a secret that is not base32 to fail")
+	}
+}
+
+func TestCheckTOTP(t *testing.T){
+	now := time.Unix(1234567890,0)
+	current := now.Unix()/30
+	code,_ := TOTPCode(rfcSecret,now)
+
+	step,ok := CheckTOTP(rfcSecret,code,now,0)
+	if !ok || step != current{
+		t.Fatalf("expected the current code to be accepted, got %d %v",step,ok)
+	}
+	if _,ok := CheckTOTP(rfcSecret,code[:3] + " " + code[3:],now,0); !ok{
+		t.Error("a code typed with a space should be accepted")
+	}
+	// every code is used once
+	if _,ok := CheckTOTP(rfcSecret,code,now,step); ok{
+		t.Error("a code that was used should be refused")
+	}
+
+	// the periods right before and after are accepted, those further away are not
+	for offset,accepted := range map[time.Duration]bool{-30*time.Second: true,30*time.Second: true,-60*time.Second: false,60*time.Second: false}{
+		other,_ := TOTPCode(rfcSecret,now.Add(offset))
+		if _,ok := CheckTOTP(rfcSecret,other,now,0); ok != accepted{
+			t.Errorf("the code of %v from now: accepted %v, want %v",offset,ok,accepted)
+		}
+	}
+
+	for _,bad := range []string{"","12345","1234567","abcdef"}{
+		if _,ok := CheckTOTP(rfcSecret,bad,now,0); ok{
+			t.Errorf("%q should be refused",bad)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T){
+	secret := NewTOTPSecret()
+	if len(secret) != 32{
+		t.Errorf("expected a 160 bit secret, got %q",secret)
+	}
+	uri,err := url.Parse(TOTPURI(secret,"ann@example.com"))
+	if err != nil{
+		t.Fatal(err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || query.Get("secret") != secret || query.Get("digits") != "6" || query.Get("period") != "30"{
+		t.Errorf("unexpected enrollment uri %s",uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T){
+	codes,hashes := NewRecoveryCodes()
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount{
+		t.Fatalf("expected %d codes, got %d and %d hashes",RecoveryCodeCount,len(codes),len(hashes))
+	}
+	seen := map[string]bool{}
+	for i,code := range codes{
+		if len(code) != 19 || seen[code]{
+			t.Errorf("expected distinct xxxx-xxxx-xxxx-xxxx codes, got %q",code)
+		}
+		seen[code] = true
+		typed := strings.ToUpper(strings.ReplaceAll(code,"-",""))
+		if HashRecoveryCode(typed) != hashes[i]{
+			t.Errorf("%q should match the hash of %q",typed,code)
+		}
+	}
+}
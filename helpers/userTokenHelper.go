@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"restaurant-backend/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// how long the mailed tokens can be used
+const (
+	PasswordResetLifetime = time.Hour
+	EmailVerificationLifetime = 48*time.Hour
+)
+
+// NewUserToken returns a random token to mail to the user and the record to store for it,
+// the record only holds the hash of the token
+func NewUserToken(user models.User,purpose string,lifetime time.Duration)(secret string,token models.UserToken){
+	b := make([]byte,32)
+	if _,err := rand.Read(b); err != nil{
+		log.Panic(err)
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+
+	now,_ := time.Parse(time.RFC3339,time.Now().Format(time.RFC3339))
+	token = models.UserToken{
+		ID: primitive.NewObjectID(),
+		Token_hash: HashSecret(secret),
+		Purpose: purpose,
+		User_id: user.User_id,
+		Email: stringValue(user.Email),
+		Created_at: now,
+		Expires_at: now.Add(lifetime),
+	}
+	return secret,token
+}
+
+// HashSecret returns the hash a mailed token or an api key is stored and checked by. They are
+// random and long, so a fast hash is enough where a password would need bcrypt.
+func HashSecret(secret string) string{
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,82 @@
+// Package mail sends the messages of the account flows, like password reset links.
+// Handlers only see the Mailer interface; the default implementation writes every
+// message to a spool directory so the flows work offline and in development, and a
+// relay can pick the files up to deliver them.
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Spool is a Mailer that writes each message as an .eml file into a directory
+type Spool struct {
+	dir  string
+	from string
+}
+
+// NewSpool creates the spool directory when it does not exist yet
+func NewSpool(dir string, from string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating mail spool %s: %w", dir, err)
+	}
+	return &Spool{dir: dir, from: from}, nil
+}
+
+// Send writes the message under a unique name. The file is written under a temporary
+// name first, so whatever picks the files up never reads half a message.
+func (s *Spool) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// a line break would let the recipient or the subject add headers of their own
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("mail headers must not contain line breaks")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%s", now.Format("20060102T150405"), hex.EncodeToString(id))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@restaurant-backend>\r\n", name)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	tmp := filepath.Join(s.dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name+".eml")); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
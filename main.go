@@ -1,48 +1,194 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"restaurant-backend/backup"
+	"restaurant-backend/config"
+	"restaurant-backend/controllers"
 	"restaurant-backend/database"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/mail"
 	"restaurant-backend/middleware"
+	"restaurant-backend/migrations"
+	"restaurant-backend/models"
+	"restaurant-backend/money"
+	"restaurant-backend/repository"
 	"restaurant-backend/routes"
+	"restaurant-backend/seed"
+	"syscall"
+	"time"
+	// the timezones of the menu schedules work on hosts without a timezone database
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// a mongoDB collection for handling food related data
-// the open collection function establishes the connection to the database
-var foodCollection *mongo.Collection = database.OpenCollection(database.Client,"food")
-
 func main(){
 
-	// retrieves the value of the Port environment variable. Default port is 8000
-	// flexible as the app can run on the specified port
-	port := os.Getenv("PORT")
-	if port == ""{
-       port = "8000"
+	// loads the configuration from the CONFIG_FILE and the environment
+	cfg,err := config.Load()
+	if err != nil{
+		log.Fatalf("invalid configuration: %v",err)
+	}
+	// prices sent or stored without a currency are in the configured one
+	money.DefaultCurrency = cfg.Currency
+	// the menu schedules of the branches without a timezone are read in the configured one
+	models.DefaultLocation,_ = cfg.Location()
+
+	// connects to mongodb, retrying with a backoff while the server is not reachable yet
+	client,err := database.Connect(context.Background(),cfg.Mongo)
+	if err != nil{
+		log.Fatalf("startup failed: %v",err)
+	}
+
+	db := client.Database(cfg.Mongo.Database)
+
+	// runs a subcommand instead of the server when one is given, e.g. "restaurant-backend migrate up"
+	// or "restaurant-backend backup -out before-overhaul.tar.gz"
+	if len(os.Args) > 1{
+		err := runCommand(db,os.Args[1],os.Args[2:])
+		client.Disconnect(context.Background())
+		if err != nil{
+			log.Fatalf("%s: %v",os.Args[1],err)
+		}
+		return
+	}
+
+	// warns about migrations that still have to run, the handlers rely on their indexes
+	if pending,err := migrations.NewRunner(db).Pending(context.Background()); err != nil{
+		log.Printf("could not check migrations: %v",err)
+	} else if len(pending) > 0{
+		log.Printf("%d database migration(s) pending, run \"migrate up\"",len(pending))
+	}
+
+	// loads the keys the tokens are signed with, the server does not start without them
+	keys,err := helper.LoadKeyRing(cfg.Tokens.KeysDir,cfg.Tokens.SigningKey)
+	if err != nil{
+		client.Disconnect(context.Background())
+		log.Fatalf("invalid token keys: %v",err)
+	}
+	helper.Keys = keys
+	log.Printf("signing tokens with key %q",keys.SigningKid())
+	if os.Getenv("SECRET_KEY") != ""{
+		log.Printf("SECRET_KEY is no longer used, tokens are signed with the keys in %s",cfg.Tokens.KeysDir)
+	}
+
+	// the password reset and email verification messages go to the spool directory
+	mailer,err := mail.NewSpool(cfg.Mail.SpoolDir,cfg.Mail.From)
+	if err != nil{
+		client.Disconnect(context.Background())
+		log.Fatalf("startup failed: %v",err)
 	}
 
+	// creates the repositories on top of the configured database and hands them to the controllers
+	repos := repository.NewMongo(db)
+	ctl := controllers.New(repos,mailer,cfg.Mail.LinkBaseURL)
+	// the authentication middleware rejects the tokens revoked through the controllers
+	middleware.RevokedTokens = repos.Revocations
+	// and accepts the api keys of the devices
+	middleware.APIKeys = repos.APIKeys
+	// the roles that only count after a login with a one-time code
+	middleware.MFARequiredRoles = cfg.MFA.RequiredRoles
+	helper.TOTPIssuer = cfg.MFA.Issuer
+	// the users who count as admins without the role
+	middleware.AdminUserIDs = cfg.AdminUserIDs
+
 	// Initializes the gin router and adds a logging middleware to log
 	// HTTP requests.
 	router := gin.New()
+	// only the configured load balancers may tell the client ip, the failed logins are counted per ip
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil{
+		client.Disconnect(context.Background())
+		log.Fatalf("invalid trusted proxies: %v",err)
+	}
 	router.Use(gin.Logger())
+	// tags every request with an id that the audit log records
+	router.Use(middleware.RequestID())
 
+	// the liveness and readiness probes, they need no token
+	routes.HealthRoutes(router,ctl)
+	// the public keys of the tokens, for the applications that verify them
+	routes.KeyRoutes(router,ctl)
 	// configures routes related to user operations by calling routes
-	routes.UserRoutes(router)
+	routes.UserRoutes(router,ctl)
 	// Adds authentication middleware to the router that checks if requests are properly authenicated
 	router.Use(middleware.Authentication())
+	// the branches themselves are managed across branches
+	routes.BranchRoutes(router,ctl)
+	routes.RoleRoutes(router,ctl)
+	routes.APIKeyRoutes(router,ctl)
+	// the audit log holds the changes of every branch and of the routes above
+	routes.AuditRoutes(router,ctl)
+	// scopes the remaining routes to the branch picked with the X-Branch-ID header
+	router.Use(middleware.BranchScope())
 
 	// configures variables routes for various operations by calling corresponding functions
-	routes.FoodRoutes(router)
-	routes.MenuRoutes(router)
-	routes.TableRoutes(router)
-	routes.OrderRoutes(router)
-	routes.InvoiceRoutes(router)
-	routes.OrderItemRoutes(router)
-
-	// Starts the HTTP server and listens on the specified port
+	routes.FoodRoutes(router,ctl)
+	routes.MenuRoutes(router,ctl)
+	routes.TableRoutes(router,ctl)
+	routes.OrderRoutes(router,ctl)
+	routes.InvoiceRoutes(router,ctl)
+	routes.OrderItemRoutes(router,ctl)
+
+	// Starts the HTTP server and listens on the configured port
 	// The application will now handle incoming HTTP requests based on the configured routes
-	router.Run(":" + port)
-	
-}
\ No newline at end of file
+	server := &http.Server{
+		Addr: ":" + cfg.Server.Port,
+		Handler: router,
+		ReadTimeout: cfg.Server.ReadTimeout.Duration,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration,
+		WriteTimeout: cfg.Server.WriteTimeout.Duration,
+		IdleTimeout: cfg.Server.IdleTimeout.Duration,
+	}
+	serverErr := make(chan error,1)
+	go func(){
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// waits for the orchestrator to stop the process or for the server to fail
+	stop := make(chan os.Signal,1)
+	signal.Notify(stop,syscall.SIGTERM,os.Interrupt)
+	select{
+	case err := <-serverErr:
+		client.Disconnect(context.Background())
+		log.Fatalf("server failed: %v",err)
+	case sig := <-stop:
+		log.Printf("received %s, draining in-flight requests",sig)
+	}
+
+	// fails the readiness probe and keeps serving until the load balancer noticed, then
+	// stops accepting connections and waits for the requests in flight, then closes the
+	// mongodb connections they were using
+	ctl.Drain()
+	time.Sleep(cfg.Server.DrainDelay.Duration)
+	ctx,cancel := context.WithTimeout(context.Background(),cfg.Server.ShutdownTimeout.Duration)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil{
+		log.Printf("shutdown did not finish in %s: %v",cfg.Server.ShutdownTimeout.Duration,err)
+	}
+	if err := client.Disconnect(ctx); err != nil{
+		log.Printf("disconnecting from mongodb: %v",err)
+	}
+	log.Printf("server stopped")
+}
+
+// runCommand runs one of the maintenance subcommands of the binary
+func runCommand(db *mongo.Database,name string,args []string) error{
+	switch name{
+	case "migrate":
+		return migrations.Command(context.Background(),db,args,os.Stdout)
+	case "backup":
+		return backup.BackupCommand(context.Background(),db,args,os.Stdout)
+	case "restore":
+		return backup.RestoreCommand(context.Background(),db,args,os.Stdout)
+	case "seed":
+		return seed.Command(context.Background(),repository.NewMongo(db),args,os.Stdout)
+	}
+	return fmt.Errorf("unknown command %q",name)
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"restaurant-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the ids of the users allowed to run the admin-only routes without the admin role, set by main
+var AdminUserIDs []string
+
+// RequireAdmin only lets through the admins, it runs after Authentication
+// which puts the uid and the roles of the caller in the context
+func RequireAdmin() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		if IsAdmin(c){
+			c.Next()
+			return
+		}
+		forbidden(c,"only an admin can do this")
+	}
+}
+
+// IsAdmin reports whether the caller holds the admin role or is listed in AdminUserIDs,
+// the list is how the first admin gets in before anybody can assign roles. Both need
+// two-factor authentication when MFARequiredRoles has the admin role.
+func IsAdmin(c *gin.Context) bool{
+	if contains(c.GetStringSlice("roles"),models.RoleAdmin){
+		return true
+	}
+	return listedAdmin(c.GetString("uid")) && !contains(c.GetStringSlice("withheld_roles"),models.RoleAdmin)
+}
+
+// listedAdmin reports whether the user is listed in AdminUserIDs
+func listedAdmin(uid string) bool{
+	return uid != "" && contains(AdminUserIDs,uid)
+}
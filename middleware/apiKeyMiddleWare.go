@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/repository"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the store of the api keys, set by main. Without one no api key is accepted.
+var APIKeys repository.APIKeyRepository
+
+// apiKeyFromHeader returns the api key of an "Authorization: ApiKey rk_..." header, a key
+// sent as "Authorization: Bearer rk_..." is recognised by its prefix
+func apiKeyFromHeader(c *gin.Context) (string,bool){
+	scheme,credentials,found := strings.Cut(strings.TrimSpace(c.GetHeader("Authorization"))," ")
+	if !found{
+		return "",false
+	}
+	credentials = strings.TrimSpace(credentials)
+	switch {
+	case strings.EqualFold(scheme,"ApiKey"):
+		return credentials,true
+	case strings.EqualFold(scheme,"Bearer") && strings.HasPrefix(credentials,helper.APIKeyPrefix):
+		return credentials,true
+	}
+	return "",false
+}
+
+// authenticateAPIKey checks an api key and puts what it may do in the context like
+// Authentication does for a token: the scopes stand in for the roles and the branch
+// the key is restricted to for the branches. It answers 401 for a key that is not valid.
+func authenticateAPIKey(c *gin.Context,key string) bool{
+	reject := func(msg string) bool{
+		unauthorized(c,"ApiKey","invalid_token",msg)
+		return false
+	}
+	if APIKeys == nil{
+		return reject("api keys are not accepted")
+	}
+
+	keyId,secret,ok := helper.ParseAPIKey(key)
+	if !ok{
+		return reject("the api key is malformed")
+	}
+
+	ctx := repository.AllBranches(c.Request.Context())
+	apiKey,err := APIKeys.Get(ctx,keyId)
+	if errors.Is(err,repository.ErrNotFound){
+		return reject("the api key is not valid")
+	}
+	if err != nil{
+		log.Printf("looking up api key %s: %v",keyId,err)
+		c.JSON(http.StatusServiceUnavailable,gin.H{"error":"the api key could not be checked"})
+		c.Abort()
+		return false
+	}
+
+	now := time.Now()
+	switch {
+	case !helper.CheckAPIKeySecret(secret,apiKey.Secret_hash):
+		return reject("the api key is not valid")
+	case apiKey.Revoked_at != nil:
+		return reject("the api key was revoked")
+	case apiKey.Expires_at != nil && !apiKey.Expires_at.After(now):
+		return reject("the api key expired")
+	}
+
+	if err := APIKeys.Touch(ctx,keyId,now); err != nil{
+		log.Printf("recording the use of api key %s: %v",keyId,err)
+	}
+
+	// the audit log records the key as the actor
+	c.Set("uid","apikey:" + keyId)
+	c.Set("api_key_id",keyId)
+	c.Set(apiKeyKey,&apiKey)
+	c.Set("scopes",apiKey.Scopes)
+	if apiKey.Branch_id != nil && *apiKey.Branch_id != ""{
+		c.Set("branches",[]string{*apiKey.Branch_id})
+	} else{
+		c.Set("any_branch",true)
+	}
+	return true
+}
+
+// terminalActive checks that the api key of the terminal a PIN token was issued on is still
+// valid, the sessions on a lost or retired terminal end with its key. It answers 401 when not.
+func terminalActive(c *gin.Context,keyId string) bool{
+	if APIKeys == nil{
+		unauthorized(c,"Bearer","invalid_token","the terminal of the token is not valid")
+		return false
+	}
+	apiKey,err := APIKeys.Get(repository.AllBranches(c.Request.Context()),keyId)
+	if errors.Is(err,repository.ErrNotFound){
+		unauthorized(c,"Bearer","invalid_token","the terminal of the token is not valid")
+		return false
+	}
+	if err != nil{
+		log.Printf("looking up api key %s: %v",keyId,err)
+		c.JSON(http.StatusServiceUnavailable,gin.H{"error":"the token could not be checked"})
+		c.Abort()
+		return false
+	}
+	if apiKey.Revoked_at != nil || (apiKey.Expires_at != nil && !apiKey.Expires_at.After(time.Now())){
+		unauthorized(c,"Bearer","invalid_token","the terminal of the token was revoked, switch to your account again")
+		return false
+	}
+	return true
+}
@@ -1,35 +1,168 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	helper "restaurant-backend/helpers"
+	"restaurant-backend/models"
+	"restaurant-backend/repository"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// the store of the revoked tokens, set by main. Without one no token is considered revoked.
+var RevokedTokens repository.RevocationRepository
+
+// the realm named in the WWW-Authenticate challenges
+const realm = "restaurant-backend"
+
+// the keys Authentication puts the typed claims and the api key under, see Claims and APIKey
+const (
+	claimsKey = "claims"
+	apiKeyKey = "api_key"
+)
+
+// Authentication lets through the requests carrying a valid access token or api key.
+// The token is read from an RFC 6750 "Authorization: Bearer <token>" header, the
+// "token" header is still accepted for the clients that send it. A missing, malformed,
+// expired or revoked token is answered with 401 and a WWW-Authenticate challenge.
 func Authentication() gin.HandlerFunc{
 	return func(c *gin.Context) {
-		clientToken := c.Request.Header.Get("token")
+		// the devices authenticate with an api key instead of a token
+		if key,ok := apiKeyFromHeader(c); ok{
+			if authenticateAPIKey(c,key){
+				c.Next()
+			}
+			return
+		}
+
+		clientToken,err := bearerToken(c)
+		if err != nil{
+			unauthorized(c,"Bearer","invalid_request",err.Error())
+			return
+		}
 		if clientToken == ""{
-			msg:= "No Authorization header provide"
-			c.JSON(http.StatusInternalServerError,gin.H{"error":msg})
-			c.Abort()
+			// without credentials the challenge carries no error code, RFC 6750 section 3.1
+			unauthorized(c,"Bearer","","an access token is required")
+			return
+		}
+
+		claims,err := helper.ValidateToken(clientToken)
+		if errors.Is(err,helper.ErrTokenExpired){
+			unauthorized(c,"Bearer","invalid_token","the token is expired, refresh it or log in again")
+			return
+		}
+		if err != nil{
+			unauthorized(c,"Bearer","invalid_token","the token is not valid")
+			return
+		}
+
+		// a refresh token is only good for POST /users/refresh and an mfa token for POST /users/login/mfa
+		if claims.Token_type != helper.AccessToken{
+			unauthorized(c,"Bearer","invalid_token","only an access token can be used to call the api")
 			return
-	     }
+		}
 
-		 claims,err := helper.ValidateToken(clientToken)
-		 if err != " "{
-			c.JSON(http.StatusInternalServerError,gin.H{"error":err})
-			c.Abort()
+		// a logged out token or a token of a user whose sessions were revoked
+		if RevokedTokens != nil{
+			revoked,err := RevokedTokens.IsRevoked(c.Request.Context(),claims.Id,claims.Uid,claims.IssuedTime())
+			if err != nil{
+				log.Printf("checking the revoked tokens: %v",err)
+				c.JSON(http.StatusServiceUnavailable,gin.H{"error":"the token could not be checked"})
+				c.Abort()
+				return
+			}
+			if revoked{
+				unauthorized(c,"Bearer","invalid_token","the token was revoked, log in again")
+				return
+			}
+		}
+
+		// a PIN token stops working with the api key of the terminal it was issued on
+		if claims.Terminal != "" && !terminalActive(c,claims.Terminal){
 			return
-		 }
+		}
+
+		c.Set(claimsKey,claims)
+		c.Set("email",claims.Email)
+		c.Set("first_name",claims.First_name)
+		c.Set("last_name",claims.Last_name)
+		c.Set("uid",claims.Uid)
+		c.Set("branches",claims.Branches)
+		c.Set("roles",grantedRoles(c,claims))
+		c.Set("mfa",claims.Mfa)
+		c.Set("jti",claims.Id)
+		c.Set("expires_at",time.Unix(claims.ExpiresAt,0))
+
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of the Authorization header, or of the token header when
+// there is no Authorization header. It is empty when the request has neither.
+func bearerToken(c *gin.Context) (string,error){
+	authorization := strings.TrimSpace(c.GetHeader("Authorization"))
+	if authorization == ""{
+		return strings.TrimSpace(c.GetHeader("token")),nil
+	}
+	scheme,credentials,_ := strings.Cut(authorization," ")
+	if !strings.EqualFold(scheme,"Bearer"){
+		return "",fmt.Errorf("the Authorization header has to use the Bearer scheme")
+	}
+	credentials = strings.TrimSpace(credentials)
+	if credentials == ""{
+		return "",fmt.Errorf("the Authorization header carries no token")
+	}
+	return credentials,nil
+}
 
-		 c.Set("email",claims.Email)
-		 c.Set("first_name",claims.First_name)
-		 c.Set("last_name",claims.Last_name)
-		 c.Set("uid",claims.Uid)
+// unauthorized answers 401 with a WWW-Authenticate challenge of the scheme, code is one of
+// the error codes of RFC 6750 section 3.1 or empty when no credentials were sent
+func unauthorized(c *gin.Context,scheme string,code string,msg string){
+	challenge := fmt.Sprintf(`%s realm="%s"`,scheme,realm)
+	if code != ""{
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`,code,msg)
+	}
+	c.Header("WWW-Authenticate",challenge)
+	c.JSON(http.StatusUnauthorized,gin.H{"error":msg})
+	c.Abort()
+}
 
-		 c.Next()
+// forbidden answers 403 to a caller who is authenticated but not allowed to do this, and
+// points the callers whose roles were withheld at two-factor authentication
+func forbidden(c *gin.Context,msg string){
+	if withheld := c.GetStringSlice("withheld_roles"); len(withheld) > 0{
+		needs := "role needs"
+		if len(withheld) > 1{
+			needs = "roles need"
+		}
+		msg += fmt.Sprintf(", the %s %s two-factor authentication, turn it on with POST /users/me/mfa and log in again",strings.Join(withheld," and "),needs)
 	}
-			
-}
\ No newline at end of file
+	scheme := "Bearer"
+	if APIKey(c) != nil{
+		scheme = "ApiKey"
+	}
+	c.Header("WWW-Authenticate",fmt.Sprintf(`%s realm="%s", error="insufficient_scope", error_description="%s"`,scheme,realm,msg))
+	c.JSON(http.StatusForbidden,gin.H{"error":msg})
+	c.Abort()
+}
+
+// Claims returns the claims of the access token of the request, nil for a request
+// authenticated with an api key or not authenticated at all
+func Claims(c *gin.Context) *helper.SignedDetails{
+	claims,_ := c.Get(claimsKey)
+	details,_ := claims.(*helper.SignedDetails)
+	return details
+}
+
+// APIKey returns the api key the request was authenticated with, nil for a request
+// authenticated with a token or not authenticated at all
+func APIKey(c *gin.Context) *models.APIKey{
+	apiKey,_ := c.Get(apiKeyKey)
+	key,_ := apiKey.(*models.APIKey)
+	return key
+}
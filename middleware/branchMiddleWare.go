@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"restaurant-backend/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BranchScope picks the branch the request works on and scopes every repository call
+// made with the request context to it. The branch is taken from the X-Branch-ID header
+// and has to be one of the branches of the token, admins and api keys without a branch
+// may pick any branch. Users who work at a single branch can leave the header out.
+// It runs after Authentication, which puts the branches of the token in the context.
+func BranchScope() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		branches := c.GetStringSlice("branches")
+		branchId := c.Request.Header.Get("X-Branch-ID")
+
+		switch {
+		case branchId == "" && len(branches) == 1:
+			branchId = branches[0]
+		case branchId == "":
+			c.JSON(http.StatusBadRequest,gin.H{"error":"X-Branch-ID header is required"})
+			c.Abort()
+			return
+		case !IsAdmin(c) && !c.GetBool("any_branch") && !contains(branches,branchId):
+			forbidden(c,"you do not work at this branch")
+			return
+		}
+
+		c.Set("branch_id",branchId)
+		c.Request = c.Request.WithContext(repository.WithBranch(c.Request.Context(),branchId))
+
+		c.Next()
+	}
+}
+
+func contains(list []string,value string) bool{
+	for _,item := range list{
+		if item == value{
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	helper "restaurant-backend/helpers"
+	"restaurant-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the roles that only count once the user logged in with a one-time code, set by main.
+// A user holding one of them without two-factor authentication keeps the other roles.
+var MFARequiredRoles []string
+
+// MFARequired reports whether the user has to turn two-factor authentication on to use all
+// of their roles. Being listed in AdminUserIDs counts as holding the admin role.
+func MFARequired(userId string,roles []string) bool{
+	for _,role := range roles{
+		if contains(MFARequiredRoles,role){
+			return true
+		}
+	}
+	return listedAdmin(userId) && contains(MFARequiredRoles,models.RoleAdmin)
+}
+
+// grantedRoles returns the roles of the token that count. Without a one-time code at login
+// the roles of MFARequiredRoles are withheld, they are put in the context under
+// "withheld_roles" so a refusal can say why.
+func grantedRoles(c *gin.Context,claims *helper.SignedDetails) []string{
+	if claims.Mfa{
+		return claims.Roles
+	}
+	granted,withheld := []string{},[]string{}
+	for _,role := range claims.Roles{
+		if contains(MFARequiredRoles,role){
+			withheld = append(withheld,role)
+		} else{
+			granted = append(granted,role)
+		}
+	}
+	if listedAdmin(claims.Uid) && contains(MFARequiredRoles,models.RoleAdmin) && !contains(withheld,models.RoleAdmin){
+		withheld = append(withheld,models.RoleAdmin)
+	}
+	if len(withheld) > 0{
+		c.Set("withheld_roles",withheld)
+	}
+	return granted
+}
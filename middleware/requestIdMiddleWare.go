@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestID tags every request with an id, taken from the X-Request-ID header when the
+// caller sends one, so the audit log and the logs of a proxy can be matched up
+func RequestID() gin.HandlerFunc{
+	return func(c *gin.Context) {
+		requestId := c.Request.Header.Get("X-Request-ID")
+		if requestId == "" || len(requestId) > 128{
+			buf := make([]byte,16)
+			rand.Read(buf)
+			requestId = hex.EncodeToString(buf)
+		}
+
+		c.Set("request_id",requestId)
+		c.Header("X-Request-ID",requestId)
+
+		c.Next()
+	}
+}
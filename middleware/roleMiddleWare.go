@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"restaurant-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the permissions checked by the routes, named after the resource they cover
+const (
+	FoodRead       = "food:read"
+	FoodWrite      = "food:write"
+	MenuRead       = "menu:read"
+	MenuWrite      = "menu:write"
+	TableRead      = "table:read"
+	TableWrite     = "table:write"
+	OrderRead      = "order:read"
+	OrderWrite     = "order:write"
+	OrderItemRead  = "orderItem:read"
+	OrderItemWrite = "orderItem:write"
+	// OrderItemPrice is needed to price an order item other than its food
+	OrderItemPrice = "orderItem:price"
+	InvoiceRead    = "invoice:read"
+	InvoiceWrite   = "invoice:write"
+	// InvoicePay is needed to set the payment_status of an invoice
+	InvoicePay     = "invoice:pay"
+	UserRead       = "user:read"
+	UserWrite      = "user:write"
+	// PinLogin lets a shared terminal switch to a member of staff by their PIN. No role is
+	// granted it, only the api key of a terminal can have it in its scopes.
+	PinLogin       = "user:pin_login"
+)
+
+// Policy grants every permission to the roles listed for it. Admins are not listed,
+// they are granted everything.
+var Policy = map[string][]string{
+	FoodRead:       {models.RoleManager,models.RoleWaiter,models.RoleKitchen,models.RoleCashier},
+	FoodWrite:      {models.RoleManager},
+	MenuRead:       {models.RoleManager,models.RoleWaiter,models.RoleKitchen,models.RoleCashier},
+	MenuWrite:      {models.RoleManager},
+	TableRead:      {models.RoleManager,models.RoleWaiter,models.RoleCashier},
+	TableWrite:     {models.RoleManager},
+	OrderRead:      {models.RoleManager,models.RoleWaiter,models.RoleKitchen,models.RoleCashier},
+	OrderWrite:     {models.RoleManager,models.RoleWaiter},
+	OrderItemRead:  {models.RoleManager,models.RoleWaiter,models.RoleKitchen,models.RoleCashier},
+	OrderItemWrite: {models.RoleManager,models.RoleWaiter},
+	OrderItemPrice: {models.RoleManager},
+	InvoiceRead:    {models.RoleManager,models.RoleWaiter,models.RoleCashier},
+	InvoiceWrite:   {models.RoleManager,models.RoleWaiter,models.RoleCashier},
+	InvoicePay:     {models.RoleManager,models.RoleCashier},
+	UserRead:       {models.RoleManager},
+	UserWrite:      {models.RoleManager},
+	PinLogin:       {},
+}
+
+// Allow only lets through the callers holding a role that Policy grants the permission,
+// or an api key with the permission in its scopes. It runs after Authentication which
+// puts the roles of the token in the context.
+func Allow(permission string) gin.HandlerFunc{
+	return func(c *gin.Context) {
+		if Can(c,permission){
+			c.Next()
+			return
+		}
+		forbidden(c,"your role does not allow this")
+	}
+}
+
+// Can reports whether the caller has the permission, for the handlers that
+// check a permission on part of a request only. An api key has the permissions
+// of its scopes.
+func Can(c *gin.Context,permission string) bool{
+	if IsAdmin(c){
+		return true
+	}
+	if contains(c.GetStringSlice("scopes"),permission){
+		return true
+	}
+	for _,role := range c.GetStringSlice("roles"){
+		if contains(Policy[permission],role){
+			return true
+		}
+	}
+	return false
+}
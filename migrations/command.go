@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Command runs the "migrate" subcommand of the binary:
+//
+//	migrate up [-to version]
+//	migrate down [-steps n]
+//	migrate status
+func Command(ctx context.Context, db *mongo.Database, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+
+	runner := NewRunner(db)
+	logf := func(format string, a ...interface{}) {
+		fmt.Fprintf(out, format+"\n", a...)
+	}
+
+	switch args[0] {
+	case "up":
+		flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+		flags.SetOutput(out)
+		target := flags.Int("to", 0, "apply migrations up to and including this version (default: all)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := runner.Up(ctx, *target, logf); err != nil {
+			return err
+		}
+		logf("database is up to date")
+		return nil
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		flags.SetOutput(out)
+		steps := flags.Int("steps", 1, "number of applied migrations to roll back")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1")
+		}
+		return runner.Down(ctx, *steps, logf)
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = status.Applied_at.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, applied, status.Description)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+}
@@ -0,0 +1,168 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the collection recording which migrations have been applied
+const collectionName = "_migrations"
+
+// ErrIrreversible is returned when rolling back a migration that has no Down step
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// Migration is one versioned change to the indexes or the documents of the database.
+// Versions are applied in increasing order and must never be renumbered once released.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	// Down reverts Up, it is nil when the change cannot be undone
+	Down func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is the document stored in the _migrations collection for an applied migration
+type Record struct {
+	Version     int       `bson:"version" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	Applied_at  time.Time `bson:"applied_at" json:"applied_at"`
+}
+
+// Status describes a known migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied    bool
+	Applied_at time.Time
+}
+
+// Runner applies the registered migrations to a database
+type Runner struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+// NewRunner creates a runner for the built-in migrations
+func NewRunner(db *mongo.Database) *Runner {
+	return NewRunnerWith(db, All())
+}
+
+// NewRunnerWith creates a runner for an explicit list of migrations
+func NewRunnerWith(db *mongo.Database, list []Migration) *Runner {
+	sorted := append([]Migration(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Runner{db: db, migrations: sorted}
+}
+
+// applied returns the applied records keyed by version
+func (r *Runner) applied(ctx context.Context) (map[int]Record, error) {
+	cursor, err := r.db.Collection(collectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]Record, len(records))
+	for _, record := range records {
+		byVersion[record.Version] = record
+	}
+	return byVersion, nil
+}
+
+// Status lists every known migration with its applied state
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", collectionName, err)
+	}
+
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		record, ok := applied[m.Version]
+		statuses = append(statuses, Status{Migration: m, Applied: ok, Applied_at: record.Applied_at})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet
+func (r *Runner) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations up to and including target, a target of 0 applies all of them.
+// It stops at the first failure; the migrations applied before it stay recorded.
+func (r *Runner) Up(ctx context.Context, target int, log func(format string, args ...interface{})) error {
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		if target > 0 && m.Version > target {
+			break
+		}
+
+		log("applying %d: %s", m.Version, m.Description)
+		if err := m.Up(ctx, r.db); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+
+		record := Record{Version: m.Version, Description: m.Description, Applied_at: time.Now().UTC()}
+		_, err := r.db.Collection(collectionName).UpdateOne(ctx,
+			bson.M{"version": m.Version},
+			bson.M{"$set": record},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (r *Runner) Down(ctx context.Context, steps int, log func(format string, args ...interface{})) error {
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(statuses) - 1; i >= 0 && steps > 0; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		if status.Down == nil {
+			return fmt.Errorf("migration %d (%s): %w", status.Version, status.Description, ErrIrreversible)
+		}
+
+		log("rolling back %d: %s", status.Version, status.Description)
+		if err := status.Down(ctx, r.db); err != nil {
+			return fmt.Errorf("rolling back migration %d (%s) failed: %w", status.Version, status.Description, err)
+		}
+		if _, err := r.db.Collection(collectionName).DeleteOne(ctx, bson.M{"version": status.Version}); err != nil {
+			return fmt.Errorf("unrecording migration %d: %w", status.Version, err)
+		}
+		steps--
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"restaurant-backend/money"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the resource id field of every collection, the controllers look documents up by it
+var resourceIDs = []struct{ collection, field string }{
+	{"food", "food_id"},
+	{"menu", "menu_id"},
+	{"table", "table_id"},
+	{"order", "order_id"},
+	{"orderItems", "order_item_id"},
+	{"invoices", "invoice_id"},
+	{"users", "user_id"},
+}
+
+// All returns the built-in migrations. New migrations are appended with the next version.
+func All() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "backfill missing resource ids from _id",
+			Up:          backfillResourceIDs,
+			// the backfilled ids are valid data, rolling back leaves them in place
+			Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+		},
+		{
+			Version:     2,
+			Description: "unique indexes on resource ids and indexes on foreign keys",
+			Up:          createIndexes(resourceIndexes()...),
+			Down:        dropIndexes(resourceIndexes()...),
+		},
+		{
+			Version:     3,
+			Description: "unique indexes on users.email and users.phone",
+			Up:          createIndexes(userIndexes...),
+			Down:        dropIndexes(userIndexes...),
+		},
+		{
+			Version:     4,
+			Description: "indexes for the audit log searches",
+			Up:          createIndexes(auditIndexes...),
+			Down:        dropIndexes(auditIndexes...),
+		},
+		{
+			Version:     5,
+			Description: "start every document at version 1 for the If-Match checks",
+			Up:          backfillVersions,
+			// documents keep counting from where they are, the field is harmless without the checks
+			Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+		},
+		{
+			Version:     6,
+			Description: "move existing data into a default branch and index branch_id",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				if err := backfillBranches(ctx, db); err != nil {
+					return err
+				}
+				return createIndexes(branchIndexes()...)(ctx, db)
+			},
+			// the default branch and the memberships stay, only the indexes go
+			Down: dropIndexes(branchIndexes()...),
+		},
+		{
+			Version:     7,
+			Description: "store prices as whole cents with a currency instead of floats",
+			Up:          convertPrices(floatToMoney),
+			Down:        convertPrices(moneyToFloat),
+		},
+		{
+			Version:     8,
+			Description: "give the users without roles an empty list of roles",
+			Up:          backfillRoles,
+			// an empty list grants as little as a missing one
+			Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+		},
+		{
+			Version:     9,
+			Description: "lookup and TTL indexes for the revoked tokens",
+			Up:          createIndexes(revocationIndexes...),
+			Down:        dropIndexes(revocationIndexes...),
+		},
+		{
+			Version:     10,
+			Description: "lookup and TTL indexes for the mailed password reset and email verification tokens",
+			Up:          createIndexes(userTokenIndexes...),
+			Down:        dropIndexes(userTokenIndexes...),
+		},
+		{
+			Version:     11,
+			Description: "indexes for the login history and the failed login counters",
+			Up:          createIndexes(loginIndexes...),
+			Down:        dropIndexes(loginIndexes...),
+		},
+		{
+			Version:     12,
+			Description: "unique index on the id of the api keys",
+			Up:          createIndexes(apiKeyIndexes...),
+			Down:        dropIndexes(apiKeyIndexes...),
+		},
+	}
+}
+
+// backfillResourceIDs gives documents created by the old upserting handlers the id field
+// the unique indexes of version 2 require
+func backfillResourceIDs(ctx context.Context, db *mongo.Database) error {
+	for _, id := range resourceIDs {
+		filter := bson.M{"$or": bson.A{
+			bson.M{id.field: bson.M{"$exists": false}},
+			bson.M{id.field: nil},
+			bson.M{id.field: ""},
+		}}
+		update := mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{id.field: bson.M{"$toString": "$_id"}}}},
+		}
+		if _, err := db.Collection(id.collection).UpdateMany(ctx, filter, update); err != nil {
+			return fmt.Errorf("backfilling %s.%s: %w", id.collection, id.field, err)
+		}
+	}
+	return nil
+}
+
+// backfillVersions gives the documents written before versioning the version the handlers
+// expect in an If-Match header
+func backfillVersions(ctx context.Context, db *mongo.Database) error {
+	for _, id := range resourceIDs {
+		filter := bson.M{"version": bson.M{"$exists": false}}
+		update := bson.M{"$set": bson.M{"version": 1}}
+		if _, err := db.Collection(id.collection).UpdateMany(ctx, filter, update); err != nil {
+			return fmt.Errorf("backfilling %s.version: %w", id.collection, err)
+		}
+	}
+	return nil
+}
+
+// the collections whose documents carry a branch_id
+var branchCollections = []string{"food", "menu", "table", "order", "orderItems", "invoices", "audit_log"}
+
+// defaultBranchName names the branch the data written before branches is moved into
+const defaultBranchName = "Main"
+
+// backfillBranches puts every document without a branch_id and every user without a
+// branch into the default branch, creating it when there is no branch yet
+func backfillBranches(ctx context.Context, db *mongo.Database) error {
+	branches := db.Collection("branches")
+	var branch struct {
+		BranchID string `bson:"branch_id"`
+	}
+	err := branches.FindOne(ctx, bson.M{"name": defaultBranchName, "deleted_at": nil}).Decode(&branch)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		now := time.Now().UTC().Truncate(time.Second)
+		id := primitive.NewObjectID()
+		branch.BranchID = id.Hex()
+		doc := bson.M{"_id": id, "branch_id": branch.BranchID, "name": defaultBranchName, "created_at": now, "updated_at": now, "version": 1}
+		if _, err := branches.InsertOne(ctx, doc); err != nil {
+			return fmt.Errorf("creating the %s branch: %w", defaultBranchName, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("looking up the %s branch: %w", defaultBranchName, err)
+	}
+
+	missing := bson.M{"$or": bson.A{
+		bson.M{"branch_id": bson.M{"$exists": false}},
+		bson.M{"branch_id": nil},
+		bson.M{"branch_id": ""},
+	}}
+	for _, name := range branchCollections {
+		update := bson.M{"$set": bson.M{"branch_id": branch.BranchID}}
+		if _, err := db.Collection(name).UpdateMany(ctx, missing, update); err != nil {
+			return fmt.Errorf("backfilling %s.branch_id: %w", name, err)
+		}
+	}
+
+	noBranches := bson.M{"$or": bson.A{
+		bson.M{"branches": bson.M{"$exists": false}},
+		bson.M{"branches": nil},
+		bson.M{"branches": bson.A{}},
+	}}
+	update := bson.M{"$set": bson.M{"branches": bson.A{branch.BranchID}}}
+	if _, err := db.Collection("users").UpdateMany(ctx, noBranches, update); err != nil {
+		return fmt.Errorf("backfilling users.branches: %w", err)
+	}
+	return nil
+}
+
+// every scoped query filters on the branch first
+func branchIndexes() []index {
+	list := []index{
+		{collection: "branches", name: "branch_id_unique", keys: bson.D{{Key: "branch_id", Value: 1}}, unique: true},
+		{collection: "users", name: "branches", keys: bson.D{{Key: "branches", Value: 1}}},
+	}
+	for _, name := range branchCollections {
+		list = append(list, index{collection: name, name: "branch_id", keys: bson.D{{Key: "branch_id", Value: 1}}})
+	}
+	return list
+}
+
+// backfillRoles gives the users created before roles no role at all. Every signed in user
+// could change anything then, guessing a role for them would hand that on to accounts
+// nobody reviewed, so an admin assigns the roles instead.
+func backfillRoles(ctx context.Context, db *mongo.Database) error {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"roles": bson.M{"$exists": false}},
+		bson.M{"roles": nil},
+	}}
+	update := bson.M{"$set": bson.M{"roles": bson.A{}}}
+	if _, err := db.Collection("users").UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("backfilling users.roles: %w", err)
+	}
+	return nil
+}
+
+// the price fields, their documents are converted one by one so the conversion is done in Go
+// with the rounding of the money package rather than with float arithmetic in the server
+var priceFields = []struct{ collection, field string }{
+	{"food", "price"},
+	{"orderItems", "unit_price"},
+}
+
+// convertPrices rewrites every price the conversion recognizes, it skips the others so it
+// can be rerun after a partial run
+func convertPrices(convert func(value bson.RawValue) (interface{}, bool, error)) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, price := range priceFields {
+			coll := db.Collection(price.collection)
+			filter := bson.M{price.field: bson.M{"$exists": true, "$ne": nil}}
+			cursor, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{price.field: 1}))
+			if err != nil {
+				return fmt.Errorf("reading %s.%s: %w", price.collection, price.field, err)
+			}
+			for cursor.Next(ctx) {
+				value := cursor.Current.Lookup(price.field)
+				converted, ok, err := convert(value)
+				if err != nil {
+					cursor.Close(ctx)
+					return fmt.Errorf("converting %s.%s of %v: %w", price.collection, price.field, cursor.Current.Lookup("_id"), err)
+				}
+				if !ok {
+					continue
+				}
+				update := bson.M{"$set": bson.M{price.field: converted}}
+				if _, err := coll.UpdateOne(ctx, bson.M{"_id": cursor.Current.Lookup("_id")}, update); err != nil {
+					cursor.Close(ctx)
+					return fmt.Errorf("updating %s.%s: %w", price.collection, price.field, err)
+				}
+			}
+			err = cursor.Err()
+			cursor.Close(ctx)
+			if err != nil {
+				return fmt.Errorf("reading %s.%s: %w", price.collection, price.field, err)
+			}
+		}
+		return nil
+	}
+}
+
+// floatToMoney turns a number into cents of the configured currency
+func floatToMoney(value bson.RawValue) (interface{}, bool, error) {
+	var amount float64
+	switch value.Type {
+	case bsontype.Double:
+		amount = value.Double()
+	case bsontype.Int32:
+		amount = float64(value.Int32())
+	case bsontype.Int64:
+		amount = float64(value.Int64())
+	default:
+		return nil, false, nil
+	}
+	converted, err := money.FromFloat(amount, "")
+	return converted, err == nil, err
+}
+
+// moneyToFloat turns cents back into a number, whatever their currency
+func moneyToFloat(value bson.RawValue) (interface{}, bool, error) {
+	if value.Type != bsontype.EmbeddedDocument {
+		return nil, false, nil
+	}
+	var amount money.Money
+	if err := value.Unmarshal(&amount); err != nil {
+		return nil, false, err
+	}
+	converted, err := strconv.ParseFloat(amount.Decimal(), 64)
+	return converted, err == nil, err
+}
+
+// index describes an index created by a migration. Every index is named so it can be dropped again.
+type index struct {
+	collection string
+	name       string
+	keys       bson.D
+	unique     bool
+	partial    bson.M
+	// expireAfter makes a TTL index removing documents that many seconds after the indexed date
+	expireAfter *int32
+}
+
+func resourceIndexes() []index {
+	list := make([]index, 0, len(resourceIDs)+5)
+	for _, id := range resourceIDs {
+		list = append(list, index{
+			collection: id.collection,
+			name:       id.field + "_unique",
+			keys:       bson.D{{Key: id.field, Value: 1}},
+			unique:     true,
+		})
+	}
+	return append(list,
+		index{collection: "food", name: "menu_id", keys: bson.D{{Key: "menu_id", Value: 1}}},
+		index{collection: "order", name: "table_id", keys: bson.D{{Key: "table_id", Value: 1}}},
+		index{collection: "orderItems", name: "order_id", keys: bson.D{{Key: "order_id", Value: 1}}},
+		index{collection: "orderItems", name: "food_id", keys: bson.D{{Key: "food_id", Value: 1}}},
+		index{collection: "invoices", name: "order_id", keys: bson.D{{Key: "order_id", Value: 1}}},
+	)
+}
+
+// only documents that actually carry the field take part in the uniqueness check. The
+// soft-deleted users do as well, a partial filter can not match a missing deleted_at and a restore
+// must not find their email taken.
+var userIndexes = []index{
+	{collection: "users", name: "email_unique", keys: bson.D{{Key: "email", Value: 1}}, unique: true, partial: bson.M{"email": bson.M{"$type": "string"}}},
+	{collection: "users", name: "phone_unique", keys: bson.D{{Key: "phone", Value: 1}}, unique: true, partial: bson.M{"phone": bson.M{"$type": "string"}}},
+}
+
+// GET /audit filters by resource or actor and a range of dates
+var auditIndexes = []index{
+	{collection: "audit_log", name: "resource_created_at", keys: bson.D{{Key: "resource", Value: 1}, {Key: "created_at", Value: 1}}},
+	{collection: "audit_log", name: "actor_uid_created_at", keys: bson.D{{Key: "actor_uid", Value: 1}, {Key: "created_at", Value: 1}}},
+	{collection: "audit_log", name: "created_at", keys: bson.D{{Key: "created_at", Value: 1}}},
+}
+
+var expireAtDate int32 = 0
+
+// the authentication middleware looks tokens up by jti and by user, and the entries
+// go away once the tokens they revoke have expired
+var revocationIndexes = []index{
+	{collection: "revoked_tokens", name: "jti", keys: bson.D{{Key: "jti", Value: 1}}},
+	{collection: "revoked_tokens", name: "user_id_created_at", keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	{collection: "revoked_tokens", name: "expires_at_ttl", keys: bson.D{{Key: "expires_at", Value: 1}}, expireAfter: &expireAtDate},
+}
+
+// the tokens are looked up by their hash and removed once they expired, used or not
+var userTokenIndexes = []index{
+	{collection: "user_tokens", name: "token_hash", keys: bson.D{{Key: "token_hash", Value: 1}}, unique: true},
+	{collection: "user_tokens", name: "expires_at_ttl", keys: bson.D{{Key: "expires_at", Value: 1}}, expireAfter: &expireAtDate},
+}
+
+// the history is listed per user and kept for 90 days, a counter is looked up by its key
+// and goes away once its failures are forgotten
+var loginIndexes = []index{
+	{collection: "login_attempts", name: "user_id", keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+	{collection: "login_attempts", name: "expires_at_ttl", keys: bson.D{{Key: "expires_at", Value: 1}}, expireAfter: &expireAtDate},
+	{collection: "login_throttles", name: "key", keys: bson.D{{Key: "key", Value: 1}}, unique: true},
+	{collection: "login_throttles", name: "expires_at_ttl", keys: bson.D{{Key: "expires_at", Value: 1}}, expireAfter: &expireAtDate},
+}
+
+// the authentication middleware looks every api key up by its id
+var apiKeyIndexes = []index{
+	{collection: "api_keys", name: "key_id", keys: bson.D{{Key: "key_id", Value: 1}}, unique: true},
+}
+
+func createIndexes(list ...index) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, idx := range list {
+			opts := options.Index().SetName(idx.name)
+			if idx.unique {
+				opts.SetUnique(true)
+			}
+			if idx.partial != nil {
+				opts.SetPartialFilterExpression(idx.partial)
+			}
+			if idx.expireAfter != nil {
+				opts.SetExpireAfterSeconds(*idx.expireAfter)
+			}
+			_, err := db.Collection(idx.collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: idx.keys, Options: opts})
+			if err != nil {
+				return fmt.Errorf("creating index %s on %s: %w", idx.name, idx.collection, err)
+			}
+		}
+		return nil
+	}
+}
+
+func dropIndexes(list ...index) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, idx := range list {
+			_, err := db.Collection(idx.collection).Indexes().DropOne(ctx, idx.name)
+			if err != nil && !isNotFound(err) {
+				return fmt.Errorf("dropping index %s on %s: %w", idx.name, idx.collection, err)
+			}
+		}
+		return nil
+	}
+}
+
+// isNotFound reports whether the server said the index or the collection does not exist
+func isNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		// 26 NamespaceNotFound, 27 IndexNotFound
+		return cmdErr.Code == 26 || cmdErr.Code == 27
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the json tag is used to represent the JSON key
+// an api key lets a device like a kitchen display call the api without a user logging in,
+// only the hash of its secret is stored
+
+type APIKey struct{
+	ID                 primitive.ObjectID       `bson:"_id"`
+	Name              *string                   `json:"name" validate:"required,min=2,max=100"`
+	// the permissions of middleware.Policy the key is granted
+	Scopes             []string                 `json:"scopes" validate:"required,min=1"`
+	// the only branch the key can work on, every branch when empty
+	Branch_id         *string                   `json:"branch_id"`
+	// the key stops working then, it never expires when empty
+	Expires_at        *time.Time                `json:"expires_at"`
+	Secret_hash        string                   `json:"-"`
+	// the beginning of the key, to tell keys apart without showing them
+	Prefix             string                   `json:"prefix"`
+	Last_used_at      *time.Time                `json:"last_used_at"`
+	Revoked_at        *time.Time                `json:"revoked_at"`
+	Created_by         string                   `json:"created_by"`
+	Created_at         time.Time                `json:"created_at"`
+	Updated_at         time.Time                `json:"updated_at"`
+	Version            int64                    `json:"version"`
+	Key_id             string                   `json:"key_id"`
+}
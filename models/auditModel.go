@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the json tag is used to represent the JSON key
+// an audit entry is written for every create, update and delete done through the handlers
+
+type AuditEntry struct{
+	ID                 primitive.ObjectID       `bson:"_id"`
+	Audit_id           string                   `json:"audit_id"`
+	Actor_uid          string                   `json:"actor_uid"`
+	Resource           string                   `json:"resource"`
+	Resource_id        string                   `json:"resource_id"`
+	Action             string                   `json:"action"`
+	Changes            []FieldChange            `json:"changes"`
+	Request_id         string                   `json:"request_id"`
+	Created_at         time.Time                `json:"created_at"`
+	Branch_id          string                   `json:"branch_id"`
+}
+
+// FieldChange holds the value of one field before and after the change,
+// a created field has no before and a removed one has no after
+type FieldChange struct{
+	Field              string                   `json:"field"`
+	Before             interface{}              `json:"before"`
+	After              interface{}              `json:"after"`
+}
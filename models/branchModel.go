@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the json tag is used to represent the JSON key
+// a branch is one location of the restaurant group, every other document belongs to one
+
+type Branch struct{
+	ID                 primitive.ObjectID       `bson:"_id"`
+	Name              *string                   `json:"name" validate:"required,min=2,max=100"`
+	Address           *string                   `json:"address"`
+	// the IANA timezone the menu schedules of the branch are read in, "Europe/Berlin",
+	// the configured timezone when empty
+	Timezone          *string                   `json:"timezone"`
+	Created_at         time.Time                `json:"created_at"`
+	Updated_at         time.Time                `json:"updated_at"`
+	Deleted_at        *time.Time                `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version            int64                    `json:"version"`
+	Branch_id          string                   `json:"branch_id"`
+}
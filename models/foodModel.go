@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"restaurant-backend/money"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,10 +15,140 @@ import (
 type Food struct{
 	ID           primitive.ObjectID   `bson:"_id"`
 	Name         *string                `json:"name" validate:"required,min=2,max=100"`
-	Price        *float64               `json:"price" validate:"required"`
+	Price        *money.Money           `json:"price" validate:"required"`
 	Food_image   *string                `json:"food_image" validate:"required"`
 	Created_at   time.Time              `json:"created_at"`
 	Updated_at   time.Time              `json:"updated_at"`
+	Deleted_at  *time.Time             `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version     int64                  `json:"version"`
 	Food_id      string                 `json:"food_id"`
 	Menu_id      *string                `json:"menu_id" validate:"required"`
+	// the choices offered with the food, like its size or the add-ons
+	Modifier_groups []ModifierGroup      `json:"modifier_groups" validate:"omitempty,dive"`
+	Branch_id    string                 `json:"branch_id"`
+}
+
+// a modifier group is one choice offered with a food. Between Min_selections and
+// Max_selections of its options are picked, a Required group needs at least one and
+// a Max_selections of 0 allows every option. A group of one option picked at most once
+// is an add-on or a "no onions".
+
+type ModifierGroup struct{
+	Group_id        string              `json:"group_id"`
+	Name           *string              `json:"name" validate:"required,min=1,max=100"`
+	Required        bool                `json:"required"`
+	Min_selections  int                 `json:"min_selections" validate:"min=0"`
+	Max_selections  int                 `json:"max_selections" validate:"min=0"`
+	Options         []ModifierOption    `json:"options" validate:"required,min=1,dive"`
+}
+
+// a modifier option is one pick of a group, its Price_delta is added to the price of the
+// food and may be negative. An option without one costs nothing.
+
+type ModifierOption struct{
+	Option_id       string              `json:"option_id"`
+	Name           *string              `json:"name" validate:"required,min=1,max=100"`
+	Price_delta    *money.Money         `json:"price_delta"`
+}
+
+// Selections returns how many options of the group have to be picked at least and may be
+// picked at most
+func (g ModifierGroup) Selections() (int,int){
+	min,max := g.Min_selections,g.Max_selections
+	if g.Required && min == 0{
+		min = 1
+	}
+	if max == 0{
+		max = len(g.Options)
+	}
+	return min,max
+}
+
+// CheckModifierGroups reports the first group of the food that can not be ordered the way
+// it is described, the ids have to be set and the deltas have to be in the currency of the price
+func (f Food) CheckModifierGroups() error{
+	groups := map[string]bool{}
+	options := map[string]bool{}
+	for i,group := range f.Modifier_groups{
+		if group.Group_id == "" || groups[group.Group_id]{
+			return fmt.Errorf("modifier group %d: group_id %q is missing or used twice",i,group.Group_id)
+		}
+		groups[group.Group_id] = true
+		min,max := group.Selections()
+		if min > max || max > len(group.Options){
+			return fmt.Errorf("modifier group %q: %d to %d of its %d options can not be picked",*group.Name,min,max,len(group.Options))
+		}
+		for j,option := range group.Options{
+			if option.Option_id == "" || options[option.Option_id]{
+				return fmt.Errorf("modifier group %q option %d: option_id %q is missing or used twice",*group.Name,j,option.Option_id)
+			}
+			options[option.Option_id] = true
+			if option.Price_delta != nil && f.Price != nil && option.Price_delta.Currency != f.Price.Currency{
+				return fmt.Errorf("modifier group %q option %q: the price delta is in %s, the food is priced in %s",*group.Name,*option.Name,option.Price_delta.Currency,f.Price.Currency)
+			}
+		}
+	}
+	return nil
+}
+
+// ChooseModifiers checks the options picked for an order of the food against its groups and
+// returns them with the names and the price deltas of the food, in the order of the groups
+func (f Food) ChooseModifiers(picked []OrderItemModifier) ([]OrderItemModifier,error){
+	// the group of an option may be left out, the option ids of a food are unique
+	chosen := map[string]string{}
+	for _,pick := range picked{
+		if _,ok := chosen[pick.Option_id]; ok{
+			return nil,fmt.Errorf("option %s is picked twice",pick.Option_id)
+		}
+		chosen[pick.Option_id] = pick.Group_id
+	}
+
+	modifiers := []OrderItemModifier{}
+	found := 0
+	for _,group := range f.Modifier_groups{
+		count := 0
+		for _,option := range group.Options{
+			groupId,ok := chosen[option.Option_id]
+			if !ok{
+				continue
+			}
+			if groupId != "" && groupId != group.Group_id{
+				return nil,fmt.Errorf("option %s belongs to the group %s",option.Option_id,group.Group_id)
+			}
+			count++
+			delta := money.Zero("")
+			if f.Price != nil{
+				delta = money.Zero(f.Price.Currency)
+			}
+			if option.Price_delta != nil{
+				delta = *option.Price_delta
+			}
+			modifiers = append(modifiers,OrderItemModifier{
+				Group_id: group.Group_id,
+				Option_id: option.Option_id,
+				Group_name: *group.Name,
+				Name: *option.Name,
+				Price_delta: delta,
+			})
+		}
+		found += count
+		min,max := group.Selections()
+		if count < min || count > max{
+			return nil,fmt.Errorf("pick %s of %q",selectionRange(min,max),*group.Name)
+		}
+	}
+	if found != len(chosen){
+		return nil,fmt.Errorf("some of the picked options are not offered with the food")
+	}
+	return modifiers,nil
+}
+
+func selectionRange(min int,max int) string{
+	switch {
+	case min == max:
+		return fmt.Sprint(min)
+	case min == 0:
+		return fmt.Sprintf("at most %d",max)
+	}
+	return fmt.Sprintf("%d to %d",min,max)
 }
\ No newline at end of file
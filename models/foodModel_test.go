@@ -0,0 +1,137 @@
+package models
+
+import (
+	"restaurant-backend/money"
+	"testing"
+)
+
+func text(value string) *string{
+	return &value
+}
+
+func price(amount int64) *money.Money{
+	m := money.New(amount,"USD")
+	return &m
+}
+
+// a burger with a size to pick, up to two add-ons and an optional "no onions"
+func burger() Food{
+	return Food{
+		Name: text("Burger"),
+		Price: price(900),
+		Modifier_groups: []ModifierGroup{
+			{Group_id: "size",Name: text("Size"),Required: true,Max_selections: 1,Options: []ModifierOption{
+				{Option_id: "small",Name: text("Small"),Price_delta: price(-100)},
+				{Option_id: "large",Name: text("Large"),Price_delta: price(250)},
+			}},
+			{Group_id: "extras",Name: text("Extras"),Max_selections: 2,Options: []ModifierOption{
+				{Option_id: "cheese",Name: text("Cheese"),Price_delta: price(75)},
+				{Option_id: "bacon",Name: text("Bacon"),Price_delta: price(150)},
+				{Option_id: "egg",Name: text("Egg"),Price_delta: price(100)},
+			}},
+			{Group_id: "onions",Name: text("Onions"),Options: []ModifierOption{
+				{Option_id: "no_onions",Name: text("No onions")},
+			}},
+		},
+	}
+}
+
+func TestSelections(t *testing.T){
+	food := burger()
+	for i,want := range [][2]int{{1,1},{0,2},{0,1}}{
+		if min,max := food.Modifier_groups[i].Selections(); min != want[0] || max != want[1]{
+			t.Errorf("group %d: %d to %d selections, want %d to %d",i,min,max,want[0],want[1])
+		}
+	}
+}
+
+func TestCheckModifierGroups(t *testing.T){
+	if err := burger().CheckModifierGroups(); err != nil{
+		t.Errorf("the burger should be valid: %v",err)
+	}
+	if err := (Food{Price: price(100)}).CheckModifierGroups(); err != nil{
+		t.Errorf("a food without groups should be valid: %v",err)
+	}
+
+	invalid := map[string]func(f *Food){
+		"a group without an id": func(f *Food){ f.Modifier_groups[0].Group_id = "" },
+		"a group id used twice": func(f *Food){ f.Modifier_groups[1].Group_id = "size" },
+		"an option without an id": func(f *Food){ f.Modifier_groups[1].Options[0].Option_id = "" },
+		"an option id used twice": func(f *Food){ f.Modifier_groups[1].Options[0].Option_id = "small" },
+		"more to pick than offered": func(f *Food){ f.Modifier_groups[1].Max_selections = 4 },
+		"a minimum above the maximum": func(f *Food){ f.Modifier_groups[1].Min_selections = 3 },
+		"a delta in another currency": func(f *Food){
+			euros := money.New(50,"EUR")
+			f.Modifier_groups[1].Options[2].Price_delta = &euros
+		},
+	}
+	for name,change := range invalid{
+		food := burger()
+		change(&food)
+		if err := food.CheckModifierGroups(); err == nil{
+			t.Errorf("%s: expected an error",name)
+		}
+	}
+}
+
+func TestChooseModifiers(t *testing.T){
+	food := burger()
+
+	modifiers,err := food.ChooseModifiers([]OrderItemModifier{
+		{Option_id: "no_onions"},
+		{Option_id: "bacon",Group_id: "extras"},
+		{Option_id: "large"},
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	// in the order of the groups, with the names and deltas of the food
+	want := []OrderItemModifier{
+		{Group_id: "size",Option_id: "large",Group_name: "Size",Name: "Large",Price_delta: *price(250)},
+		{Group_id: "extras",Option_id: "bacon",Group_name: "Extras",Name: "Bacon",Price_delta: *price(150)},
+		{Group_id: "onions",Option_id: "no_onions",Group_name: "Onions",Name: "No onions",Price_delta: *price(0)},
+	}
+	if len(modifiers) != len(want){
+		t.Fatalf("expected %d modifiers, got %v",len(want),modifiers)
+	}
+	for i := range want{
+		if modifiers[i] != want[i]{
+			t.Errorf("modifier %d = %+v, want %+v",i,modifiers[i],want[i])
+		}
+	}
+
+	item := OrderItem{Modifiers: modifiers}
+	if total,err := item.ModifiersPrice("USD"); err != nil || total != money.New(400,"USD"){
+		t.Errorf("the modifiers cost %s, %v, want 4.00 USD",total,err)
+	}
+
+	refused := map[string][]OrderItemModifier{
+		"no size": {{Option_id: "cheese"}},
+		"two sizes": {{Option_id: "small"},{Option_id: "large"}},
+		"three extras": {{Option_id: "small"},{Option_id: "cheese"},{Option_id: "bacon"},{Option_id: "egg"}},
+		"picked twice": {{Option_id: "small"},{Option_id: "cheese"},{Option_id: "cheese"}},
+		"the wrong group": {{Option_id: "small",Group_id: "extras"}},
+		"not offered": {{Option_id: "small"},{Option_id: "truffle"}},
+	}
+	for name,picked := range refused{
+		if _,err := food.ChooseModifiers(picked); err == nil{
+			t.Errorf("%s: expected an error",name)
+		}
+	}
+}
+
+func TestCount(t *testing.T){
+	for quantity,want := range map[string]int64{"1": 1," 3 ": 3,"12": 12}{
+		if count,err := (OrderItem{Quantity: text(quantity)}).Count(); err != nil || count != want{
+			t.Errorf("quantity %q counts %d, %v, want %d",quantity,count,err,want)
+		}
+	}
+	if count,err := (OrderItem{}).Count(); err != nil || count != 1{
+		t.Errorf("an item without a quantity counts %d, %v, want 1",count,err)
+	}
+	for _,quantity := range []string{"0","-2","1.5","two",""}{
+		if _,err := (OrderItem{Quantity: text(quantity)}).Count(); err == nil{
+			t.Errorf("quantity %q should be refused",quantity)
+		}
+	}
+}
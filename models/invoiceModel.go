@@ -18,4 +18,7 @@ type Invoice struct{
 	Payment_due_date    time.Time                 `json:"payment_due_date"`
 	Created_at          time.Time                 `json:"created_at"`    
 	Updated_at          time.Time                 `json:"updated_at"`
+	Deleted_at         *time.Time                `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version            int64                     `json:"version"`
+	Branch_id          string                    `json:"branch_id"`
 }
\ No newline at end of file
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the json tag is used to represent the JSON key
+// a login attempt is one call of the login endpoint, successful or not, it is kept
+// for the history the users can look at until a TTL index removes it
+
+type LoginAttempt struct{
+	ID                 primitive.ObjectID       `bson:"_id"`
+	Email              string                   `json:"email"`
+	// empty when no user has the email
+	User_id            string                   `json:"user_id"`
+	Ip                 string                   `json:"ip"`
+	User_agent         string                   `json:"user_agent"`
+	Success            bool                     `json:"success"`
+	// why the attempt failed: "wrong_password", "unknown_email", "wrong_mfa_code" or "wrong_pin".
+	// Attempts refused before the password was checked, while throttled or locked, are not recorded.
+	Reason             string                   `json:"reason,omitempty"`
+	// the api key of the shared terminal a PIN was typed in on, empty for the other logins
+	Terminal_id        string                   `json:"terminal_id,omitempty"`
+	Created_at         time.Time                `json:"created_at"`
+	Expires_at         time.Time                `json:"-"`
+}
+
+// a login throttle counts the recent failed logins of one email or one client ip
+
+type LoginThrottle struct{
+	ID                 primitive.ObjectID       `bson:"_id"`
+	// "email:<email>", "ip:<address>", "pin:<user_id>" or "terminal:<key_id>"
+	Key                string                   `json:"key"`
+	Failures           int64                    `json:"failures"`
+	Last_failure_at    time.Time                `json:"last_failure_at"`
+	// set once the email or the PIN failed too often, nobody can log in with it until then
+	Locked_until       *time.Time               `json:"locked_until"`
+	// the counter starts over after this, a TTL index removes it
+	Expires_at         time.Time                `json:"expires_at"`
+}
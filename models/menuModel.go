@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -10,13 +13,192 @@ import (
 // json tag is used to represent the JSON key
 // the bson id is used to correspond to the MongoDB client field id
 
+// a menu is available from Start_date until End_date, both are optional, and then in one of
+// the windows of its Schedule, all day when it has none. The Exceptions change single dates,
+// a holiday closes the menu or opens it at other hours. The hours are in the timezone of the
+// branch, see ActiveAt.
+
 type Menu struct{
 	ID             primitive.ObjectID          `bson:"_id"`
 	Name           string                  `json:"name" validate:"required"`
 	Category       string                  `json:"category" validate:"required"`
 	Start_date    *time.Time               `json:"start_date"`
 	End_date      *time.Time               `json:"end_date"`
+	Schedule       []MenuWindow            `json:"schedule" validate:"omitempty,dive"`
+	Exceptions     []MenuException         `json:"exceptions" validate:"omitempty,dive"`
 	Created_at     time.Time               `json:"created_at"`
 	Updated_at     time.Time               `json:"updated-at"`
+	Deleted_at    *time.Time              `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version       int64                   `json:"version"`
 	Menu_id        string                  `json:"menu_id"`
-}
\ No newline at end of file
+	Branch_id      string                  `json:"branch_id"`
+}
+
+// a menu window is a recurring time of the week the menu is served, breakfast is
+// {"days": ["mon","tue","wed","thu","fri"], "start": "07:00", "end": "11:00"}. A window
+// ending at or before its start runs past midnight into the next day.
+
+type MenuWindow struct{
+	Days           []string                `json:"days" validate:"required,min=1,dive,oneof=mon tue wed thu fri sat sun"`
+	Start          string                  `json:"start" validate:"required"`
+	End            string                  `json:"end" validate:"required"`
+}
+
+// a menu exception replaces the schedule on one date, "2026-12-25". A closed menu is not
+// served that day, otherwise it is served from Start to End, or all day without them.
+
+type MenuException struct{
+	Date           string                  `json:"date" validate:"required"`
+	Closed         bool                    `json:"closed"`
+	Start          string                  `json:"start,omitempty"`
+	End            string                  `json:"end,omitempty"`
+}
+
+// DefaultLocation is the timezone of the branches that have none, set by main from the config
+var DefaultLocation = time.UTC
+
+var weekdays = []string{"sun","mon","tue","wed","thu","fri","sat"}
+
+const dateLayout = "2006-01-02"
+
+// clock parses a time of the day "HH:MM" into minutes after midnight, "24:00" is the end of the day
+func clock(value string) (int,error){
+	hours,minutes,found := strings.Cut(value,":")
+	h,hErr := strconv.Atoi(hours)
+	m,mErr := strconv.Atoi(minutes)
+	if !found || len(hours) != 2 || len(minutes) != 2 || hErr != nil || mErr != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0){
+		return 0,fmt.Errorf("%q is not a time of the day like 07:30",value)
+	}
+	return h*60 + m,nil
+}
+
+// CheckSchedule reports the first window or exception of the menu that can not be
+// understood, and dates that end before they start
+func (m Menu) CheckSchedule() error{
+	if m.Start_date != nil && m.End_date != nil && !m.End_date.After(*m.Start_date){
+		return fmt.Errorf("end_date has to be after start_date")
+	}
+	for i,window := range m.Schedule{
+		start,err := clock(window.Start)
+		if err != nil{
+			return fmt.Errorf("schedule %d: start %v",i,err)
+		}
+		end,err := clock(window.End)
+		if err != nil{
+			return fmt.Errorf("schedule %d: end %v",i,err)
+		}
+		if start == end{
+			return fmt.Errorf("schedule %d: start and end are the same time",i)
+		}
+	}
+	seen := map[string]bool{}
+	for i,exception := range m.Exceptions{
+		if _,err := time.Parse(dateLayout,exception.Date); err != nil{
+			return fmt.Errorf("exceptions %d: %q is not a date like 2026-12-25",i,exception.Date)
+		}
+		if seen[exception.Date]{
+			return fmt.Errorf("exceptions %d: %s has more than one exception",i,exception.Date)
+		}
+		seen[exception.Date] = true
+		if exception.Closed && (exception.Start != "" || exception.End != ""){
+			return fmt.Errorf("exceptions %d: a closed day has no hours",i)
+		}
+		if (exception.Start == "") != (exception.End == ""){
+			return fmt.Errorf("exceptions %d: send both start and end, or neither for the whole day",i)
+		}
+		if exception.Start != ""{
+			start,err := clock(exception.Start)
+			if err != nil{
+				return fmt.Errorf("exceptions %d: start %v",i,err)
+			}
+			end,err := clock(exception.End)
+			if err != nil{
+				return fmt.Errorf("exceptions %d: end %v",i,err)
+			}
+			if start == end{
+				return fmt.Errorf("exceptions %d: start and end are the same time",i)
+			}
+		}
+	}
+	return nil
+}
+
+// ActiveAt reports whether the menu is served at the moment t, its hours are read in the
+// timezone loc. A window running past midnight is served until it ends on the next day.
+func (m Menu) ActiveAt(t time.Time,loc *time.Location) bool{
+	if m.Start_date != nil && t.Before(*m.Start_date){
+		return false
+	}
+	if m.End_date != nil && !t.Before(*m.End_date){
+		return false
+	}
+
+	local := t.In(loc)
+	// the windows of the day before may still be running
+	for _,day := range []time.Time{local.AddDate(0,0,-1),local}{
+		for _,window := range m.windowsOn(day){
+			year,month,date := day.Date()
+			start := time.Date(year,month,date,0,window[0],0,0,loc)
+			end := time.Date(year,month,date,0,window[1],0,0,loc)
+			if window[1] <= window[0]{
+				end = time.Date(year,month,date+1,0,window[1],0,0,loc)
+			}
+			if !local.Before(start) && local.Before(end){
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// windowsOn returns the windows of the day, as minutes after midnight, that the menu is
+// served in: the ones of its exception for the date, else the ones of its schedule for
+// the weekday, else the whole day
+func (m Menu) windowsOn(day time.Time) [][2]int{
+	allDay := [][2]int{{0,24*60}}
+	date := day.Format(dateLayout)
+	for _,exception := range m.Exceptions{
+		if exception.Date != date{
+			continue
+		}
+		if exception.Closed{
+			return nil
+		}
+		if exception.Start == ""{
+			return allDay
+		}
+		start,startErr := clock(exception.Start)
+		end,endErr := clock(exception.End)
+		if startErr != nil || endErr != nil{
+			return nil
+		}
+		return [][2]int{{start,end}}
+	}
+
+	if len(m.Schedule) == 0{
+		return allDay
+	}
+	weekday := weekdays[day.Weekday()]
+	windows := [][2]int{}
+	for _,window := range m.Schedule{
+		if !containsDay(window.Days,weekday){
+			continue
+		}
+		start,startErr := clock(window.Start)
+		end,endErr := clock(window.End)
+		if startErr != nil || endErr != nil{
+			continue
+		}
+		windows = append(windows,[2]int{start,end})
+	}
+	return windows
+}
+
+func containsDay(days []string,day string) bool{
+	for _,item := range days{
+		if item == day{
+			return true
+		}
+	}
+	return false
+}
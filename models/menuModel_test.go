@@ -0,0 +1,97 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// a branch two hours east of UTC
+var testLocation = time.FixedZone("UTC+2",2*60*60)
+
+func at(value string) time.Time{
+	t,err := time.ParseInLocation("2006-01-02 15:04",value,testLocation)
+	if err != nil{
+		panic(err)
+	}
+	return t
+}
+
+func TestActiveAt(t *testing.T){
+	breakfast := Menu{Schedule: []MenuWindow{{Days: []string{"mon","tue","wed","thu","fri"},Start: "07:00",End: "11:00"}}}
+	late := Menu{Schedule: []MenuWindow{{Days: []string{"fri","sat"},Start: "22:00",End: "02:00"}}}
+	christmas := Menu{
+		Schedule: []MenuWindow{{Days: []string{"fri"},Start: "07:00",End: "11:00"}},
+		Exceptions: []MenuException{{Date: "2026-12-25",Start: "12:00",End: "15:00"},{Date: "2027-01-01",Closed: true}},
+	}
+	start,end := at("2026-11-01 00:00"),at("2026-12-01 00:00")
+	seasonal := Menu{Start_date: &start,End_date: &end}
+
+	cases := []struct {
+		name string
+		menu Menu
+		at string
+		active bool
+	}{
+		{"monday breakfast",breakfast,"2026-10-19 07:00",true},
+		{"the end is not served",breakfast,"2026-10-19 11:00",false},
+		{"before breakfast",breakfast,"2026-10-19 06:59",false},
+		{"sunday",breakfast,"2026-10-18 08:00",false},
+		{"no schedule is all day",Menu{},"2026-10-18 03:00",true},
+		{"friday night",late,"2026-10-23 23:30",true},
+		{"past midnight into saturday",late,"2026-10-24 01:59",true},
+		{"past midnight into sunday",late,"2026-10-25 01:00",true},
+		{"past midnight into monday",late,"2026-10-19 01:00",false},
+		{"over at two",late,"2026-10-24 02:00",false},
+		{"the hours of the exception",christmas,"2026-12-25 13:00",true},
+		{"the schedule does not count on an exception",christmas,"2026-12-25 08:00",false},
+		{"closed",Menu{Exceptions: christmas.Exceptions},"2027-01-01 12:00",false},
+		{"the schedule on other fridays",christmas,"2026-12-18 08:00",true},
+		{"before the start date",seasonal,"2026-10-31 23:59",false},
+		{"from the start date",seasonal,"2026-11-01 00:00",true},
+		{"until the end date",seasonal,"2026-12-01 00:00",false},
+	}
+	for _,c := range cases{
+		if active := c.menu.ActiveAt(at(c.at),testLocation); active != c.active{
+			t.Errorf("%s: active at %s = %v, want %v",c.name,c.at,active,c.active)
+		}
+	}
+
+	// the hours are read in the timezone of the branch, 05:30 UTC is 07:30 there
+	if !breakfast.ActiveAt(time.Date(2026,10,19,5,30,0,0,time.UTC),testLocation){
+		t.Error("expected the time to be read in the timezone of the branch")
+	}
+	if breakfast.ActiveAt(time.Date(2026,10,19,5,30,0,0,time.UTC),time.UTC){
+		t.Error("05:30 UTC is before breakfast in UTC")
+	}
+}
+
+func TestCheckSchedule(t *testing.T){
+	start,end := at("2026-11-01 00:00"),at("2026-12-01 00:00")
+	valid := []Menu{
+		{},
+		{Start_date: &start,End_date: &end},
+		{Schedule: []MenuWindow{{Days: []string{"sat"},Start: "22:00",End: "02:00"},{Days: []string{"sun"},Start: "00:00",End: "24:00"}}},
+		{Exceptions: []MenuException{{Date: "2026-12-25",Closed: true},{Date: "2026-12-26"},{Date: "2026-12-31",Start: "18:00",End: "01:00"}}},
+	}
+	for i,menu := range valid{
+		if err := menu.CheckSchedule(); err != nil{
+			t.Errorf("menu %d: %v",i,err)
+		}
+	}
+
+	invalid := map[string]Menu{
+		"dates out of order": {Start_date: &end,End_date: &start},
+		"no minutes": {Schedule: []MenuWindow{{Days: []string{"mon"},Start: "7",End: "11:00"}}},
+		"past midnight": {Schedule: []MenuWindow{{Days: []string{"mon"},Start: "07:00",End: "24:30"}}},
+		"empty window": {Schedule: []MenuWindow{{Days: []string{"mon"},Start: "07:00",End: "07:00"}}},
+		"not a date": {Exceptions: []MenuException{{Date: "25/12/2026",Closed: true}}},
+		"two exceptions a day": {Exceptions: []MenuException{{Date: "2026-12-25",Closed: true},{Date: "2026-12-25"}}},
+		"closed with hours": {Exceptions: []MenuException{{Date: "2026-12-25",Closed: true,Start: "10:00",End: "12:00"}}},
+		"a start only": {Exceptions: []MenuException{{Date: "2026-12-25",Start: "10:00"}}},
+	}
+	for name,menu := range invalid{
+		if err := menu.CheckSchedule(); err == nil{
+			t.Errorf("%s: expected an error",name)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"fmt"
+	"restaurant-backend/money"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,10 +17,52 @@ import (
 type OrderItem struct{
 	ID                 primitive.ObjectID     `bson:"_id"`
 	Quantity          *string               `json:"quantity"`
-	Unit_price         *float64              `json:"unit_price"`
+	Unit_price         *money.Money          `json:"unit_price"`
 	Created_at          time.Time            `json:"created_at"`
 	Updated_at          time.Time            `json:"updated_at"`
-	Food_id            *string               `json:"food_id" validated:"required"`
+	Deleted_at         *time.Time           `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version            int64                `json:"version"`
+	Food_id            *string               `json:"food_id" validate:"required"`
+	// the options picked for the food, the client sends their group_id and option_id and the
+	// names and price deltas are copied from the food, a later change of the food keeps them
+	Modifiers           []OrderItemModifier  `json:"modifiers" validate:"omitempty,dive"`
 	Order_item_id       string               `json:"order_item_id"`
 	Order_id            string               `json:"order_id" validate:"required"`
-}
\ No newline at end of file
+	Branch_id           string               `json:"branch_id"`
+}
+
+// an order item modifier is an option of a modifier group of the food picked for the item
+
+type OrderItemModifier struct{
+	Group_id            string               `json:"group_id"`
+	Option_id           string               `json:"option_id" validate:"required"`
+	Group_name          string               `json:"group_name"`
+	Name                string               `json:"name"`
+	Price_delta         money.Money          `json:"price_delta"`
+}
+
+// ModifiersPrice adds up the price deltas of the modifiers picked for the item in the
+// currency of the food
+func (o OrderItem) ModifiersPrice(currency string) (money.Money,error){
+	total := money.Zero(currency)
+	for _,modifier := range o.Modifiers{
+		var err error
+		if total,err = total.Add(modifier.Price_delta); err != nil{
+			return total,err
+		}
+	}
+	return total,nil
+}
+
+// Count is the number of the food ordered on the item, a whole number above zero. An item
+// without a quantity counts once.
+func (o OrderItem) Count() (int64,error){
+	if o.Quantity == nil{
+		return 1,nil
+	}
+	count,err := strconv.ParseInt(strings.TrimSpace(*o.Quantity),10,64)
+	if err != nil || count < 1{
+		return 0,fmt.Errorf("the quantity %q is not a whole number above zero",*o.Quantity)
+	}
+	return count,nil
+}
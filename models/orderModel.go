@@ -15,6 +15,9 @@ type Order struct{
 	Order_date       time.Time              `json:"order_date" validate:"required"`
 	Created_at       time.Time              `json:"created_at"`
 	Updated_at       time.Time              `json:"updated_at"`
+	Deleted_at      *time.Time             `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version         int64                  `json:"version"`
 	Order_id         string                 `json:"order_id"`
 	Table_id        *string                 `json:"table_id" validate:"required"`
+	Branch_id       string                  `json:"branch_id"`
 }
\ No newline at end of file
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the json tag is used to represent the JSON key
+// a revocation either names one token by its jti, or when Jti is empty
+// every token of the user issued up to Created_at
+
+type Revocation struct{
+	ID                 primitive.ObjectID       `bson:"_id"`
+	Jti                string                   `json:"jti"`
+	User_id            string                   `json:"user_id"`
+	Created_at         time.Time                `json:"created_at"`
+	// the revoked tokens are expired by then, a TTL index removes the entry
+	Expires_at         time.Time                `json:"expires_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// the roles a member of staff can hold, a user may hold several of them
+const (
+	RoleAdmin   = "admin"
+	RoleManager = "manager"
+	RoleWaiter  = "waiter"
+	RoleKitchen = "kitchen"
+	RoleCashier = "cashier"
+)
+
+// Roles lists every role in the order they are shown
+var Roles = []string{RoleAdmin,RoleManager,RoleWaiter,RoleKitchen,RoleCashier}
+
+// IsRole reports whether name is one of the Roles
+func IsRole(name string) bool{
+	for _,role := range Roles{
+		if role == name{
+			return true
+		}
+	}
+	return false
+}
@@ -16,5 +16,8 @@ type Table struct{
 	Table_number       *int                    `json:"table_number" validate:"required"`
 	Created_at         time.Time               `json:"created_at"`
 	Updated_at         time.Time               `json:"updated_at"`
+	Deleted_at        *time.Time              `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version           int64                   `json:"version"`
 	Table_id           string                  `json:"table_id"`
+	Branch_id          string                  `json:"branch_id"`
 }  
\ No newline at end of file
@@ -16,11 +16,30 @@ type User struct{
 	Last_name            *string                 `json:"last_name"  validate:"required,min=2,max=100"`
 	Password             *string                 `json:"password" validate:"required,min=6"`
 	Email                *string                 `json:"email"   validate:"required"`
+	// set once the user opened the verification link mailed to the email
+	Email_verified_at    *time.Time              `json:"email_verified_at"`
+	// two-factor authentication is on once Mfa_enabled_at is set. The secret waits in
+	// Mfa_pending_secret until the first code confirms the enrollment, only the hashes of
+	// the recovery codes are stored and Mfa_last_step keeps a code from being used twice.
+	Mfa_secret           *string                 `json:"-"`
+	Mfa_pending_secret   *string                 `json:"-"`
+	Mfa_enabled_at       *time.Time              `json:"mfa_enabled_at"`
+	Mfa_recovery_codes   []string                `json:"-"`
+	Mfa_last_step        int64                   `json:"-"`
+	// the bcrypt hash of the PIN the user switches to on the shared terminals with, see pinController.go
+	Pin_hash             *string                 `json:"-"`
+	Pin_set_at           *time.Time              `json:"pin_set_at"`
 	Avatar               *string                 `json:"avatar"`
 	Phone                *string                 `json:"phone"  validate:"required"`
 	Token                *string                 `json:"token"`
 	Refresh_token        *string                 `json:"refresh_token"`
+	// the family of the current refresh token, it is never sent to clients
+	Token_family         *string                 `json:"-"`
 	Created_at           time.Time               `json:"created_at"`
 	Updated_at           time.Time               `json:"updated_at"`
+	Deleted_at          *time.Time              `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	Version             int64                   `json:"version"`
 	User_id              string                  `json:"user_id"`
+	Branches             []string                `json:"branches"`
+	Roles                []string                `json:"roles"`
 }
\ No newline at end of file
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the purposes of a user token
+const (
+	PasswordResetToken = "password_reset"
+	EmailVerificationToken = "email_verification"
+)
+
+// the json tag is used to represent the JSON key
+// a user token is mailed to a user to prove they hold the address, only the hash of the
+// token is stored and it can be used once before it expires
+
+type UserToken struct{
+	ID                 primitive.ObjectID       `bson:"_id"`
+	Token_hash         string                   `json:"-"`
+	Purpose            string                   `json:"purpose"`
+	User_id            string                   `json:"user_id"`
+	// the address the token was sent to
+	Email              string                   `json:"email"`
+	Created_at         time.Time                `json:"created_at"`
+	// a TTL index removes the token once it expired
+	Expires_at         time.Time                `json:"expires_at"`
+	Used_at            *time.Time               `json:"used_at"`
+}
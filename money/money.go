@@ -0,0 +1,210 @@
+// Package money represents amounts as a whole number of minor units (cents) of a
+// currency, so adding prices and multiplying them by quantities is exact.
+//
+// Rounding happens in one place only: when a decimal amount with more digits than the
+// currency has is parsed, it is rounded to the nearest minor unit with halves rounded
+// away from zero (12.345 USD is 12.35, -12.345 is -12.35). Arithmetic on Money never
+// rounds, it fails with ErrOverflow rather than wrap around, and amounts of different
+// currencies are never added together.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts given without one, it is set from the
+// configuration at startup
+var DefaultCurrency = "USD"
+
+// ErrCurrencyMismatch is returned when amounts of two currencies are combined
+var ErrCurrencyMismatch = errors.New("amounts have different currencies")
+
+// ErrOverflow is returned when an amount does not fit in the 64 bits of minor units
+var ErrOverflow = errors.New("amount is too large")
+
+// the currencies that do not have two decimal places, ISO 4217
+var minorDigits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Money is an amount of a currency. In the database it is stored as
+// {amount: <minor units>, currency: "USD"}.
+type Money struct {
+	// Amount is the number of minor units, 1250 is 12.50 USD
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+// Digits returns the number of decimal places of a currency
+func Digits(currency string) int {
+	if digits, ok := minorDigits[currency]; ok {
+		return digits
+	}
+	return 2
+}
+
+// New returns an amount of minor units of the currency, DefaultCurrency when it is empty
+func New(minor int64, currency string) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{Amount: minor, Currency: strings.ToUpper(currency)}
+}
+
+// Zero returns nothing of the currency
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// Parse reads a decimal amount like "12.5" or "-3.005" in the currency, rounding it to
+// the minor unit of the currency as described in the package documentation
+func Parse(text string, currency string) (Money, error) {
+	m := New(0, currency)
+	if len(m.Currency) != 3 || strings.Trim(m.Currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return m, fmt.Errorf("%q is not a currency code", currency)
+	}
+	input := strings.TrimSpace(text)
+	negative := strings.HasPrefix(input, "-")
+	text = strings.TrimPrefix(strings.TrimPrefix(input, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" && fraction == "" || strings.Trim(whole+fraction, "0123456789") != "" {
+		return m, fmt.Errorf("%q is not a decimal amount", input)
+	}
+
+	digits := Digits(m.Currency)
+	// the digit after the last kept one decides the rounding, the rest can not change it
+	roundUp := len(fraction) > digits && fraction[digits] >= '5'
+	fraction = (fraction + strings.Repeat("0", digits))[:digits]
+
+	minor, err := strconv.ParseInt("0"+whole+fraction, 10, 64)
+	if err != nil || roundUp && minor == math.MaxInt64 {
+		return m, fmt.Errorf("%w: %q", ErrOverflow, input)
+	}
+	if roundUp {
+		minor++
+	}
+	if negative {
+		minor = -minor
+	}
+	m.Amount = minor
+	return m, nil
+}
+
+// FromFloat converts a float amount, as prices used to be stored, using the shortest
+// decimal text that reads back as the same float so 0.1 is 0.10 and not 0.1000000000000000055
+func FromFloat(f float64, currency string) (Money, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return New(0, currency), fmt.Errorf("%v is not an amount", f)
+	}
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64), currency)
+}
+
+// Add returns the sum of two amounts of the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return m, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	sum := m.Amount + other.Amount
+	if other.Amount > 0 && sum < m.Amount || other.Amount < 0 && sum > m.Amount {
+		return m, fmt.Errorf("%w: %s plus %s", ErrOverflow, m, other)
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Times returns the amount multiplied by a quantity
+func (m Money) Times(quantity int64) (Money, error) {
+	product := m.Amount * quantity
+	if m.Amount != 0 && (product/m.Amount != quantity || m.Amount == -1 && quantity == math.MinInt64) {
+		return m, fmt.Errorf("%w: %s times %d", ErrOverflow, m, quantity)
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Sum adds up amounts of one currency, the sum of no amounts is zero of DefaultCurrency
+func Sum(amounts ...Money) (Money, error) {
+	if len(amounts) == 0 {
+		return Zero(""), nil
+	}
+	total := Zero(amounts[0].Currency)
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// IsNegative reports whether the amount is below zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Decimal writes the amount with the decimal places of its currency, "12.50"
+func (m Money) Decimal() string {
+	digits := Digits(m.Currency)
+	minor := m.Amount
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	text := strconv.FormatInt(minor, 10)
+	if digits == 0 {
+		return sign + text
+	}
+	if len(text) <= digits {
+		text = strings.Repeat("0", digits-len(text)+1) + text
+	}
+	return sign + text[:len(text)-digits] + "." + text[len(text)-digits:]
+}
+
+// String writes the amount and its currency, "12.50 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// the JSON form, the amount is a decimal string so clients never see a float
+type jsonMoney struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"12.50","currency":"USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Decimal(), m.Currency})
+}
+
+// UnmarshalJSON reads {"amount":"12.50","currency":"USD"} with the amount as a string or a
+// number, and also a bare 12.5 or "12.5" in DefaultCurrency as prices used to be sent
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var value jsonMoney
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(b, &value.Amount); err != nil {
+		return fmt.Errorf("an amount is a number or {\"amount\":\"12.50\",\"currency\":\"USD\"}")
+	}
+	parsed, err := Parse(value.Amount.String(), value.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,143 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		text     string
+		currency string
+		want     string
+	}{
+		{"12.5", "USD", "12.50 USD"},
+		{"12.345", "USD", "12.35 USD"},
+		{"12.344", "USD", "12.34 USD"},
+		{"-12.345", "USD", "-12.35 USD"},
+		{"0.005", "USD", "0.01 USD"},
+		{".5", "EUR", "0.50 EUR"},
+		{"+3", "USD", "3.00 USD"},
+		{"1234.5", "JPY", "1235 JPY"},
+		{"1.2345", "KWD", "1.235 KWD"},
+		{"7", "", "7.00 USD"},
+	}
+	for _, c := range cases {
+		m, err := Parse(c.text, c.currency)
+		if err != nil {
+			t.Errorf("Parse(%q, %q): %v", c.text, c.currency, err)
+			continue
+		}
+		if m.String() != c.want {
+			t.Errorf("Parse(%q, %q) = %s, want %s", c.text, c.currency, m, c.want)
+		}
+	}
+
+	for _, text := range []string{"", "-", ".", "1.2.3", "12,50", "ten", "99999999999999999999"} {
+		if _, err := Parse(text, "USD"); err == nil {
+			t.Errorf("Parse(%q) should fail", text)
+		}
+	}
+	if _, err := Parse("1", "dollars"); err == nil {
+		t.Error("a currency that is not a three letter code should be refused")
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	m, err := FromFloat(0.1+0.2, "USD")
+	if err != nil || m.Amount != 30 {
+		t.Errorf("FromFloat(0.1+0.2) = %v, %v, want 0.30 USD", m, err)
+	}
+	if _, err := FromFloat(math.NaN(), "USD"); err == nil {
+		t.Error("FromFloat(NaN) should fail")
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	price := New(1250, "USD")
+	if got, err := price.Times(3); err != nil || got != New(3750, "USD") {
+		t.Errorf("Times(3) = %s, %v", got, err)
+	}
+
+	total, err := Sum(price, New(5, "USD"), New(-255, "USD"))
+	if err != nil || total != New(1000, "USD") {
+		t.Errorf("Sum = %s, %v, want 10.00 USD", total, err)
+	}
+	if total, err := Sum(); err != nil || total != Zero(DefaultCurrency) {
+		t.Errorf("Sum() = %s, %v, want zero", total, err)
+	}
+
+	if _, err := price.Add(New(1, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("adding euros to dollars: %v", err)
+	}
+	if _, err := Sum(price, New(1, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("summing euros and dollars: %v", err)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	largest, smallest := New(math.MaxInt64, "USD"), New(math.MinInt64, "USD")
+	cases := []struct {
+		name string
+		do   func() (Money, error)
+	}{
+		{"largest plus one", func() (Money, error) { return largest.Add(New(1, "USD")) }},
+		{"smallest minus one", func() (Money, error) { return smallest.Add(New(-1, "USD")) }},
+		{"largest times two", func() (Money, error) { return largest.Times(2) }},
+		{"smallest times minus one", func() (Money, error) { return smallest.Times(-1) }},
+		{"minus one times the smallest quantity", func() (Money, error) { return New(-1, "USD").Times(math.MinInt64) }},
+		{"half of the largest times three", func() (Money, error) { return New(math.MaxInt64/2, "USD").Times(3) }},
+		{"a sum past the largest", func() (Money, error) { return Sum(largest, New(-1, "USD"), New(2, "USD")) }},
+		{"rounding up the largest", func() (Money, error) { return Parse("92233720368547758.075", "USD") }},
+	}
+	for _, c := range cases {
+		if m, err := c.do(); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s = %s, %v, want ErrOverflow", c.name, m, err)
+		}
+	}
+
+	if m, err := largest.Add(New(-1, "USD")); err != nil || m.Amount != math.MaxInt64-1 {
+		t.Errorf("largest minus one = %s, %v", m, err)
+	}
+	if m, err := smallest.Times(1); err != nil || m != smallest {
+		t.Errorf("smallest times one = %s, %v", m, err)
+	}
+	if m, err := New(-3, "USD").Times(-3); err != nil || m.Amount != 9 {
+		t.Errorf("-3 times -3 = %s, %v", m, err)
+	}
+	if m, err := Zero("USD").Times(math.MinInt64); err != nil || m.Amount != 0 {
+		t.Errorf("zero times the smallest quantity = %s, %v", m, err)
+	}
+	if m, err := Parse("92233720368547758.07", "USD"); err != nil || m != largest {
+		t.Errorf("Parse of the largest amount = %s, %v", m, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	b, err := json.Marshal(New(-5, "USD"))
+	if err != nil || string(b) != `{"amount":"-0.05","currency":"USD"}` {
+		t.Errorf("Marshal = %s, %v", b, err)
+	}
+
+	for input, want := range map[string]Money{
+		`{"amount":"12.50","currency":"EUR"}`: New(1250, "EUR"),
+		`{"amount":12.5,"currency":"EUR"}`:    New(1250, "EUR"),
+		`{"amount":"3"}`:                      New(300, DefaultCurrency),
+		`12.5`:                                New(1250, DefaultCurrency),
+		`"12.5"`:                              New(1250, DefaultCurrency),
+	} {
+		var m Money
+		if err := json.Unmarshal([]byte(input), &m); err != nil || m != want {
+			t.Errorf("Unmarshal(%s) = %s, %v, want %s", input, m, err, want)
+		}
+	}
+
+	for _, input := range []string{`true`, `{"amount":"abc"}`, `{"amount":"1","currency":"dollars"}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(input), &m); err == nil {
+			t.Errorf("Unmarshal(%s) should fail", input)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"restaurant-backend/models"
+	"sync"
+	"time"
+)
+
+// how long an answer of the revocation store is reused, a token revoked through
+// another instance of the server keeps working at most this long there
+const revocationCacheTTL = 30 * time.Second
+
+// revocationCacheSize bounds the cache, expired answers are dropped when it is full
+const revocationCacheSize = 10000
+
+type cachedAnswer struct {
+	revoked bool
+	checked time.Time
+}
+
+type revocationCache struct {
+	inner RevocationRepository
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	answers map[string]cachedAnswer
+}
+
+// CachedRevocations answers IsRevoked from memory for ttl after asking inner. A
+// revocation made through the returned repository is seen at once by this process.
+func CachedRevocations(inner RevocationRepository, ttl time.Duration) RevocationRepository {
+	return &revocationCache{inner: inner, ttl: ttl, answers: map[string]cachedAnswer{}}
+}
+
+func (r *revocationCache) Revoke(ctx context.Context, revocation models.Revocation) error {
+	if err := r.inner.Revoke(ctx, revocation); err != nil {
+		return err
+	}
+	// a revocation of every token of a user can change any answer
+	r.mu.Lock()
+	r.answers = map[string]cachedAnswer{}
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *revocationCache) IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (bool, error) {
+	key := jti + "/" + userID + "/" + issuedAt.UTC().Format(time.RFC3339Nano)
+	now := time.Now()
+
+	r.mu.Lock()
+	answer, ok := r.answers[key]
+	r.mu.Unlock()
+	if ok && now.Sub(answer.checked) < r.ttl {
+		return answer.revoked, nil
+	}
+
+	revoked, err := r.inner.IsRevoked(ctx, jti, userID, issuedAt)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.answers) >= revocationCacheSize {
+		for cached, old := range r.answers {
+			if now.Sub(old.checked) >= r.ttl {
+				delete(r.answers, cached)
+			}
+		}
+		// everything is fresh, start over rather than grow without a bound
+		if len(r.answers) >= revocationCacheSize {
+			r.answers = map[string]cachedAnswer{}
+		}
+	}
+	r.answers[key] = cachedAnswer{revoked: revoked, checked: now}
+	return revoked, nil
+}
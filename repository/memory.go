@@ -0,0 +1,614 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemory returns repositories that keep every document in memory.
+// They are safe for concurrent use and are meant for tests and local experiments.
+func NewMemory() *Repositories {
+	return newRepositories(newMemoryBackend())
+}
+
+type memoryBackend struct {
+	mu          sync.Mutex
+	collections map[string]*memoryCollection
+	// txMu serializes transactions
+	txMu sync.Mutex
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{collections: map[string]*memoryCollection{}}
+}
+
+// memoryUniqueFields mirrors the unique indexes created by the migrations
+var memoryUniqueFields = map[string][]string{
+	"branches":        {"branch_id"},
+	"food":            {"food_id"},
+	"menu":            {"menu_id"},
+	"table":           {"table_id"},
+	"order":           {"order_id"},
+	"orderItems":      {"order_item_id"},
+	"invoices":        {"invoice_id"},
+	"users":           {"user_id", "email", "phone"},
+	"user_tokens":     {"token_hash"},
+	"login_throttles": {"key"},
+	"api_keys":        {"key_id"},
+}
+
+func (b *memoryBackend) collection(name string) collection {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if coll, ok := b.collections[name]; ok {
+		return coll
+	}
+	coll := &memoryCollection{unique: memoryUniqueFields[name]}
+	b.collections[name] = coll
+	return coll
+}
+
+// withTransaction snapshots every collection and puts the snapshot back when fn fails.
+// Writes made outside of a transaction while it runs are lost on rollback, which is
+// fine for the tests this backend is meant for.
+func (b *memoryBackend) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	b.txMu.Lock()
+	defer b.txMu.Unlock()
+
+	b.mu.Lock()
+	snapshot := make(map[*memoryCollection][]bson.M, len(b.collections))
+	for _, coll := range b.collections {
+		coll.mu.RLock()
+		snapshot[coll] = append([]bson.M(nil), coll.docs...)
+		coll.mu.RUnlock()
+	}
+	b.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		for coll, docs := range snapshot {
+			coll.mu.Lock()
+			coll.docs = docs
+			coll.mu.Unlock()
+		}
+		return err
+	}
+	return nil
+}
+
+// memoryCollection keeps the documents in insertion order. Stored documents are
+// never modified in place, an update always swaps in a new map.
+type memoryCollection struct {
+	mu     sync.RWMutex
+	docs   []bson.M
+	unique []string
+}
+
+func (m *memoryCollection) find(ctx context.Context, filter bson.M, opts ListOptions) ([]bson.Raw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filter, err := normalizeDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	docs := m.docs
+	if opts.Newest {
+		docs = make([]bson.M, len(m.docs))
+		for i, doc := range m.docs {
+			docs[len(docs)-1-i] = doc
+		}
+	}
+
+	var raws []bson.Raw
+	var skipped int64
+	for _, doc := range docs {
+		if !matches(doc, filter) {
+			continue
+		}
+		if skipped < opts.Skip {
+			skipped++
+			continue
+		}
+		if opts.Limit > 0 && int64(len(raws)) >= opts.Limit {
+			break
+		}
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, raw)
+	}
+	return raws, nil
+}
+
+func (m *memoryCollection) count(ctx context.Context, filter bson.M) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	filter, err := normalizeDoc(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total int64
+	for _, doc := range m.docs {
+		if matches(doc, filter) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (m *memoryCollection) findOne(ctx context.Context, filter bson.M) (bson.Raw, error) {
+	raws, err := m.find(ctx, filter, ListOptions{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(raws) == 0 {
+		return nil, ErrNotFound
+	}
+	return raws[0], nil
+}
+
+func (m *memoryCollection) insert(ctx context.Context, docs []interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// normalizing every document before touching the collection so a bad
+	// document in the middle does not leave a partial insert behind
+	normalized := make([]bson.M, 0, len(docs))
+	for _, doc := range docs {
+		n, err := normalizeDoc(doc)
+		if err != nil {
+			return err
+		}
+		if _, ok := n["_id"]; !ok {
+			n["_id"] = primitive.NewObjectID()
+		}
+		normalized = append(normalized, n)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, doc := range normalized {
+		duplicate := m.indexOfLocked(doc["_id"]) >= 0 || indexOfID(normalized[:i], doc["_id"]) >= 0 ||
+			m.conflicts(doc, m.docs) || m.conflicts(doc, normalized[:i])
+		if duplicate && len(normalized) > 1 {
+			return &WriteError{Index: i, Err: ErrDuplicate}
+		}
+		if duplicate {
+			return ErrDuplicate
+		}
+	}
+	m.docs = append(m.docs, normalized...)
+	return nil
+}
+
+func (m *memoryCollection) update(ctx context.Context, filter bson.M, update bson.D) (bson.Raw, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filter, err := normalizeDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, doc := range m.docs {
+		if matches(doc, filter) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, ErrNotFound
+	}
+
+	updated := copyDoc(m.docs[index])
+	if err := applyUpdate(updated, update); err != nil {
+		return nil, err
+	}
+	if m.conflicts(updated, m.docs) {
+		return nil, ErrDuplicate
+	}
+
+	m.docs[index] = updated
+	return bson.Marshal(updated)
+}
+
+func (m *memoryCollection) delete(ctx context.Context, filter bson.M) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	filter, err := normalizeDoc(filter)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, doc := range m.docs {
+		if matches(doc, filter) {
+			m.docs = append(m.docs[:i:i], m.docs[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *memoryCollection) indexOfLocked(id interface{}) int {
+	return indexOfID(m.docs, id)
+}
+
+// conflicts reports whether doc shares a unique field value with another document of docs.
+// Like the partial indexes of the migrations, documents without the field never conflict.
+func (m *memoryCollection) conflicts(doc bson.M, docs []bson.M) bool {
+	for _, field := range m.unique {
+		value, ok := doc[field]
+		if !ok || value == nil {
+			continue
+		}
+		for _, other := range docs {
+			if equalValues(other["_id"], doc["_id"]) {
+				continue
+			}
+			if equalValues(other[field], value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func indexOfID(docs []bson.M, id interface{}) int {
+	for i, doc := range docs {
+		if equalValues(doc["_id"], id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyUpdate runs the $set, $unset and $inc operators of an update document
+func applyUpdate(doc bson.M, update bson.D) error {
+	for _, op := range update {
+		fields, err := normalizeDoc(op.Value)
+		if err != nil {
+			return err
+		}
+		switch op.Key {
+		case "$set":
+			for key, value := range fields {
+				setPath(doc, key, value)
+			}
+		case "$unset":
+			for key := range fields {
+				unsetPath(doc, key)
+			}
+		case "$inc":
+			for key, value := range fields {
+				current, _ := lookupPath(doc, key)
+				sum, err := addNumbers(current, value)
+				if err != nil {
+					return fmt.Errorf("$inc on %s: %w", key, err)
+				}
+				setPath(doc, key, sum)
+			}
+		default:
+			return fmt.Errorf("update operator %s is not supported by the memory backend", op.Key)
+		}
+	}
+	return nil
+}
+
+// normalizeDoc round-trips a value through bson so the in-memory documents hold
+// exactly the types the mongo driver would store (DateTime, int32/int64, A, M...)
+func normalizeDoc(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func copyDoc(doc bson.M) bson.M {
+	cp := make(bson.M, len(doc))
+	for key, value := range doc {
+		if nested, ok := value.(bson.M); ok {
+			value = copyDoc(nested)
+		}
+		cp[key] = value
+	}
+	return cp
+}
+
+func lookupPath(doc bson.M, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	var current interface{} = doc
+	for _, part := range parts {
+		m, ok := current.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func setPath(doc bson.M, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(bson.M)
+		if !ok {
+			next = bson.M{}
+		} else {
+			next = copyDoc(next)
+		}
+		doc[part] = next
+		doc = next
+	}
+	doc[parts[len(parts)-1]] = value
+}
+
+func unsetPath(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(bson.M)
+		if !ok {
+			return
+		}
+		next = copyDoc(next)
+		doc[part] = next
+		doc = next
+	}
+	delete(doc, parts[len(parts)-1])
+}
+
+// matches reports whether doc satisfies the filter
+func matches(doc bson.M, filter bson.M) bool {
+	for key, cond := range filter {
+		switch key {
+		case "$and", "$or", "$nor":
+			clauses, _ := cond.(primitive.A)
+			matched := 0
+			for _, clause := range clauses {
+				if sub, ok := clause.(bson.M); ok && matches(doc, sub) {
+					matched++
+				}
+			}
+			if key == "$and" && matched != len(clauses) {
+				return false
+			}
+			if key == "$or" && matched == 0 {
+				return false
+			}
+			if key == "$nor" && matched > 0 {
+				return false
+			}
+			continue
+		}
+
+		value, exists := lookupPath(doc, key)
+		if ops, ok := cond.(bson.M); ok && isOperatorDoc(ops) {
+			for op, arg := range ops {
+				if !matchOperator(op, value, exists, arg) {
+					return false
+				}
+			}
+			continue
+		}
+		if !matchEqual(value, exists, cond) {
+			return false
+		}
+	}
+	return true
+}
+
+func isOperatorDoc(v interface{}) bool {
+	m, ok := v.(bson.M)
+	if !ok || len(m) == 0 {
+		return false
+	}
+	for key := range m {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func matchOperator(op string, value interface{}, exists bool, arg interface{}) bool {
+	switch op {
+	case "$eq":
+		return matchEqual(value, exists, arg)
+	case "$ne":
+		return !matchEqual(value, exists, arg)
+	case "$exists":
+		want, _ := arg.(bool)
+		return exists == want
+	case "$in", "$nin":
+		list, _ := arg.(primitive.A)
+		found := false
+		for _, candidate := range list {
+			if matchEqual(value, exists, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in")
+	case "$gt", "$gte", "$lt", "$lte":
+		if !exists {
+			return false
+		}
+		if arr, ok := value.(primitive.A); ok {
+			for _, elem := range arr {
+				if matchOperator(op, elem, true, arg) {
+					return true
+				}
+			}
+			return false
+		}
+		cmp, ok := compareValues(value, arg)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "$gt":
+			return cmp > 0
+		case "$gte":
+			return cmp >= 0
+		case "$lt":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}
+	// an unknown operator never matches rather than silently matching everything
+	return false
+}
+
+// matchEqual follows mongo equality: null matches missing fields and an array
+// matches when any of its elements is equal to the value
+func matchEqual(value interface{}, exists bool, want interface{}) bool {
+	if want == nil {
+		return !exists || value == nil
+	}
+	if equalValues(value, want) {
+		return true
+	}
+	if arr, ok := value.(primitive.A); ok {
+		for _, elem := range arr {
+			if equalValues(elem, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equalValues(a, b interface{}) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues orders two scalar bson values of the same kind
+func compareValues(a, b interface{}) (int, bool) {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			switch {
+			case af < bf:
+				return -1, true
+			case af > bf:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, true
+			case !av:
+				return -1, true
+			}
+			return 1, true
+		}
+	case primitive.DateTime:
+		if bv, ok := b.(primitive.DateTime); ok {
+			switch {
+			case av < bv:
+				return -1, true
+			case av > bv:
+				return 1, true
+			}
+			return 0, true
+		}
+	case primitive.ObjectID:
+		if bv, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(av[:], bv[:]), true
+		}
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func addNumbers(current, delta interface{}) (interface{}, error) {
+	if current == nil {
+		return delta, nil
+	}
+	switch c := current.(type) {
+	case int32:
+		switch d := delta.(type) {
+		case int32:
+			return c + d, nil
+		case int64:
+			return int64(c) + d, nil
+		case float64:
+			return float64(c) + d, nil
+		}
+	case int64:
+		switch d := delta.(type) {
+		case int32:
+			return c + int64(d), nil
+		case int64:
+			return c + d, nil
+		case float64:
+			return float64(c) + d, nil
+		}
+	case float64:
+		if d, ok := toFloat(delta); ok {
+			return c + d, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot add %T to %T", delta, current)
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongo returns repositories backed by the collections of a mongodb database
+func NewMongo(db *mongo.Database) *Repositories {
+	return newRepositories(mongoBackend{db: db})
+}
+
+type mongoBackend struct {
+	db *mongo.Database
+}
+
+func (b mongoBackend) collection(name string) collection {
+	return mongoCollection{coll: b.db.Collection(name)}
+}
+
+func (b mongoBackend) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := b.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	// WithTransaction commits when fn succeeds, aborts when it fails and retries
+	// the whole function on transient transaction errors
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+// mongoCollection forwards every operation to the mongo driver
+type mongoCollection struct {
+	coll *mongo.Collection
+}
+
+func (m mongoCollection) find(ctx context.Context, filter bson.M, opts ListOptions) ([]bson.Raw, error) {
+	findOpts := options.Find()
+	if opts.Skip > 0 {
+		findOpts.SetSkip(opts.Skip)
+	}
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	if opts.Newest {
+		// object ids grow with the time they were made at
+		findOpts.SetSort(bson.D{{Key: "_id", Value: -1}})
+	}
+
+	cursor, err := m.coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var raws []bson.Raw
+	for cursor.Next(ctx) {
+		// the cursor reuses its buffer, so every document is copied
+		raw := make(bson.Raw, len(cursor.Current))
+		copy(raw, cursor.Current)
+		raws = append(raws, raw)
+	}
+	return raws, cursor.Err()
+}
+
+func (m mongoCollection) count(ctx context.Context, filter bson.M) (int64, error) {
+	return m.coll.CountDocuments(ctx, filter)
+}
+
+func (m mongoCollection) findOne(ctx context.Context, filter bson.M) (bson.Raw, error) {
+	raw, err := m.coll.FindOne(ctx, filter).DecodeBytes()
+	return raw, mongoError(err)
+}
+
+func (m mongoCollection) insert(ctx context.Context, docs []interface{}) error {
+	if len(docs) == 1 {
+		_, err := m.coll.InsertOne(ctx, docs[0])
+		return mongoError(err)
+	}
+	_, err := m.coll.InsertMany(ctx, docs)
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		first := bulkErr.WriteErrors[0]
+		if first.HasErrorCode(11000) {
+			return &WriteError{Index: first.Index, Err: ErrDuplicate}
+		}
+		return &WriteError{Index: first.Index, Err: first}
+	}
+	return mongoError(err)
+}
+
+func (m mongoCollection) update(ctx context.Context, filter bson.M, update bson.D) (bson.Raw, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	raw, err := m.coll.FindOneAndUpdate(ctx, filter, update, opts).DecodeBytes()
+	return raw, mongoError(err)
+}
+
+func (m mongoCollection) delete(ctx context.Context, filter bson.M) error {
+	result, err := m.coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return mongoError(err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// mongoError translates driver errors into the repository errors
+func mongoError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicate
+	}
+	return err
+}
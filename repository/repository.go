@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"restaurant-backend/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the errors returned by every repository, whatever the backend
+var (
+	// ErrNotFound is returned when no document matches the requested id
+	ErrNotFound = errors.New("document not found")
+	// ErrDuplicate is returned when a write would break a unique constraint
+	ErrDuplicate = errors.New("duplicate document")
+	// ErrVersionConflict is returned when the document was changed since the version the caller read
+	ErrVersionConflict = errors.New("document was changed by someone else")
+	// ErrWrongBranch is returned when writing a document of another branch than the one of the context
+	ErrWrongBranch = errors.New("document belongs to another branch")
+)
+
+// WriteError tells which document of a multi-document write failed
+type WriteError struct {
+	Index int
+	Err   error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("document %d: %v", e.Index, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// ListOptions controls the pagination of a List call. A zero Limit means no limit.
+type ListOptions struct {
+	Skip  int64
+	Limit int64
+	// Newest lists the documents inserted last first instead of first
+	Newest bool
+}
+
+// Resource is the set of operations shared by every aggregate
+type Resource[T any] interface {
+	// List returns one page of documents and the total number of documents
+	List(ctx context.Context, opts ListOptions) ([]T, int64, error)
+	// Get returns the document with the given resource id
+	Get(ctx context.Context, id string) (T, error)
+	// Create inserts a new document
+	Create(ctx context.Context, doc T) error
+	// Update applies the changes to the document with the given resource id and version and
+	// returns the result with its version bumped. A zero version skips the check.
+	Update(ctx context.Context, id string, version int64, changes primitive.D) (T, error)
+	// Delete soft-deletes the document by setting its deleted_at tombstone
+	Delete(ctx context.Context, id string) (T, error)
+	// Restore clears the tombstone of a soft-deleted document
+	Restore(ctx context.Context, id string) (T, error)
+	// Purge removes a soft-deleted document for good
+	Purge(ctx context.Context, id string) error
+}
+
+type contextKey int
+
+const (
+	includeDeletedKey contextKey = iota
+	branchKey
+)
+
+// WithDeleted returns a context under which the repositories also return soft-deleted documents
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey, true)
+}
+
+func includeDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey).(bool)
+	return include
+}
+
+// WithBranch returns a context under which the repositories only see the documents of the
+// branch and stamp it on the documents they insert
+func WithBranch(ctx context.Context, branchID string) context.Context {
+	return context.WithValue(ctx, branchKey, branchID)
+}
+
+// AllBranches lifts the branch scope of a context, for the admin routes that manage branches
+func AllBranches(ctx context.Context) context.Context {
+	return context.WithValue(ctx, branchKey, "")
+}
+
+func branchScope(ctx context.Context) (string, bool) {
+	branch, _ := ctx.Value(branchKey).(string)
+	return branch, branch != ""
+}
+
+// FoodRepository stores the foods served by the restaurant
+type FoodRepository interface {
+	Resource[models.Food]
+	// CountByMenu counts the foods of a menu
+	CountByMenu(ctx context.Context, menuID string) (int64, error)
+}
+
+// MenuRepository stores the menus foods belong to
+type MenuRepository interface {
+	Resource[models.Menu]
+}
+
+// TableRepository stores the tables of the restaurant
+type TableRepository interface {
+	Resource[models.Table]
+}
+
+// OrderRepository stores the orders placed at a table
+type OrderRepository interface {
+	Resource[models.Order]
+	// ListByTable returns the orders placed at a table
+	ListByTable(ctx context.Context, tableID string) ([]models.Order, error)
+}
+
+// OrderItemRepository stores the foods ordered in an order
+type OrderItemRepository interface {
+	Resource[models.OrderItem]
+	// ListByOrder returns every item of an order
+	ListByOrder(ctx context.Context, orderID string) ([]models.OrderItem, error)
+	// CountByFood counts the items that ordered a food
+	CountByFood(ctx context.Context, foodID string) (int64, error)
+	// CreateMany inserts several items at once, a failure is reported as a *WriteError
+	CreateMany(ctx context.Context, items []models.OrderItem) error
+}
+
+// InvoiceRepository stores the invoices of the orders
+type InvoiceRepository interface {
+	Resource[models.Invoice]
+	// ListByOrder returns the invoices of an order
+	ListByOrder(ctx context.Context, orderID string) ([]models.Invoice, error)
+}
+
+// BranchRepository stores the locations of the restaurant group, they are shared by every branch
+type BranchRepository interface {
+	Resource[models.Branch]
+}
+
+// UserRepository stores the staff accounts
+type UserRepository interface {
+	Resource[models.User]
+	// GetByEmail returns the user registered with the email
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	// GetByPhone returns the user registered with the phone number
+	GetByPhone(ctx context.Context, phone string) (models.User, error)
+}
+
+// AuditFilter narrows down a search of the audit log, zero fields match everything
+type AuditFilter struct {
+	Resource string
+	Actor    string
+	// Branch limits the search to one branch, the changes made outside a branch have none
+	Branch string
+	From   time.Time
+	To     time.Time
+}
+
+// AuditRepository stores the audit log of the changes made through the handlers
+type AuditRepository interface {
+	// Record appends an entry to the audit log
+	Record(ctx context.Context, entry models.AuditEntry) error
+	// Search returns one page of the entries matching the filter and the total number of matches
+	Search(ctx context.Context, filter AuditFilter, opts ListOptions) ([]models.AuditEntry, int64, error)
+}
+
+// RevocationRepository stores the access tokens that were revoked before they expired
+type RevocationRepository interface {
+	// Revoke records a revocation, its Created_at to the millisecond
+	Revoke(ctx context.Context, revocation models.Revocation) error
+	// IsRevoked reports whether the token with the given jti, issued to the user at issuedAt, was revoked
+	IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (bool, error)
+}
+
+// UserTokenRepository stores the hashes of the one-time tokens mailed to the users
+type UserTokenRepository interface {
+	// Issue stores a new token
+	Issue(ctx context.Context, token models.UserToken) error
+	// Consume marks the unused token with the hash and purpose as used and returns it,
+	// ErrNotFound when there is none or it expired before now
+	Consume(ctx context.Context, hash string, purpose string, now time.Time) (models.UserToken, error)
+}
+
+// LoginAttemptRepository keeps the history of the logins and counts the failed ones
+type LoginAttemptRepository interface {
+	// Record appends an attempt to the history
+	Record(ctx context.Context, attempt models.LoginAttempt) error
+	// History returns one page of the attempts on the account of the user, newest first, and their total number
+	History(ctx context.Context, userID string, opts ListOptions) ([]models.LoginAttempt, int64, error)
+	// Throttle returns the failure counter of the key, a zero counter when there is none or it expired before now
+	Throttle(ctx context.Context, key string, now time.Time) (models.LoginThrottle, error)
+	// Fail counts a failure for the key. The counter starts over when the last failure is older than window.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (models.LoginThrottle, error)
+	// Lock refuses every login of the key until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Clear forgets the counter of the key and unlocks it
+	Clear(ctx context.Context, key string) error
+}
+
+// APIKeyRepository stores the api keys of the devices, they are shared by the branches
+type APIKeyRepository interface {
+	Resource[models.APIKey]
+	// Touch sets the last use of the key to now unless it was set less than a minute before,
+	// it does not change the version of the key
+	Touch(ctx context.Context, id string, now time.Time) error
+}
+
+// Repositories bundles one repository per aggregate so they can be handed to the controllers together
+type Repositories struct {
+	Branches   BranchRepository
+	Foods      FoodRepository
+	Menus      MenuRepository
+	Tables     TableRepository
+	Orders     OrderRepository
+	OrderItems OrderItemRepository
+	Invoices   InvoiceRepository
+	Users      UserRepository
+	Audit      AuditRepository
+	// Revocations answers from an in-process cache, see CachedRevocations
+	Revocations RevocationRepository
+	UserTokens  UserTokenRepository
+	Logins      LoginAttemptRepository
+	APIKeys     APIKeyRepository
+
+	tx transactor
+}
+
+// transactor runs a function atomically, implemented by every backend
+type transactor interface {
+	withTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// WithTransaction runs fn so that either all of its writes are kept or none of them.
+// The repositories must be called with the context passed to fn. With mongodb this
+// needs a replica set or a sharded cluster, a standalone server rejects transactions.
+func (r *Repositories) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.tx.withTransaction(ctx, fn)
+}
+
+// newRepositories wires the aggregates on top of the collections of a backend
+func newRepositories(b backend) *Repositories {
+	return &Repositories{
+		Branches:   branchRepository{newResource[models.Branch](b, "branches", "branch_id", "")},
+		Foods:      foodRepository{newResource[models.Food](b, "food", "food_id", "branch_id")},
+		Menus:      menuRepository{newResource[models.Menu](b, "menu", "menu_id", "branch_id")},
+		Tables:     tableRepository{newResource[models.Table](b, "table", "table_id", "branch_id")},
+		Orders:     orderRepository{newResource[models.Order](b, "order", "order_id", "branch_id")},
+		OrderItems: orderItemRepository{newResource[models.OrderItem](b, "orderItems", "order_item_id", "branch_id")},
+		Invoices:   invoiceRepository{newResource[models.Invoice](b, "invoices", "invoice_id", "branch_id")},
+		Users:      userRepository{newResource[models.User](b, "users", "user_id", "branches")},
+		Audit:      auditRepository{store[models.AuditEntry]{coll: b.collection("audit_log"), branchField: "branch_id"}},
+		Revocations: CachedRevocations(
+			revocationRepository{store[models.Revocation]{coll: b.collection("revoked_tokens")}},
+			revocationCacheTTL,
+		),
+		UserTokens: userTokenRepository{store[models.UserToken]{coll: b.collection("user_tokens")}},
+		Logins: loginAttemptRepository{
+			attempts:  store[models.LoginAttempt]{coll: b.collection("login_attempts")},
+			throttles: store[models.LoginThrottle]{coll: b.collection("login_throttles")},
+		},
+		APIKeys: apiKeyRepository{newResource[models.APIKey](b, "api_keys", "key_id", "")},
+		tx:      b,
+	}
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"restaurant-backend/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type branchRepository struct {
+	resource[models.Branch]
+}
+
+type foodRepository struct {
+	resource[models.Food]
+}
+
+func (r foodRepository) CountByMenu(ctx context.Context, menuID string) (int64, error) {
+	return r.store.count(ctx, bson.M{"menu_id": menuID})
+}
+
+type menuRepository struct {
+	resource[models.Menu]
+}
+
+type tableRepository struct {
+	resource[models.Table]
+}
+
+type orderRepository struct {
+	resource[models.Order]
+}
+
+func (r orderRepository) ListByTable(ctx context.Context, tableID string) ([]models.Order, error) {
+	return r.store.find(ctx, bson.M{"table_id": tableID}, ListOptions{})
+}
+
+type orderItemRepository struct {
+	resource[models.OrderItem]
+}
+
+func (r orderItemRepository) ListByOrder(ctx context.Context, orderID string) ([]models.OrderItem, error) {
+	return r.store.find(ctx, bson.M{"order_id": orderID}, ListOptions{})
+}
+
+func (r orderItemRepository) CountByFood(ctx context.Context, foodID string) (int64, error) {
+	return r.store.count(ctx, bson.M{"food_id": foodID})
+}
+
+func (r orderItemRepository) CreateMany(ctx context.Context, items []models.OrderItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	err := r.store.insert(ctx, items...)
+	var writeErr *WriteError
+	if err != nil && len(items) == 1 && !errors.As(err, &writeErr) {
+		// a single item goes through InsertOne, which does not report an index
+		return &WriteError{Index: 0, Err: err}
+	}
+	return err
+}
+
+type invoiceRepository struct {
+	resource[models.Invoice]
+}
+
+func (r invoiceRepository) ListByOrder(ctx context.Context, orderID string) ([]models.Invoice, error) {
+	return r.store.find(ctx, bson.M{"order_id": orderID}, ListOptions{})
+}
+
+type userRepository struct {
+	resource[models.User]
+}
+
+func (r userRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.store.findOne(ctx, bson.M{"email": email})
+}
+
+func (r userRepository) GetByPhone(ctx context.Context, phone string) (models.User, error) {
+	return r.store.findOne(ctx, bson.M{"phone": phone})
+}
+
+type auditRepository struct {
+	store store[models.AuditEntry]
+}
+
+func (r auditRepository) Record(ctx context.Context, entry models.AuditEntry) error {
+	return r.store.insert(ctx, entry)
+}
+
+func (r auditRepository) Search(ctx context.Context, filter AuditFilter, opts ListOptions) ([]models.AuditEntry, int64, error) {
+	query := bson.M{}
+	if filter.Resource != "" {
+		query["resource"] = filter.Resource
+	}
+	if filter.Actor != "" {
+		query["actor_uid"] = filter.Actor
+	}
+	if filter.Branch != "" {
+		query["branch_id"] = filter.Branch
+	}
+	created := bson.M{}
+	if !filter.From.IsZero() {
+		created["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		created["$lte"] = filter.To
+	}
+	if len(created) > 0 {
+		query["created_at"] = created
+	}
+
+	entries, err := r.store.find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := r.store.count(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+type revocationRepository struct {
+	store store[models.Revocation]
+}
+
+func (r revocationRepository) Revoke(ctx context.Context, revocation models.Revocation) error {
+	return r.store.insert(ctx, revocation)
+}
+
+func (r revocationRepository) IsRevoked(ctx context.Context, jti string, userID string, issuedAt time.Time) (bool, error) {
+	// every token of the user issued before a revocation of all of them, or this one token. Both
+	// times count milliseconds, a token issued later in the second of the revocation stays valid.
+	clauses := bson.A{bson.M{"user_id": userID, "jti": "", "created_at": bson.M{"$gt": issuedAt}}}
+	if jti != "" {
+		clauses = append(clauses, bson.M{"jti": jti})
+	}
+	count, err := r.store.count(ctx, bson.M{"$or": clauses})
+	return count > 0, err
+}
+
+type userTokenRepository struct {
+	store store[models.UserToken]
+}
+
+func (r userTokenRepository) Issue(ctx context.Context, token models.UserToken) error {
+	return r.store.insert(ctx, token)
+}
+
+func (r userTokenRepository) Consume(ctx context.Context, hash string, purpose string, now time.Time) (models.UserToken, error) {
+	// finding and marking the token in one update, two requests with the same token can not both use it
+	filter := bson.M{"token_hash": hash, "purpose": purpose, "used_at": nil, "expires_at": bson.M{"$gt": now}}
+	return r.store.update(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "used_at", Value: now}}}})
+}
+
+type loginAttemptRepository struct {
+	attempts  store[models.LoginAttempt]
+	throttles store[models.LoginThrottle]
+}
+
+func (r loginAttemptRepository) Record(ctx context.Context, attempt models.LoginAttempt) error {
+	return r.attempts.insert(ctx, attempt)
+}
+
+func (r loginAttemptRepository) History(ctx context.Context, userID string, opts ListOptions) ([]models.LoginAttempt, int64, error) {
+	query := bson.M{"user_id": userID}
+	opts.Newest = true
+	attempts, err := r.attempts.find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := r.attempts.count(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return attempts, total, nil
+}
+
+func (r loginAttemptRepository) Throttle(ctx context.Context, key string, now time.Time) (models.LoginThrottle, error) {
+	// the TTL monitor of mongodb runs once a minute, an expired counter may still be there
+	throttle, err := r.throttles.findOne(ctx, bson.M{"key": key, "expires_at": bson.M{"$gt": now}})
+	if errors.Is(err, ErrNotFound) {
+		return models.LoginThrottle{Key: key}, nil
+	}
+	return throttle, err
+}
+
+func (r loginAttemptRepository) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (models.LoginThrottle, error) {
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "failures", Value: int64(1)}}},
+		{Key: "$set", Value: bson.D{{Key: "last_failure_at", Value: now}, {Key: "expires_at", Value: now.Add(window)}}},
+	}
+	for retried := false; ; retried = true {
+		throttle, err := r.throttles.update(ctx, bson.M{"key": key, "expires_at": bson.M{"$gt": now}}, update)
+		if !errors.Is(err, ErrNotFound) || retried {
+			return throttle, err
+		}
+		// the counter expired or there was none yet, it starts over
+		if err := r.throttles.delete(ctx, bson.M{"key": key}); err != nil && !errors.Is(err, ErrNotFound) {
+			return throttle, err
+		}
+		throttle = models.LoginThrottle{ID: primitive.NewObjectID(), Key: key, Failures: 1, Last_failure_at: now, Expires_at: now.Add(window)}
+		err = r.throttles.insert(ctx, throttle)
+		if !errors.Is(err, ErrDuplicate) {
+			return throttle, err
+		}
+		// a concurrent failure created the counter first, counting on top of it
+	}
+}
+
+func (r loginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.throttles.update(ctx, bson.M{"key": key}, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "locked_until", Value: until}, {Key: "expires_at", Value: until}}},
+	})
+	return err
+}
+
+func (r loginAttemptRepository) Clear(ctx context.Context, key string) error {
+	err := r.throttles.delete(ctx, bson.M{"key": key})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+type apiKeyRepository struct {
+	resource[models.APIKey]
+}
+
+// how often the last use of an api key is written, a busy device would otherwise write on every request
+const apiKeyTouchInterval = time.Minute
+
+func (r apiKeyRepository) Touch(ctx context.Context, id string, now time.Time) error {
+	filter := bson.M{r.idField: id, "$or": bson.A{
+		bson.M{"last_used_at": nil},
+		bson.M{"last_used_at": bson.M{"$lt": now.Add(-apiKeyTouchInterval)}},
+	}}
+	_, err := r.store.update(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "last_used_at", Value: now}}}})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// backend hands out the collections of one storage engine
+type backend interface {
+	transactor
+	collection(name string) collection
+}
+
+// collection is the untyped set of operations every backend implements.
+// Filters and updates use the mongo query language; the in-memory backend
+// understands the subset of it used by the repositories.
+type collection interface {
+	find(ctx context.Context, filter bson.M, opts ListOptions) ([]bson.Raw, error)
+	count(ctx context.Context, filter bson.M) (int64, error)
+	findOne(ctx context.Context, filter bson.M) (bson.Raw, error)
+	insert(ctx context.Context, docs []interface{}) error
+	update(ctx context.Context, filter bson.M, update bson.D) (bson.Raw, error)
+	delete(ctx context.Context, filter bson.M) error
+}
+
+// store decodes the documents of a collection into T
+type store[T any] struct {
+	coll collection
+	// branchField names the field holding the branch of a document, "branch_id" for
+	// most collections, "branches" for the users who can work at several branches
+	// and empty for collections that are shared by every branch
+	branchField string
+}
+
+// scoped hides soft-deleted documents unless the context asks for them or the filter
+// already says something about deleted_at, and hides the documents of other branches
+func (s store[T]) scoped(ctx context.Context, filter bson.M) bson.M {
+	out := s.branchScoped(ctx, filter)
+	if includeDeleted(ctx) {
+		return out
+	}
+	if _, ok := filter["deleted_at"]; ok {
+		return out
+	}
+	out = copyFilter(out)
+	out["deleted_at"] = nil
+	return out
+}
+
+// branchScoped restricts the filter to the branch of the context
+func (s store[T]) branchScoped(ctx context.Context, filter bson.M) bson.M {
+	branch, ok := branchScope(ctx)
+	if !ok || s.branchField == "" {
+		return filter
+	}
+	out := copyFilter(filter)
+	out[s.branchField] = branch
+	return out
+}
+
+func copyFilter(filter bson.M) bson.M {
+	out := make(bson.M, len(filter)+1)
+	for key, value := range filter {
+		out[key] = value
+	}
+	return out
+}
+
+func (s store[T]) find(ctx context.Context, filter bson.M, opts ListOptions) ([]T, error) {
+	raws, err := s.coll.find(ctx, s.scoped(ctx, filter), opts)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]T, 0, len(raws))
+	for _, raw := range raws {
+		var doc T
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (s store[T]) count(ctx context.Context, filter bson.M) (int64, error) {
+	return s.coll.count(ctx, s.scoped(ctx, filter))
+}
+
+func (s store[T]) findOne(ctx context.Context, filter bson.M) (T, error) {
+	var doc T
+	raw, err := s.coll.findOne(ctx, s.scoped(ctx, filter))
+	if err != nil {
+		return doc, err
+	}
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+func (s store[T]) insert(ctx context.Context, docs ...T) error {
+	values := make([]interface{}, len(docs))
+	for i := range docs {
+		value, err := s.stamped(ctx, docs[i])
+		if err != nil {
+			return &WriteError{Index: i, Err: err}
+		}
+		values[i] = value
+	}
+	return s.coll.insert(ctx, values)
+}
+
+// stamped puts the branch of the context on a document that has none and refuses a
+// document of another branch. Documents of collections without a single branch
+// field are written as they are.
+func (s store[T]) stamped(ctx context.Context, doc T) (interface{}, error) {
+	branch, ok := branchScope(ctx)
+	if !ok || s.branchField != "branch_id" {
+		return doc, nil
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var fields bson.D
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for i, field := range fields {
+		if field.Key != "branch_id" {
+			continue
+		}
+		switch field.Value {
+		case branch:
+			return fields, nil
+		case "", nil:
+			fields[i].Value = branch
+			return fields, nil
+		}
+		return nil, ErrWrongBranch
+	}
+	return append(fields, bson.E{Key: "branch_id", Value: branch}), nil
+}
+
+func (s store[T]) update(ctx context.Context, filter bson.M, update bson.D) (T, error) {
+	var doc T
+	raw, err := s.coll.update(ctx, s.scoped(ctx, filter), update)
+	if err != nil {
+		return doc, err
+	}
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+// delete removes the matching document for good, soft-deleted or not
+func (s store[T]) delete(ctx context.Context, filter bson.M) error {
+	return s.coll.delete(ctx, s.branchScoped(ctx, filter))
+}
+
+// resource implements Resource[T] for a collection whose documents are addressed by idField
+type resource[T any] struct {
+	store   store[T]
+	idField string
+}
+
+func newResource[T any](b backend, name string, idField string, branchField string) resource[T] {
+	return resource[T]{store: store[T]{coll: b.collection(name), branchField: branchField}, idField: idField}
+}
+
+func (r resource[T]) List(ctx context.Context, opts ListOptions) ([]T, int64, error) {
+	docs, err := r.store.find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := r.store.count(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+	return docs, total, nil
+}
+
+func (r resource[T]) Get(ctx context.Context, id string) (T, error) {
+	return r.store.findOne(ctx, bson.M{r.idField: id})
+}
+
+func (r resource[T]) Create(ctx context.Context, doc T) error {
+	return r.store.insert(ctx, doc)
+}
+
+func (r resource[T]) Update(ctx context.Context, id string, version int64, changes primitive.D) (T, error) {
+	filter := bson.M{r.idField: id}
+	if version > 0 {
+		filter["version"] = version
+	}
+	doc, err := r.store.update(ctx, filter, bson.D{
+		{Key: "$set", Value: changes},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	})
+	if errors.Is(err, ErrNotFound) && version > 0 {
+		// the document is either gone or was changed by someone else
+		if _, getErr := r.store.findOne(ctx, bson.M{r.idField: id}); getErr == nil {
+			return doc, ErrVersionConflict
+		}
+	}
+	return doc, err
+}
+
+func (r resource[T]) Delete(ctx context.Context, id string) (T, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return r.store.update(ctx, bson.M{r.idField: id}, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "deleted_at", Value: now}, {Key: "updated_at", Value: now}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	})
+}
+
+func (r resource[T]) Restore(ctx context.Context, id string) (T, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return r.store.update(ctx, bson.M{r.idField: id, "deleted_at": bson.M{"$ne": nil}}, bson.D{
+		{Key: "$unset", Value: bson.D{{Key: "deleted_at", Value: ""}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: now}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	})
+}
+
+func (r resource[T]) Purge(ctx context.Context, id string) error {
+	return r.store.delete(ctx, bson.M{r.idField: id, "deleted_at": bson.M{"$ne": nil}})
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// function responsible for configuring the api key routes, like the branches
+// the keys are not scoped to a branch and only the admins manage them
+func APIKeyRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
+	// Get request that lists the api keys, without their secrets
+	incomingRoutes.GET("/api-keys",middleware.RequireAdmin(),ctl.GetAPIKeys())
+	// Post request that creates an api key and answers with it once
+	incomingRoutes.POST("/api-keys",middleware.RequireAdmin(),ctl.CreateAPIKey())
+	// Delete request that revokes an api key
+	incomingRoutes.DELETE("/api-keys/:key_id",middleware.RequireAdmin(),ctl.RevokeAPIKey())
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// function responsible for configuring the audit log routes
+// it takes an argument of type *gin.Engine
+func AuditRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
+	// Get request that searches the audit log by resource, actor and date range, admins only
+	incomingRoutes.GET("/audit",middleware.RequireAdmin(),ctl.GetAudit())
+}
@@ -0,0 +1,30 @@
+package routes
+
+// importing the necessary packages
+import (
+	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// function responsible for configuring routes related to branch operations
+// the branch routes are not scoped to a branch, everything but the listing is for admins
+func BranchRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
+	// Get request that retrieves the branches of the caller, admins see every branch
+	incomingRoutes.GET("/branches",ctl.GetBranches())
+	// Get request that retrieves a specific branch, staff only get the branches they work at
+	incomingRoutes.GET("/branches/:branch_id",ctl.GetBranch())
+	// Post request that opens a new branch
+	incomingRoutes.POST("/branches",middleware.RequireAdmin(),ctl.CreateBranch())
+	// Patch request that updates the name or address of a branch
+	incomingRoutes.PATCH("/branches/:branch_id",middleware.RequireAdmin(),ctl.UpdateBranch())
+	// Delete request that soft-deletes a branch without tables, menus or staff
+	incomingRoutes.DELETE("/branches/:branch_id",middleware.RequireAdmin(),ctl.DeleteBranch())
+	// Post request that restores a soft-deleted branch
+	incomingRoutes.POST("/branches/:branch_id/restore",middleware.RequireAdmin(),ctl.RestoreBranch())
+	// Post request that removes a soft-deleted branch for good
+	incomingRoutes.POST("/branches/:branch_id/purge",middleware.RequireAdmin(),ctl.PurgeBranch())
+	// Put request that replaces the branches a user works at
+	incomingRoutes.PUT("/users/:user_id/branches",middleware.RequireAdmin(),ctl.SetUserBranches())
+}
@@ -2,19 +2,26 @@ package routes
 
 import (
 	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 // function responsible for configuring routes related to food operation
-// It takes a gin engine argument, incomingRoutes.
-func FoodRoutes(incomingRoutes *gin.Engine){
+// It takes a gin engine argument, incomingRoutes, and the controller serving the requests.
+func FoodRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
 	// the Get request retrives a list of foods from the database
-	incomingRoutes.GET("/foods",controller.GetFoods())
+	incomingRoutes.GET("/foods",middleware.Allow(middleware.FoodRead),ctl.GetFoods())
 	// the Get request retrieves  a specific type of food from the database
-	incomingRoutes.GET("/foods/:food_id",controller.GetFood())
+	incomingRoutes.GET("/foods/:food_id",middleware.Allow(middleware.FoodRead),ctl.GetFood())
 	// the Post request creates a new food item in the database 
-	incomingRoutes.POST("/foods",controller.CreateFood())
+	incomingRoutes.POST("/foods",middleware.Allow(middleware.FoodWrite),ctl.CreateFood())
 	// the Patch request updates a specific item entry in the database
-	incomingRoutes.PATCH("/foods/:food_id",controller.UpdateFood())
+	incomingRoutes.PATCH("/foods/:food_id",middleware.Allow(middleware.FoodWrite),ctl.UpdateFood())
+	// Delete request that soft-deletes a food, it is hidden until restored
+	incomingRoutes.DELETE("/foods/:food_id",middleware.Allow(middleware.FoodWrite),ctl.DeleteFood())
+	// Post request that restores a soft-deleted food
+	incomingRoutes.POST("/foods/:food_id/restore",middleware.Allow(middleware.FoodWrite),ctl.RestoreFood())
+	// Post request that removes a soft-deleted food for good, admins only
+	incomingRoutes.POST("/foods/:food_id/purge",middleware.RequireAdmin(),ctl.PurgeFood())
 }
\ No newline at end of file
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "restaurant-backend/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// function responsible for configuring the probes of the orchestrator,
+// they are registered before the authentication middleware
+func HealthRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
+	// Get request that answers as long as the process is alive
+	incomingRoutes.GET("/healthz",ctl.Healthz())
+	// Get request that answers whether mongodb is reachable and the server takes traffic
+	incomingRoutes.GET("/readyz",ctl.Readyz())
+}
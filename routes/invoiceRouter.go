@@ -3,19 +3,26 @@ package routes
 // importing the necessary libraries
 import (
 	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 // function used to configure routes related to Invoice operation
 // function takes in an argument,incomingRoutes of type *gin.Engine
-func InvoiceRoutes(incomingRoutes *gin.Engine){
+func InvoiceRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
 	// Get request that retrieves a list of invoices
-	incomingRoutes.GET("/invoices",controller.GetInvoices())
+	incomingRoutes.GET("/invoices",middleware.Allow(middleware.InvoiceRead),ctl.GetInvoices())
 	// Get request that retrieves a specific invoice
-	incomingRoutes.GET("/invoices/:invoice_id",controller.GetInvoice())
+	incomingRoutes.GET("/invoices/:invoice_id",middleware.Allow(middleware.InvoiceRead),ctl.GetInvoice())
 	// Post request that creates a new invoice to the database
-	incomingRoutes.POST("/invoices",controller.CreateInvoice())
-	// Patch request that updates a specific item entry
-	incomingRoutes.PATCH("/invoices/:invoice_id",controller.UpdateInvoice())
+	incomingRoutes.POST("/invoices",middleware.Allow(middleware.InvoiceWrite),ctl.CreateInvoice())
+	// Patch request that updates a specific item entry, changing the payment_status needs invoice:pay
+	incomingRoutes.PATCH("/invoices/:invoice_id",middleware.Allow(middleware.InvoiceWrite),ctl.UpdateInvoice())
+	// Delete request that soft-deletes a invoice, it is hidden until restored
+	incomingRoutes.DELETE("/invoices/:invoice_id",middleware.Allow(middleware.InvoiceWrite),ctl.DeleteInvoice())
+	// Post request that restores a soft-deleted invoice
+	incomingRoutes.POST("/invoices/:invoice_id/restore",middleware.Allow(middleware.InvoiceWrite),ctl.RestoreInvoice())
+	// Post request that removes a soft-deleted invoice for good, admins only
+	incomingRoutes.POST("/invoices/:invoice_id/purge",middleware.RequireAdmin(),ctl.PurgeInvoice())
 }
\ No newline at end of file
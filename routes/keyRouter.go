@@ -0,0 +1,14 @@
+package routes
+
+import (
+	controller "restaurant-backend/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// function responsible for publishing the token keys, they are registered before the
+// authentication middleware
+func KeyRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
+	// Get request for the public keys in the JSON Web Key Set format
+	incomingRoutes.GET("/.well-known/jwks.json",ctl.Jwks())
+}
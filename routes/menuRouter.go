@@ -3,19 +3,28 @@ package routes
 // importing the necessary libraries
 import (
 	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 // function responsible for configuring routes related to Menu operations
 // it takes an argument of type *gin.Engine
-func MenuRoutes(incomingRoutes *gin.Engine){
+func MenuRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
 	// Get request that retrieves a list of menus
-	incomingRoutes.GET("/menus",controller.GetMenus())
+	incomingRoutes.GET("/menus",middleware.Allow(middleware.MenuRead),ctl.GetMenus())
+	// Get request that retrieves the menus served at a moment, now or the at query parameter, with their foods
+	incomingRoutes.GET("/menus/active",middleware.Allow(middleware.MenuRead),ctl.GetActiveMenus())
 	// Get request that retrieves a specific menu
-	incomingRoutes.GET("/menus/:menu_id",controller.GetMenu())
+	incomingRoutes.GET("/menus/:menu_id",middleware.Allow(middleware.MenuRead),ctl.GetMenu())
 	// Post request that creates a new menu into the database
-	incomingRoutes.POST("/menus",controller.CreateMenu())
+	incomingRoutes.POST("/menus",middleware.Allow(middleware.MenuWrite),ctl.CreateMenu())
 	// Patch request that updates a menus specific entry
-	incomingRoutes.PATCH("/menus/:menu_id",controller.UpdateMenu())
+	incomingRoutes.PATCH("/menus/:menu_id",middleware.Allow(middleware.MenuWrite),ctl.UpdateMenu())
+	// Delete request that soft-deletes a menu, it is hidden until restored
+	incomingRoutes.DELETE("/menus/:menu_id",middleware.Allow(middleware.MenuWrite),ctl.DeleteMenu())
+	// Post request that restores a soft-deleted menu
+	incomingRoutes.POST("/menus/:menu_id/restore",middleware.Allow(middleware.MenuWrite),ctl.RestoreMenu())
+	// Post request that removes a soft-deleted menu for good, admins only
+	incomingRoutes.POST("/menus/:menu_id/purge",middleware.RequireAdmin(),ctl.PurgeMenu())
 }
\ No newline at end of file
@@ -3,21 +3,28 @@ package routes
 // importing the necessary packages
 import (
 	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 // function responsible for configuring routes related to orderItem operation
 // takes an argument of type *gin.Engine
-func OrderItemRoutes(incomingRoutes *gin.Engine){
+func OrderItemRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
 	// Get request that retrieves a list of order items from the database
-	incomingRoutes.GET("/orderItems",controller.GetOrderItems())
+	incomingRoutes.GET("/orderItems",middleware.Allow(middleware.OrderItemRead),ctl.GetOrderItems())
 	// Get request that retrives a specific item from the database
-	incomingRoutes.GET("/orderItems/:orderItem_id",controller.GetOrderItem())
+	incomingRoutes.GET("/orderItems/:orderItem_id",middleware.Allow(middleware.OrderItemRead),ctl.GetOrderItem())
 	// Get request that retrieves a specific order from the database
-	incomingRoutes.GET("/orderItems-order/:order_id",controller.GetOrderItemsByOrder())
+	incomingRoutes.GET("/orderItems-order/:order_id",middleware.Allow(middleware.OrderItemRead),ctl.GetOrderItemsByOrder())
 	// Post request that creates a new order entry to the database
-	incomingRoutes.POST("/orderItems",controller.CreateOrderItem())
+	incomingRoutes.POST("/orderItems",middleware.Allow(middleware.OrderItemWrite),ctl.CreateOrderItem())
 	// Patch request that updates a specific order item entry
-	incomingRoutes.PATCH("/orderItems/:orderItem_id",controller.UpdateOrderItem())
+	incomingRoutes.PATCH("/orderItems/:orderItem_id",middleware.Allow(middleware.OrderItemWrite),ctl.UpdateOrderItem())
+	// Delete request that soft-deletes a order item, it is hidden until restored
+	incomingRoutes.DELETE("/orderItems/:orderItem_id",middleware.Allow(middleware.OrderItemWrite),ctl.DeleteOrderItem())
+	// Post request that restores a soft-deleted order item
+	incomingRoutes.POST("/orderItems/:orderItem_id/restore",middleware.Allow(middleware.OrderItemWrite),ctl.RestoreOrderItem())
+	// Post request that removes a soft-deleted order item for good, admins only
+	incomingRoutes.POST("/orderItems/:orderItem_id/purge",middleware.RequireAdmin(),ctl.PurgeOrderItem())
 }
\ No newline at end of file
@@ -3,18 +3,25 @@ package routes
 // importing the necessary packages
 import (
 	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 // function responsible for configuring the routes related to order operations
 // takes an argument,incomingRoutes of type *gin.Engine
-func OrderRoutes(incomingRoutes *gin.Engine){
+func OrderRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
 	// Get request that retrieves a list of orders from the database
-	incomingRoutes.GET("/orders",controller.GetOrders())
+	incomingRoutes.GET("/orders",middleware.Allow(middleware.OrderRead),ctl.GetOrders())
 	// Get request that retrieves a specific order from the database
-	incomingRoutes.GET("/orders/:order_id",controller.GetOrder())
+	incomingRoutes.GET("/orders/:order_id",middleware.Allow(middleware.OrderRead),ctl.GetOrder())
 	// Post request that creates a new order to the database
-	incomingRoutes.POST("/orders",controller.CreateOrder())
+	incomingRoutes.POST("/orders",middleware.Allow(middleware.OrderWrite),ctl.CreateOrder())
 	// Patch request that updates a specific order entry from the database
-	incomingRoutes.PATCH("/orders/:order_id",controller.UpdateOrder())
+	incomingRoutes.PATCH("/orders/:order_id",middleware.Allow(middleware.OrderWrite),ctl.UpdateOrder())
+	// Delete request that soft-deletes a order, it is hidden until restored
+	incomingRoutes.DELETE("/orders/:order_id",middleware.Allow(middleware.OrderWrite),ctl.DeleteOrder())
+	// Post request that restores a soft-deleted order
+	incomingRoutes.POST("/orders/:order_id/restore",middleware.Allow(middleware.OrderWrite),ctl.RestoreOrder())
+	// Post request that removes a soft-deleted order for good, admins only
+	incomingRoutes.POST("/orders/:order_id/purge",middleware.RequireAdmin(),ctl.PurgeOrder())
 }
\ No newline at end of file
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// function responsible for configuring the role routes, like the branches
+// the roles are not scoped to a branch
+func RoleRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
+	// Get request that lists the roles and what each of them may do
+	incomingRoutes.GET("/roles",ctl.GetRoles())
+	// Put request that replaces the roles of a user, admins only
+	incomingRoutes.PUT("/users/:user_id/roles",middleware.RequireAdmin(),ctl.SetUserRoles())
+}
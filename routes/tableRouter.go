@@ -3,19 +3,26 @@ package routes
 // importing the necessary packages
 import (
 	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 // function responsible for configuring routes related to tables operations
 // takes an argument of type *gin.Engine
-func TableRoutes(incomingRoutes *gin.Engine){
+func TableRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
 	// Get request that retreives a list of tables from the database
-	incomingRoutes.GET("/tables",controller.GetTables())
+	incomingRoutes.GET("/tables",middleware.Allow(middleware.TableRead),ctl.GetTables())
 	// Get request that retrieves a specific table from the database
-	incomingRoutes.GET("/tables/:table_id",controller.GetTable())
+	incomingRoutes.GET("/tables/:table_id",middleware.Allow(middleware.TableRead),ctl.GetTable())
 	// Post request that creates a new table entry in the database
-	incomingRoutes.POST("/tables",controller.CreateTable())
+	incomingRoutes.POST("/tables",middleware.Allow(middleware.TableWrite),ctl.CreateTable())
 	// Patch request that updates a specific entry in the database
-	incomingRoutes.PATCH("/tables/:table_id",controller.UpdateTable())
+	incomingRoutes.PATCH("/tables/:table_id",middleware.Allow(middleware.TableWrite),ctl.UpdateTable())
+	// Delete request that soft-deletes a table, it is hidden until restored
+	incomingRoutes.DELETE("/tables/:table_id",middleware.Allow(middleware.TableWrite),ctl.DeleteTable())
+	// Post request that restores a soft-deleted table
+	incomingRoutes.POST("/tables/:table_id/restore",middleware.Allow(middleware.TableWrite),ctl.RestoreTable())
+	// Post request that removes a soft-deleted table for good, admins only
+	incomingRoutes.POST("/tables/:table_id/purge",middleware.RequireAdmin(),ctl.PurgeTable())
 }
\ No newline at end of file
@@ -2,19 +2,67 @@ package routes
 
 import (
 	controller "restaurant-backend/controllers"
+	"restaurant-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 // function responsible for configuring the user operations
 // the function takes a gin engine argument,incomingRoutes
-func UserRoutes(incomingRoutes *gin.Engine){
-	// the Get request retrieves a list of users from the database
-	incomingRoutes.GET("/users",controller.GetUsers())
-	// the Get request retrieves a specific user from the database
-	incomingRoutes.GET("/users/:user_id",controller.GetUser())
+func UserRoutes(incomingRoutes *gin.Engine,ctl *controller.Controller){
+	// the Get request retrieves a list of the users of the branch from the database
+	incomingRoutes.GET("/users",middleware.Authentication(),middleware.BranchScope(),middleware.Allow(middleware.UserRead),ctl.GetUsers())
+	// the Get request retrieves the user the token was issued to
+	incomingRoutes.GET("/users/me",middleware.Authentication(),ctl.GetMe())
+	// the Post request changes the password of the user the token was issued to
+	incomingRoutes.POST("/users/me/password",middleware.Authentication(),ctl.ChangePassword())
+	// the Post requests turn two-factor authentication on for the user the token was issued to,
+	// the first one creates the secret of the authenticator app and the second confirms it with a code
+	incomingRoutes.POST("/users/me/mfa",middleware.Authentication(),ctl.StartMFA())
+	incomingRoutes.POST("/users/me/mfa/confirm",middleware.Authentication(),ctl.ConfirmMFA())
+	// the Post request turns two-factor authentication off again
+	incomingRoutes.POST("/users/me/mfa/disable",middleware.Authentication(),ctl.DisableMFA())
+	// the Post request replaces the recovery codes
+	incomingRoutes.POST("/users/me/mfa/recovery-codes",middleware.Authentication(),ctl.RegenerateRecoveryCodes())
+	// the Put request sets the PIN the user switches to their account with on a shared terminal, the Delete request removes it
+	incomingRoutes.PUT("/users/me/pin",middleware.Authentication(),ctl.SetPin())
+	incomingRoutes.DELETE("/users/me/pin",middleware.Authentication(),ctl.RemovePin())
+	// the Post request switches a shared terminal logged in with an api key to a member of staff of its branch by their PIN
+	incomingRoutes.POST("/users/pin-login",middleware.Authentication(),middleware.BranchScope(),middleware.Allow(middleware.PinLogin),ctl.PinLogin())
+	// the Get request retrieves a specific user of the branch from the database
+	incomingRoutes.GET("/users/:user_id",middleware.Authentication(),middleware.BranchScope(),middleware.Allow(middleware.UserRead),ctl.GetUser())
 	// the Post request creates a new user to the database
-	incomingRoutes.POST("/users/signup",controller.SignUp())
+	incomingRoutes.POST("/users/signup",ctl.SignUp())
 	// the Post request creates the user to the database
-	incomingRoutes.POST("/users/login",controller.Login())
+	incomingRoutes.POST("/users/login",ctl.Login())
+	// the Post request finishes the login of a user with two-factor authentication with a one-time code
+	incomingRoutes.POST("/users/login/mfa",ctl.LoginMFA())
+	// the Post request exchanges a refresh token for a new access and refresh token
+	incomingRoutes.POST("/users/refresh",ctl.Refresh())
+	// the Post request mails a link to reset the password
+	incomingRoutes.POST("/users/password/forgot",ctl.ForgotPassword())
+	// the Post request sets a new password with the token of the mailed link
+	incomingRoutes.POST("/users/password/reset",ctl.ResetPassword())
+	// the Post request mails another link to verify the email
+	incomingRoutes.POST("/users/email/verify/resend",ctl.ResendVerification())
+	// the Post request marks the email as verified with the token of the mailed link
+	incomingRoutes.POST("/users/email/verify",ctl.VerifyEmail())
+	// the Post request revokes the token it is sent with and the refresh tokens of the user
+	incomingRoutes.POST("/users/logout",middleware.Authentication(),ctl.Logout())
+	// the Post request revokes every token of a user, admins only
+	incomingRoutes.POST("/users/:user_id/revoke-sessions",middleware.Authentication(),middleware.RequireAdmin(),ctl.RevokeSessions())
+	// the Get request lists the login attempts on the account of a user, for the user and the admins
+	incomingRoutes.GET("/users/:user_id/logins",middleware.Authentication(),ctl.GetLoginHistory())
+	// the Post request turns two-factor authentication off for a user who lost their device, admins only
+	incomingRoutes.POST("/users/:user_id/mfa/reset",middleware.Authentication(),middleware.RequireAdmin(),ctl.ResetMFA())
+	// the Post request lifts the lockout after too many failed logins, admins only
+	incomingRoutes.POST("/users/:user_id/unlock",middleware.Authentication(),middleware.RequireAdmin(),ctl.UnlockUser())
+	// the Patch request updates the names, phone number and avatar of a user, for the user and the managers of their branches
+	incomingRoutes.PATCH("/users/:user_id",middleware.Authentication(),ctl.UpdateUser())
+	// Delete request that soft-deletes a user of the branch, it is hidden until restored
+	incomingRoutes.DELETE("/users/:user_id",middleware.Authentication(),middleware.BranchScope(),middleware.Allow(middleware.UserWrite),ctl.DeleteUser())
+	// Post request that restores a soft-deleted user
+	incomingRoutes.POST("/users/:user_id/restore",middleware.Authentication(),middleware.BranchScope(),middleware.Allow(middleware.UserWrite),ctl.RestoreUser())
+	// Post request that removes a soft-deleted user for good, admins only
+	incomingRoutes.POST("/users/:user_id/purge",middleware.Authentication(),middleware.BranchScope(),middleware.RequireAdmin(),ctl.PurgeUser())
 }
\ No newline at end of file
@@ -0,0 +1,72 @@
+package seed
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"restaurant-backend/repository"
+	"time"
+)
+
+// Command runs the "seed" subcommand of the binary:
+//
+//	seed load fixture.yaml
+//	seed generate [-branch name] [-tables n] [-menus n] [-foods n] [-orders-per-day n] [-from date] [-to date] [-seed n]
+func Command(ctx context.Context, repos *repository.Repositories, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: seed load|generate")
+	}
+
+	var report Report
+	switch args[0] {
+	case "load":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: seed load fixture.yaml")
+		}
+		fixture, err := ReadFixture(args[1])
+		if err != nil {
+			return err
+		}
+		if report, err = Load(ctx, repos, fixture); err != nil {
+			return err
+		}
+
+	case "generate":
+		flags := flag.NewFlagSet("seed generate", flag.ContinueOnError)
+		flags.SetOutput(out)
+		opts := GenerateOptions{}
+		flags.StringVar(&opts.Branch, "branch", DefaultBranch, "branch to generate the restaurant in, created when missing")
+		flags.IntVar(&opts.Tables, "tables", 12, "number of tables")
+		flags.IntVar(&opts.Menus, "menus", 4, "number of menus")
+		flags.IntVar(&opts.FoodsPerMenu, "foods", 6, "number of foods on each menu")
+		flags.IntVar(&opts.OrdersPerDay, "orders-per-day", 20, "average number of orders a day, 0 for none")
+		from := flags.String("from", time.Now().UTC().AddDate(0, 0, -30).Format("2006-01-02"), "first day with orders")
+		to := flags.String("to", time.Now().UTC().Format("2006-01-02"), "last day with orders")
+		flags.Int64Var(&opts.Seed, "seed", time.Now().UnixNano(), "random seed, the same seed makes the same restaurant")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		var err error
+		if opts.From, err = time.Parse("2006-01-02", *from); err != nil {
+			return fmt.Errorf("-from: %w", err)
+		}
+		if opts.To, err = time.Parse("2006-01-02", *to); err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+		if report, err = Generate(ctx, repos, opts); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown seed command %q, expected load or generate", args[0])
+	}
+
+	fmt.Fprintf(out, "created %d branches, %d menus, %d foods, %d tables, %d users, %d orders, %d order items and %d invoices",
+		report.Branches, report.Menus, report.Foods, report.Tables, report.Users, report.Orders, report.OrderItems, report.Invoices)
+	if report.Skipped > 0 {
+		fmt.Fprintf(out, ", skipped %d that already existed", report.Skipped)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
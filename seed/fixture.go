@@ -0,0 +1,261 @@
+// Package seed fills a database with data to develop and test against, either from
+// a declarative fixture file or from a generator that makes up a whole restaurant.
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"restaurant-backend/models"
+	"restaurant-backend/money"
+	"restaurant-backend/repository"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is the content of a fixture file. Menus carry their foods so the foods
+// can be written without knowing the generated menu ids. Everything is loaded into
+// the branch named Branch, DefaultBranch when it is empty.
+type Fixture struct {
+	Branch string         `json:"branch" yaml:"branch"`
+	Menus  []FixtureMenu  `json:"menus" yaml:"menus"`
+	Tables []FixtureTable `json:"tables" yaml:"tables"`
+	Users  []FixtureUser  `json:"users" yaml:"users"`
+}
+
+type FixtureMenu struct {
+	Name     string        `json:"name" yaml:"name"`
+	Category string        `json:"category" yaml:"category"`
+	Foods    []FixtureFood `json:"foods" yaml:"foods"`
+}
+
+// FixtureFood is priced in the default currency, the price is read as decimal text
+// so it is not rounded through a float
+type FixtureFood struct {
+	Name       string      `json:"name" yaml:"name"`
+	Price      json.Number `json:"price" yaml:"price"`
+	Food_image string      `json:"food_image" yaml:"food_image"`
+}
+
+type FixtureTable struct {
+	Table_number     int `json:"table_number" yaml:"table_number"`
+	Number_of_guests int `json:"number_of_guests" yaml:"number_of_guests"`
+}
+
+type FixtureUser struct {
+	First_name string `json:"first_name" yaml:"first_name"`
+	Last_name  string `json:"last_name" yaml:"last_name"`
+	Email      string `json:"email" yaml:"email"`
+	Phone      string `json:"phone" yaml:"phone"`
+	Password   string `json:"password" yaml:"password"`
+	// Roles are checked against models.Roles
+	Roles []string `json:"roles" yaml:"roles"`
+}
+
+// DefaultBranch is the branch seeded when none is named, the branch migration 6 creates
+const DefaultBranch = "Main"
+
+// Report counts what a seed wrote and what it found already in place
+type Report struct {
+	Branches, Menus, Foods, Tables, Users, Orders, OrderItems, Invoices int
+	Skipped                                                             int
+}
+
+// ReadFixture reads a fixture file, .yaml/.yml files are YAML and everything else JSON
+func ReadFixture(path string) (Fixture, error) {
+	var fixture Fixture
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fixture, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &fixture)
+	default:
+		err = json.Unmarshal(content, &fixture)
+	}
+	if err != nil {
+		return fixture, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+// Load writes a fixture through the repositories in the order the references need:
+// menus, their foods, tables and users. Menus are matched by name, tables by number
+// and users by email, so loading the same fixture twice does not duplicate anything.
+func Load(ctx context.Context, repos *repository.Repositories, fixture Fixture) (Report, error) {
+	var report Report
+	now := timestamp(time.Now())
+
+	branchId, err := useBranch(ctx, repos, fixture.Branch, now, &report)
+	if err != nil {
+		return report, err
+	}
+	ctx = repository.WithBranch(ctx, branchId)
+
+	menus, _, err := repos.Menus.List(ctx, repository.ListOptions{})
+	if err != nil {
+		return report, err
+	}
+	menuIds := map[string]string{}
+	for _, menu := range menus {
+		menuIds[menu.Name] = menu.Menu_id
+	}
+
+	foods, _, err := repos.Foods.List(ctx, repository.ListOptions{})
+	if err != nil {
+		return report, err
+	}
+	// a food is known by its menu and its name
+	foodKeys := map[string]bool{}
+	for _, food := range foods {
+		if food.Menu_id != nil && food.Name != nil {
+			foodKeys[*food.Menu_id+"/"+*food.Name] = true
+		}
+	}
+
+	for _, fixtureMenu := range fixture.Menus {
+		menuId, exists := menuIds[fixtureMenu.Name]
+		if exists {
+			report.Skipped++
+		} else {
+			menu := models.Menu{Name: fixtureMenu.Name, Category: fixtureMenu.Category, Created_at: now, Updated_at: now, Version: 1}
+			menu.ID = primitive.NewObjectID()
+			menu.Menu_id = menu.ID.Hex()
+			if err := repos.Menus.Create(ctx, menu); err != nil {
+				return report, fmt.Errorf("menu %q: %w", fixtureMenu.Name, err)
+			}
+			menuId = menu.Menu_id
+			menuIds[menu.Name] = menuId
+			report.Menus++
+		}
+
+		for _, fixtureFood := range fixtureMenu.Foods {
+			if foodKeys[menuId+"/"+fixtureFood.Name] {
+				report.Skipped++
+				continue
+			}
+			if err := createFood(ctx, repos, menuId, fixtureFood, now); err != nil {
+				return report, fmt.Errorf("food %q: %w", fixtureFood.Name, err)
+			}
+			foodKeys[menuId+"/"+fixtureFood.Name] = true
+			report.Foods++
+		}
+	}
+
+	tables, _, err := repos.Tables.List(ctx, repository.ListOptions{})
+	if err != nil {
+		return report, err
+	}
+	tableNumbers := map[int]bool{}
+	for _, table := range tables {
+		if table.Table_number != nil {
+			tableNumbers[*table.Table_number] = true
+		}
+	}
+	for _, fixtureTable := range fixture.Tables {
+		if tableNumbers[fixtureTable.Table_number] {
+			report.Skipped++
+			continue
+		}
+		if _, err := createTable(ctx, repos, fixtureTable.Table_number, fixtureTable.Number_of_guests, now); err != nil {
+			return report, fmt.Errorf("table %d: %w", fixtureTable.Table_number, err)
+		}
+		tableNumbers[fixtureTable.Table_number] = true
+		report.Tables++
+	}
+
+	for _, fixtureUser := range fixture.Users {
+		// emails are unique across the branches
+		_, err := repos.Users.GetByEmail(repository.AllBranches(ctx), fixtureUser.Email)
+		if err == nil {
+			report.Skipped++
+			continue
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return report, err
+		}
+		if err := createUser(ctx, repos, fixtureUser, branchId, now); err != nil {
+			return report, fmt.Errorf("user %q: %w", fixtureUser.Email, err)
+		}
+		report.Users++
+	}
+
+	return report, nil
+}
+
+// useBranch returns the id of the branch with the given name, creating the branch when
+// there is none yet
+func useBranch(ctx context.Context, repos *repository.Repositories, name string, now time.Time, report *Report) (string, error) {
+	if name == "" {
+		name = DefaultBranch
+	}
+	branches, _, err := repos.Branches.List(ctx, repository.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, branch := range branches {
+		if branch.Name != nil && *branch.Name == name {
+			return branch.Branch_id, nil
+		}
+	}
+	branch := models.Branch{Name: &name, Created_at: now, Updated_at: now, Version: 1}
+	branch.ID = primitive.NewObjectID()
+	branch.Branch_id = branch.ID.Hex()
+	if err := repos.Branches.Create(ctx, branch); err != nil {
+		return "", fmt.Errorf("branch %q: %w", name, err)
+	}
+	report.Branches++
+	return branch.Branch_id, nil
+}
+
+func createFood(ctx context.Context, repos *repository.Repositories, menuId string, fixtureFood FixtureFood, now time.Time) error {
+	price, err := money.Parse(fixtureFood.Price.String(), "")
+	if err != nil {
+		return err
+	}
+	name, image, menu := fixtureFood.Name, fixtureFood.Food_image, menuId
+	food := models.Food{Name: &name, Price: &price, Food_image: &image, Menu_id: &menu, Created_at: now, Updated_at: now, Version: 1}
+	food.ID = primitive.NewObjectID()
+	food.Food_id = food.ID.Hex()
+	return repos.Foods.Create(ctx, food)
+}
+
+func createTable(ctx context.Context, repos *repository.Repositories, number int, guests int, now time.Time) (models.Table, error) {
+	table := models.Table{Table_number: &number, Number_of_guests: &guests, Created_at: now, Updated_at: now, Version: 1}
+	table.ID = primitive.NewObjectID()
+	table.Table_id = table.ID.Hex()
+	return table, repos.Tables.Create(ctx, table)
+}
+
+func createUser(ctx context.Context, repos *repository.Repositories, fixtureUser FixtureUser, branchId string, now time.Time) error {
+	// the same cost SignUp hashes with
+	hashed, err := bcrypt.GenerateFromPassword([]byte(fixtureUser.Password), 14)
+	if err != nil {
+		return err
+	}
+	roles := []string{}
+	for _, role := range fixtureUser.Roles {
+		if !models.IsRole(role) {
+			return fmt.Errorf("unknown role %q", role)
+		}
+		roles = append(roles, role)
+	}
+	first, last, email, phone, password := fixtureUser.First_name, fixtureUser.Last_name, fixtureUser.Email, fixtureUser.Phone, string(hashed)
+	user := models.User{First_name: &first, Last_name: &last, Email: &email, Phone: &phone, Password: &password, Branches: []string{branchId}, Roles: roles, Created_at: now, Updated_at: now, Version: 1}
+	user.ID = primitive.NewObjectID()
+	user.User_id = user.ID.Hex()
+	return repos.Users.Create(ctx, user)
+}
+
+// timestamp truncates a time to the second, like the handlers do
+func timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
@@ -0,0 +1,187 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"restaurant-backend/models"
+	"restaurant-backend/money"
+	"restaurant-backend/repository"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GenerateOptions sizes the restaurant made up by Generate
+type GenerateOptions struct {
+	Tables       int
+	Menus        int
+	FoodsPerMenu int
+	// OrdersPerDay is the average number of orders placed on each day of the range
+	OrdersPerDay int
+	From         time.Time
+	To           time.Time
+	// Seed makes the generated data reproducible
+	Seed int64
+	// Branch names the branch the restaurant is generated in, DefaultBranch when empty
+	Branch string
+}
+
+// the menus and dishes the generator picks from
+var catalog = []struct {
+	name, category string
+	foods          []string
+	minPrice       float64
+	maxPrice       float64
+}{
+	{"Breakfast", "breakfast", []string{"Pancakes", "Omelette", "Granola Bowl", "Eggs Benedict", "French Toast", "Avocado Toast"}, 4, 12},
+	{"Starters", "starter", []string{"Tomato Soup", "Garlic Bread", "Bruschetta", "Spring Rolls", "Chicken Wings", "Caesar Salad"}, 3, 9},
+	{"Mains", "main", []string{"Grilled Salmon", "Beef Burger", "Chicken Curry", "Margherita Pizza", "Lamb Stew", "Mushroom Risotto", "Fish and Chips"}, 9, 28},
+	{"Grill", "main", []string{"Ribeye Steak", "Pork Ribs", "Chicken Skewers", "Grilled Halloumi", "Sausage Platter"}, 12, 35},
+	{"Desserts", "dessert", []string{"Chocolate Cake", "Cheesecake", "Apple Pie", "Ice Cream", "Creme Brulee", "Tiramisu"}, 3, 9},
+	{"Drinks", "drink", []string{"Fresh Juice", "Lemonade", "Iced Tea", "Espresso", "Cappuccino", "Sparkling Water", "Milkshake"}, 1.5, 6},
+}
+
+// Generate makes up a branch of the restaurant: tables, menus with priced foods and, for every day of
+// the range, orders with their items and an invoice, so the reports have something to show.
+// Orders of past days are paid, orders of today are still pending.
+func Generate(ctx context.Context, repos *repository.Repositories, opts GenerateOptions) (Report, error) {
+	var report Report
+	if opts.Tables < 1 || opts.Menus < 1 || opts.FoodsPerMenu < 1 {
+		return report, fmt.Errorf("at least one table, one menu and one food per menu are needed")
+	}
+	if opts.To.Before(opts.From) {
+		return report, fmt.Errorf("the end of the date range is before its start")
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	now := timestamp(time.Now())
+
+	branchId, err := useBranch(ctx, repos, opts.Branch, now, &report)
+	if err != nil {
+		return report, err
+	}
+	ctx = repository.WithBranch(ctx, branchId)
+
+	// the new tables are numbered after the ones already there
+	existing, _, err := repos.Tables.List(ctx, repository.ListOptions{})
+	if err != nil {
+		return report, err
+	}
+	nextNumber := 1
+	for _, table := range existing {
+		if table.Table_number != nil && *table.Table_number >= nextNumber {
+			nextNumber = *table.Table_number + 1
+		}
+	}
+	tables := []models.Table{}
+	for i := 0; i < opts.Tables; i++ {
+		table, err := createTable(ctx, repos, nextNumber+i, 2+2*rng.Intn(4), now)
+		if err != nil {
+			return report, err
+		}
+		tables = append(tables, table)
+		report.Tables++
+	}
+
+	foods := []models.Food{}
+	for i := 0; i < opts.Menus; i++ {
+		entry := catalog[i%len(catalog)]
+		menu := models.Menu{Name: entry.name, Category: entry.category, Created_at: now, Updated_at: now, Version: 1}
+		if i >= len(catalog) {
+			menu.Name = fmt.Sprintf("%s %d", entry.name, i/len(catalog)+1)
+		}
+		menu.ID = primitive.NewObjectID()
+		menu.Menu_id = menu.ID.Hex()
+		if err := repos.Menus.Create(ctx, menu); err != nil {
+			return report, err
+		}
+		report.Menus++
+
+		for j := 0; j < opts.FoodsPerMenu; j++ {
+			name := entry.foods[j%len(entry.foods)]
+			if j >= len(entry.foods) {
+				name = fmt.Sprintf("%s %d", name, j/len(entry.foods)+1)
+			}
+			// prices end in .00 or .50
+			halves := math.Round((entry.minPrice + rng.Float64()*(entry.maxPrice-entry.minPrice)) * 2)
+			price, err := money.FromFloat(halves/2, "")
+			if err != nil {
+				return report, err
+			}
+			menuId := menu.Menu_id
+			food := models.Food{Name: &name, Price: &price, Menu_id: &menuId, Created_at: now, Updated_at: now, Version: 1}
+			food.ID = primitive.NewObjectID()
+			food.Food_id = food.ID.Hex()
+			image := fmt.Sprintf("https://picsum.photos/seed/%s/400/300", food.Food_id)
+			food.Food_image = &image
+			if err := repos.Foods.Create(ctx, food); err != nil {
+				return report, err
+			}
+			foods = append(foods, food)
+			report.Foods++
+		}
+	}
+
+	if opts.OrdersPerDay < 1 {
+		return report, nil
+	}
+	today := now.Truncate(24 * time.Hour)
+	for day := opts.From.UTC().Truncate(24 * time.Hour); !day.After(opts.To); day = day.Add(24 * time.Hour) {
+		// busier and quieter days around the average
+		count := opts.OrdersPerDay/2 + rng.Intn(opts.OrdersPerDay+1)
+		for i := 0; i < count; i++ {
+			// orders come in between 11:00 and 22:00
+			placed := day.Add(11*time.Hour + time.Duration(rng.Intn(11*60))*time.Minute)
+			table := tables[rng.Intn(len(tables))]
+			paid := day.Before(today)
+			if err := generateOrder(ctx, repos, rng, table, foods, placed, paid, &report); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+func generateOrder(ctx context.Context, repos *repository.Repositories, rng *rand.Rand, table models.Table, foods []models.Food, placed time.Time, paid bool, report *Report) error {
+	tableId := table.Table_id
+	order := models.Order{Order_date: placed, Table_id: &tableId, Created_at: placed, Updated_at: placed, Version: 1}
+	order.ID = primitive.NewObjectID()
+	order.Order_id = order.ID.Hex()
+	if err := repos.Orders.Create(ctx, order); err != nil {
+		return err
+	}
+	report.Orders++
+
+	items := []models.OrderItem{}
+	for i := 1 + rng.Intn(5); i > 0; i-- {
+		food := foods[rng.Intn(len(foods))]
+		foodId, price, quantity := food.Food_id, *food.Price, strconv.Itoa(1+rng.Intn(3))
+		item := models.OrderItem{Food_id: &foodId, Unit_price: &price, Quantity: &quantity, Order_id: order.Order_id, Created_at: placed, Updated_at: placed, Version: 1}
+		item.ID = primitive.NewObjectID()
+		item.Order_item_id = item.ID.Hex()
+		items = append(items, item)
+	}
+	if err := repos.OrderItems.CreateMany(ctx, items); err != nil {
+		return err
+	}
+	report.OrderItems += len(items)
+
+	status := "PENDING"
+	var method *string
+	if paid {
+		status = "PAID"
+		chosen := []string{"CARD", "CASH"}[rng.Intn(2)]
+		method = &chosen
+	}
+	settled := placed.Add(time.Duration(30+rng.Intn(90)) * time.Minute)
+	invoice := models.Invoice{Order_id: order.Order_id, Payment_method: method, Payment_status: &status, Payment_due_date: placed.Add(24 * time.Hour), Created_at: settled, Updated_at: settled, Version: 1}
+	invoice.ID = primitive.NewObjectID()
+	invoice.Invoice_id = invoice.ID.Hex()
+	if err := repos.Invoices.Create(ctx, invoice); err != nil {
+		return err
+	}
+	report.Invoices++
+	return nil
+}
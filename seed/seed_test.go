@@ -0,0 +1,99 @@
+package seed
+
+import (
+	"context"
+	"restaurant-backend/repository"
+	"testing"
+	"time"
+)
+
+func TestLoadSkipsWhatIsThere(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	fixture := Fixture{
+		Menus: []FixtureMenu{{Name: "Lunch", Category: "main", Foods: []FixtureFood{
+			{Name: "Soup", Price: "4.50", Food_image: "soup.png"},
+			{Name: "Stew", Price: "9", Food_image: "stew.png"},
+		}}},
+		Tables: []FixtureTable{{Table_number: 1, Number_of_guests: 2}, {Table_number: 2, Number_of_guests: 4}},
+	}
+
+	report, err := Load(ctx, repos, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Report{Branches: 1, Menus: 1, Foods: 2, Tables: 2}
+	if report != want {
+		t.Errorf("expected %+v, got %+v", want, report)
+	}
+
+	report, err = Load(ctx, repos, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Report{Skipped: 5}); report != want {
+		t.Errorf("a second load must skip everything, expected %+v, got %+v", want, report)
+	}
+
+	foods, _, err := repos.Foods.List(repository.AllBranches(ctx), repository.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, food := range foods {
+		if *food.Name == "Soup" && food.Price.Amount != 450 {
+			t.Errorf("expected the soup to cost 450 cents, got %v", food.Price)
+		}
+		if food.Branch_id == "" {
+			t.Errorf("food %s has no branch", *food.Name)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	opts := GenerateOptions{
+		Tables:       3,
+		Menus:        2,
+		FoodsPerMenu: 3,
+		OrdersPerDay: 4,
+		From:         time.Now().AddDate(0, 0, -2),
+		To:           time.Now(),
+		Seed:         7,
+	}
+
+	first, err := Generate(ctx, repository.NewMemory(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Tables != 3 || first.Menus != 2 || first.Foods != 6 || first.Orders == 0 || first.Invoices != first.Orders {
+		t.Errorf("unexpected report %+v", first)
+	}
+
+	// the same seed makes up the same restaurant
+	repos := repository.NewMemory()
+	second, err := Generate(ctx, repos, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected the same report for the same seed, got %+v and %+v", first, second)
+	}
+
+	invoices, _, err := repos.Invoices.List(repository.AllBranches(ctx), repository.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paid := 0
+	for _, invoice := range invoices {
+		if invoice.Payment_status != nil && *invoice.Payment_status == "PAID" {
+			paid++
+		}
+	}
+	if paid == 0 {
+		t.Errorf("expected the orders of past days to be paid")
+	}
+
+	if _, err := Generate(ctx, repos, GenerateOptions{Menus: 1, FoodsPerMenu: 1}); err == nil {
+		t.Errorf("expected a restaurant without tables to be refused")
+	}
+}